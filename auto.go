@@ -0,0 +1,30 @@
+package main
+
+// Pick defaults for color, PTY and stream merging from whether stdout is a terminal
+var autoDefaults bool
+
+// applyAutoDefaults sets the defaults --auto picks for an interactive
+// terminal or for piped output. Flags set explicitly on the command line,
+// as reported by changed, are left alone.
+func applyAutoDefaults(terminal bool, changed func(name string) bool) {
+	if terminal {
+		// Commands behave as if run directly in the terminal, with their own
+		// colors and line buffering; --interactive needs stdin so it keeps pipes
+		if !changed("no-color") {
+			noColor = false
+		}
+		if ptySupported && !interactive && !changed("pty") {
+			usePTY = true
+		}
+		return
+	}
+
+	// Output read by another program or a log file: no escape codes, and
+	// each command's stdout and stderr kept in the order they were written
+	if !changed("no-color") {
+		noColor = true
+	}
+	if !usePTY && !changed("merge-streams") {
+		mergeStreams = true
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// TestApplyAutoDefaults tests the defaults picked by --auto and that explicit flags win
+func TestApplyAutoDefaults(t *testing.T) {
+	oldNoColor := noColor
+	oldPTY := usePTY
+	oldMerge := mergeStreams
+	oldInteractive := interactive
+	defer func() {
+		noColor = oldNoColor
+		usePTY = oldPTY
+		mergeStreams = oldMerge
+		interactive = oldInteractive
+	}()
+
+	none := func(string) bool { return false }
+	reset := func() {
+		noColor = false
+		usePTY = false
+		mergeStreams = false
+		interactive = false
+	}
+
+	reset()
+	applyAutoDefaults(false, none)
+	if !noColor || !mergeStreams || usePTY {
+		t.Errorf("applyAutoDefaults(piped) set noColor=%v mergeStreams=%v usePTY=%v, want true, true, false", noColor, mergeStreams, usePTY)
+	}
+
+	reset()
+	applyAutoDefaults(false, func(name string) bool { return name == "no-color" || name == "merge-streams" })
+	if noColor || mergeStreams {
+		t.Errorf("applyAutoDefaults(piped) overrode explicit flags: noColor=%v mergeStreams=%v", noColor, mergeStreams)
+	}
+
+	reset()
+	noColor = true
+	applyAutoDefaults(true, none)
+	if noColor || mergeStreams || usePTY != ptySupported {
+		t.Errorf("applyAutoDefaults(terminal) set noColor=%v mergeStreams=%v usePTY=%v, want false, false, %v", noColor, mergeStreams, usePTY, ptySupported)
+	}
+
+	reset()
+	applyAutoDefaults(true, func(name string) bool { return name == "pty" })
+	if usePTY {
+		t.Error("applyAutoDefaults(terminal) enabled the PTY despite an explicit --pty=false")
+	}
+
+	reset()
+	interactive = true
+	applyAutoDefaults(true, none)
+	if usePTY {
+		t.Error("applyAutoDefaults(terminal) enabled the PTY with --interactive")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+// barrierFD is the file descriptor commands read the start barrier from.
+// It is the first descriptor after stdin, stdout and stderr.
+const barrierFD = 3
+
+var (
+	// Let parallel commands wait until all of them have been started
+	barrier bool
+	// Barrier of the current parallel run, nil without --barrier
+	startGate *startBarrier
+)
+
+// startBarrier is a pipe passed to every command as fd 3. rufl never writes
+// to it, so a command reading from it blocks until rufl closes the write end
+// once all commands have been started, and then reads EOF.
+type startBarrier struct {
+	reader  *os.File
+	writer  *os.File
+	release sync.Once
+}
+
+// newStartBarrier creates a closed barrier
+func newStartBarrier() (*startBarrier, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	return &startBarrier{reader: reader, writer: writer}, nil
+}
+
+// attach passes the barrier to a command that has not been started yet
+func (b *startBarrier) attach(cmd *exec.Cmd) {
+	cmd.ExtraFiles = []*os.File{b.reader}
+	cmd.Env = append(cmd.Env, fmt.Sprintf("RUFL_BARRIER_FD=%d", barrierFD))
+}
+
+// open releases every command waiting on the barrier. Commands started
+// later, such as restarts, pass the barrier right away.
+func (b *startBarrier) open() {
+	b.release.Do(func() { _ = b.writer.Close() })
+}
+
+// close releases the barrier if needed and closes rufl's end of the pipe
+func (b *startBarrier) close() {
+	b.open()
+	_ = b.reader.Close()
+}
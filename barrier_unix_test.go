@@ -0,0 +1,106 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestStartBarrier tests that reading the barrier blocks until it is opened
+func TestStartBarrier(t *testing.T) {
+	gate, err := newStartBarrier()
+	if err != nil {
+		t.Fatalf("newStartBarrier() error = %v", err)
+	}
+	defer gate.close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := gate.reader.Read(make([]byte, 1))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("read returned %v before the barrier was opened", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	gate.open()
+	gate.open()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("read after open returned %v, want EOF", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("read still blocked after the barrier was opened")
+	}
+}
+
+// TestBarrierRun tests that parallel commands waiting on the barrier are released
+func TestBarrierRun(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldBarrier, oldNoColor := barrier, noColor
+	barrier, noColor = true, true
+	defer func() { barrier, noColor = oldBarrier, oldNoColor }()
+
+	commands := []CommandInfo{
+		{Command: `sh -c 'cat <&$RUFL_BARRIER_FD; echo released'`, Tag: "a", Index: 0},
+		{Command: `sh -c 'cat <&$RUFL_BARRIER_FD; echo released'`, Tag: "b", Index: 1},
+	}
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runParallel(commands)
+	})
+
+	for _, result := range results {
+		if !result.Success {
+			t.Errorf("runParallel() result = %+v, want success", result)
+		}
+	}
+	for _, want := range []string{"All 2 commands started, releasing the barrier", "[a:out] released", "[b:out] released"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("runParallel() output = %q, want %q", output, want)
+		}
+	}
+	if startGate != nil {
+		t.Error("runParallel() left the barrier set")
+	}
+}
+
+// TestBarrierWaitsForDelayedCommands tests that the barrier only opens once
+// delayed commands have been started as well
+func TestBarrierWaitsForDelayedCommands(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldBarrier, oldNoColor := barrier, noColor
+	barrier, noColor = true, true
+	defer func() { barrier, noColor = oldBarrier, oldNoColor }()
+
+	delay := 300 * time.Millisecond
+	commands := []CommandInfo{
+		{Command: `sh -c 'cat <&$RUFL_BARRIER_FD'`, Tag: "a", Index: 0},
+		{Command: "true", Tag: "b", Index: 1, Delay: delay},
+	}
+
+	var results []CommandResult
+	captureStdout(func() {
+		results = runParallel(commands)
+	})
+
+	if results[0].Duration < delay {
+		t.Errorf("barrier opened after %v, want at least the %v delay", results[0].Duration, delay)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	// Number of times every command is run for benchmarking, 0 disables it
+	benchRuns int
+	// Number of unmeasured runs of every command before benchmarking
+	warmupRuns int
+	// Command run once before benchmarking, such as one priming caches
+	warmupCommand string
+	// Format of the benchmark statistics: table or json
+	benchFormat string
+)
+
+// BenchStats summarizes the durations of a command over repeated runs
+type BenchStats struct {
+	Tag        string  `json:"tag"`
+	Command    string  `json:"command"`
+	Runs       int     `json:"runs"`
+	Warmup     int     `json:"warmup_runs"`
+	Failures   int     `json:"failures"`
+	Min        float64 `json:"min_seconds"`
+	Max        float64 `json:"max_seconds"`
+	Mean       float64 `json:"mean_seconds"`
+	Median     float64 `json:"median_seconds"`
+	StdDev     float64 `json:"stddev_seconds"`
+	Throughput float64 `json:"runs_per_second"`
+}
+
+// computeBenchStats groups results by tag, in the order tags first appear,
+// and computes duration statistics for each of them
+func computeBenchStats(results []CommandResult) []BenchStats {
+	var order []string
+	durations := make(map[string][]float64)
+	stats := make(map[string]*BenchStats)
+
+	for _, result := range results {
+		s, ok := stats[result.Tag]
+		if !ok {
+			s = &BenchStats{Tag: result.Tag, Command: result.Command}
+			stats[result.Tag] = s
+			order = append(order, result.Tag)
+		}
+		s.Runs++
+		if !result.Success {
+			s.Failures++
+		}
+		durations[result.Tag] = append(durations[result.Tag], result.Duration.Seconds())
+	}
+
+	all := make([]BenchStats, 0, len(order))
+	for _, tag := range order {
+		s := stats[tag]
+		values := durations[tag]
+		sort.Float64s(values)
+
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		n := float64(len(values))
+		s.Min = values[0]
+		s.Max = values[len(values)-1]
+		s.Mean = sum / n
+
+		mid := len(values) / 2
+		if len(values)%2 == 0 {
+			s.Median = (values[mid-1] + values[mid]) / 2
+		} else {
+			s.Median = values[mid]
+		}
+
+		var variance float64
+		for _, v := range values {
+			variance += (v - s.Mean) * (v - s.Mean)
+		}
+		s.StdDev = math.Sqrt(variance / n)
+
+		if sum > 0 {
+			s.Throughput = n / sum
+		}
+		all = append(all, *s)
+	}
+	return all
+}
+
+// countWarmups sets the number of warmup runs of each tag in stats
+func countWarmups(stats []BenchStats, warmups []CommandResult) {
+	counts := make(map[string]int)
+	for _, result := range warmups {
+		counts[result.Tag]++
+	}
+	for i := range stats {
+		stats[i].Warmup = counts[stats[i].Tag]
+	}
+}
+
+// runWarmupCommand runs --warmup before benchmarking. A failing warmup is
+// reported, but does not stop the benchmark.
+func runWarmupCommand() {
+	printColoredMessage(fmt.Sprintf("Benchmark warmup: %s", warmupCommand), colorBlue)
+	if result := executeCommand(CommandInfo{Command: warmupCommand, Tag: "warmup"}); !result.Success {
+		printColoredMessage("Warmup command failed, the benchmark may include cold starts", colorYellow)
+	}
+}
+
+// formatBenchStats renders benchmark statistics as a table or as JSON
+func formatBenchStats(stats []BenchStats, format string) string {
+	if format == "json" {
+		data, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			return ""
+		}
+		return string(data) + "\n"
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tRUNS\tWARMUP\tFAILED\tMIN\tMAX\tMEAN\tMEDIAN\tSTDDEV\tRUNS/S")
+	for _, s := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\t%s\t%s\t%.2f\n", s.Tag, s.Runs, s.Warmup, s.Failures,
+			formatSeconds(s.Min), formatSeconds(s.Max), formatSeconds(s.Mean),
+			formatSeconds(s.Median), formatSeconds(s.StdDev), s.Throughput)
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// formatSeconds formats a duration in seconds with a precision that suits it
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Microsecond).String()
+}
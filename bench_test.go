@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestComputeBenchStats tests the duration statistics of repeated runs
+func TestComputeBenchStats(t *testing.T) {
+	results := []CommandResult{
+		{Tag: "a", Command: "cmd-a", Success: true, Duration: 1 * time.Second},
+		{Tag: "b", Command: "cmd-b", Success: true, Duration: 5 * time.Second},
+		{Tag: "a", Command: "cmd-a", Success: false, Duration: 3 * time.Second},
+		{Tag: "a", Command: "cmd-a", Success: true, Duration: 2 * time.Second},
+		{Tag: "a", Command: "cmd-a", Success: true, Duration: 6 * time.Second},
+	}
+
+	stats := computeBenchStats(results)
+	if len(stats) != 2 || stats[0].Tag != "a" || stats[1].Tag != "b" {
+		t.Fatalf("computeBenchStats() = %+v, want stats for a and b in order", stats)
+	}
+
+	a := stats[0]
+	if a.Runs != 4 || a.Failures != 1 {
+		t.Errorf("runs/failures = %d/%d, want 4/1", a.Runs, a.Failures)
+	}
+	if a.Min != 1 || a.Max != 6 || a.Mean != 3 || a.Median != 2.5 {
+		t.Errorf("min/max/mean/median = %v/%v/%v/%v, want 1/6/3/2.5", a.Min, a.Max, a.Mean, a.Median)
+	}
+	if math.Abs(a.StdDev-math.Sqrt(3.5)) > 1e-9 {
+		t.Errorf("stddev = %v, want %v", a.StdDev, math.Sqrt(3.5))
+	}
+	if math.Abs(a.Throughput-4.0/12) > 1e-9 {
+		t.Errorf("throughput = %v, want %v", a.Throughput, 4.0/12)
+	}
+
+	b := stats[1]
+	if b.Runs != 1 || b.Median != 5 || b.StdDev != 0 {
+		t.Errorf("stats for b = %+v, want a single run of 5s", b)
+	}
+}
+
+// TestFormatBenchStats tests the table and JSON output of benchmark statistics
+func TestFormatBenchStats(t *testing.T) {
+	stats := []BenchStats{{Tag: "build", Command: "make", Runs: 3, Min: 1, Max: 2, Mean: 1.5, Median: 1.5, StdDev: 0.25, Throughput: 0.67}}
+
+	table := formatBenchStats(stats, "table")
+	lines := strings.Split(strings.TrimSpace(table), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "TAG") || !strings.HasPrefix(lines[1], "build") {
+		t.Errorf("formatBenchStats(table) = %q, want a header and one row", table)
+	}
+	if !strings.Contains(lines[1], "1.5s") || !strings.Contains(lines[1], "250ms") {
+		t.Errorf("formatBenchStats(table) row = %q, want formatted durations", lines[1])
+	}
+
+	if !strings.Contains(lines[0], "WARMUP") {
+		t.Errorf("formatBenchStats(table) header = %q, want a warmup column", lines[0])
+	}
+
+	if json := formatBenchStats(stats, "json"); !strings.Contains(json, `"median_seconds": 1.5`) {
+		t.Errorf("formatBenchStats(json) = %q, want the median in seconds", json)
+	}
+}
+
+// TestBenchWarmup tests that warmup runs are counted separately and left out of the results
+func TestBenchWarmup(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldBenchRuns, oldWarmupRuns, oldWarmupCommand := benchRuns, warmupRuns, warmupCommand
+	oldNoColor, oldNoBanner, oldBenchFormat := noColor, noBanner, benchFormat
+	benchRuns, warmupRuns, warmupCommand = 2, 1, "echo priming"
+	noColor, noBanner, benchFormat = true, true, "json"
+	defer func() {
+		benchRuns, warmupRuns, warmupCommand = oldBenchRuns, oldWarmupRuns, oldWarmupCommand
+		noColor, noBanner, benchFormat = oldNoColor, oldNoBanner, oldBenchFormat
+	}()
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runCommands([]CommandInfo{{Command: "echo hi", Tag: "a"}}, false)
+	})
+
+	if len(results) != 2 {
+		t.Errorf("runCommands() returned %d results, want only the 2 measured runs", len(results))
+	}
+	for _, want := range []string{"[warmup:out] priming", "Benchmark warmup run 1/1", `"runs": 2`, `"warmup_runs": 1`} {
+		if !strings.Contains(output, want) {
+			t.Errorf("runCommands() output = %q, want to contain %q", output, want)
+		}
+	}
+	if strings.Index(output, "Benchmark warmup run 1/1") > strings.Index(output, "Benchmark run 1/2") {
+		t.Errorf("runCommands() output = %q, want the warmup run before the measured runs", output)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "sort"
+
+var (
+	// Hold back all command output and print it grouped by tag at the end
+	bufferUntilExit bool
+	// Output held back with --buffer-until-exit, by tag. Nil while output
+	// is printed as it comes. Guarded by outputMutex.
+	bufferedLines map[string][]outputLine
+)
+
+// startBuffering holds back command output, and rufl's status messages
+// about each command, until flushBufferedOutput. Other status messages are
+// still printed as they happen.
+func startBuffering() {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	bufferedLines = make(map[string][]outputLine)
+}
+
+// bufferLine holds back a line of output if buffering, and reports whether
+// it did. Must be called with outputMutex held.
+func bufferLine(line outputLine) bool {
+	if bufferedLines == nil {
+		return false
+	}
+	bufferedLines[line.tag] = append(bufferedLines[line.tag], line)
+	return true
+}
+
+// bufferMessage holds back a rendered status message about the command with
+// tag if buffering, and reports whether it did. Must be called with
+// outputMutex held.
+func bufferMessage(tag string, text string) bool {
+	return bufferLine(outputLine{tag: tag, stream: "rufl", text: text})
+}
+
+// flushBufferedOutput stops buffering and prints the held back output of
+// every command in one piece, sorted by tag
+func flushBufferedOutput() {
+	outputMutex.Lock()
+	lines := bufferedLines
+	bufferedLines = nil
+	outputMutex.Unlock()
+
+	tags := make([]string, 0, len(lines))
+	for tag := range lines {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		for _, line := range lines[tag] {
+			printOutputLine(line)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Working directory of all commands (--chdir), empty for rufl's own
+var workDir string
+
+// checkWorkDir verifies that the --chdir directory exists
+func checkWorkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("cannot change to directory '%s': %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("cannot change to '%s': not a directory", dir)
+	}
+	return nil
+}
+
+// commandDir returns the directory a command runs in. A directory of the
+// command's own wins over --chdir; when relative, it is taken relative to it.
+func commandDir(cmdInfo CommandInfo) string {
+	if cmdInfo.Dir == "" {
+		return workDir
+	}
+	if workDir != "" && !filepath.IsAbs(cmdInfo.Dir) {
+		return filepath.Join(workDir, cmdInfo.Dir)
+	}
+	return cmdInfo.Dir
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCommandDir tests that a command's own directory wins over --chdir
+func TestCommandDir(t *testing.T) {
+	oldWorkDir := workDir
+	defer func() { workDir = oldWorkDir }()
+
+	root := filepath.Join(t.TempDir(), "project")
+	tests := []struct {
+		workDir string
+		dir     string
+		want    string
+	}{
+		{workDir: "", dir: "", want: ""},
+		{workDir: root, dir: "", want: root},
+		{workDir: root, dir: "web", want: filepath.Join(root, "web")},
+		{workDir: root, dir: os.TempDir(), want: os.TempDir()},
+		{workDir: "", dir: "web", want: "web"},
+	}
+
+	for _, tt := range tests {
+		workDir = tt.workDir
+		if got := commandDir(CommandInfo{Dir: tt.dir}); got != tt.want {
+			t.Errorf("commandDir() with --chdir %q and dir %q = %q, want %q", tt.workDir, tt.dir, got, tt.want)
+		}
+	}
+}
+
+// TestDirTagSpec tests setting a command's directory with an @ modifier
+func TestDirTagSpec(t *testing.T) {
+	cmdInfo := applyTagSpec(CommandInfo{Tag: "web@dir=frontend", Command: "npm test"})
+	if cmdInfo.Tag != "web" || cmdInfo.Dir != "frontend" {
+		t.Errorf("applyTagSpec() = %+v, want web in frontend", cmdInfo)
+	}
+}
+
+// TestCheckWorkDir tests that --chdir must name an existing directory
+func TestCheckWorkDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkWorkDir(dir); err != nil {
+		t.Errorf("checkWorkDir(%q) error = %v", dir, err)
+	}
+	for _, invalid := range []string{file, filepath.Join(dir, "missing")} {
+		if err := checkWorkDir(invalid); err == nil {
+			t.Errorf("checkWorkDir(%q) expected an error", invalid)
+		}
+	}
+}
+
+// TestCommandRunsInWorkDir tests that commands run in the --chdir directory
+func TestCommandRunsInWorkDir(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldWorkDir := workDir
+	oldNoColor := noColor
+	defer func() {
+		workDir = oldWorkDir
+		noColor = oldNoColor
+	}()
+
+	workDir = t.TempDir()
+	noColor = true
+	if err := os.WriteFile(filepath.Join(workDir, "marker.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(func() {
+		executeCommand(CommandInfo{Command: "ls", Tag: "ls"})
+	})
+	if !strings.Contains(output, "[ls:out] marker.txt") {
+		t.Errorf("command output = %q, want it to list the --chdir directory", output)
+	}
+}
+
+// TestCommandRunsInOwnDir tests that a command with @dir= runs in that directory below --chdir
+func TestCommandRunsInOwnDir(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldWorkDir := workDir
+	oldNoColor := noColor
+	defer func() {
+		workDir = oldWorkDir
+		noColor = oldNoColor
+	}()
+
+	workDir = t.TempDir()
+	noColor = true
+	if err := os.MkdirAll(filepath.Join(workDir, "web"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "web", "package.json"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := captureStdout(func() {
+		executeCommand(applyTagSpec(CommandInfo{Command: "ls", Tag: "ls@dir=web"}))
+	})
+	if !strings.Contains(output, "[ls:out] package.json") {
+		t.Errorf("command output = %q, want it to list the web directory", output)
+	}
+}
@@ -56,6 +56,56 @@ func TestProcessOutputPreservesColors(t *testing.T) {
 	}
 }
 
+// TestProcessOutputTagColor tests that a color pinned to a tag overrides the stream color
+func TestProcessOutputTagColor(t *testing.T) {
+	oldNoColor := noColor
+	oldColorSupported := colorSupported
+	oldTagColors := tagColors
+	noColor = false
+	colorSupported = true
+	tagColors = map[string]string{"build": colorBlue}
+	defer func() {
+		noColor = oldNoColor
+		colorSupported = oldColorSupported
+		tagColors = oldTagColors
+	}()
+
+	output := captureStdout(func() {
+		processOutput(strings.NewReader("compiling\n"), "build", "err", colorRed)
+		processOutput(strings.NewReader("testing\n"), "test", "err", colorRed)
+	})
+
+	if !strings.Contains(output, colorBlue+"[build]") {
+		t.Errorf("processOutput() did not use the tag color, output = %q", output)
+	}
+	if !strings.Contains(output, colorRed+"[test]") {
+		t.Errorf("processOutput() did not keep the stream color for other tags, output = %q", output)
+	}
+}
+
+// TestPrefixColor tests that an inline tag color wins over --tag-color and the stream color
+func TestPrefixColor(t *testing.T) {
+	oldTagColors := tagColors
+	tagColors = map[string]string{"build": colorBlue}
+	defer func() { tagColors = oldTagColors }()
+
+	tests := []struct {
+		cmdInfo CommandInfo
+		want    string
+	}{
+		{CommandInfo{Tag: "build", Color: colorGreen}, colorGreen},
+		{CommandInfo{Tag: "build"}, colorBlue},
+		{CommandInfo{Tag: "test"}, colorRed},
+		{CommandInfo{Tag: "test", Color: colorCyan}, colorCyan},
+	}
+
+	for _, tt := range tests {
+		if got := prefixColor(tt.cmdInfo, colorRed); got != tt.want {
+			t.Errorf("prefixColor(%v) = %q, want %q", tt.cmdInfo, got, tt.want)
+		}
+	}
+}
+
 // TestProcessOutputWithNoColor tests that the processOutput function doesn't use colors when noColor is true
 func TestProcessOutputWithNoColor(t *testing.T) {
 	// Save original stdout and color settings
@@ -192,3 +242,58 @@ func TestPrintColoredMessage(t *testing.T) {
 		})
 	}
 }
+
+// TestAlwaysShowStream tests that the stream type is kept in colored prefixes when asked for
+func TestAlwaysShowStream(t *testing.T) {
+	oldNoColor := noColor
+	oldColorSupported := colorSupported
+	oldAlwaysShowStream := alwaysShowStream
+	noColor = false
+	colorSupported = true
+	defer func() {
+		noColor = oldNoColor
+		colorSupported = oldColorSupported
+		alwaysShowStream = oldAlwaysShowStream
+	}()
+
+	alwaysShowStream = false
+	if output := captureStdout(func() { processOutput(strings.NewReader("x\n"), "t", "err", colorRed) }); output != colorRed+"[t] "+colorReset+"x\n" {
+		t.Errorf("processOutput() output = %q, want no stream type", output)
+	}
+
+	alwaysShowStream = true
+	if output := captureStdout(func() { processOutput(strings.NewReader("x\n"), "t", "err", colorRed) }); output != colorRed+"[t:err] "+colorReset+"x\n" {
+		t.Errorf("processOutput() with --always-show-stream output = %q, want the stream type", output)
+	}
+}
+
+// TestColorWholeLine tests that --color-whole-line colors the content and restores the color after resets
+func TestColorWholeLine(t *testing.T) {
+	oldNoColor := noColor
+	oldColorSupported := colorSupported
+	oldColorWholeLine := colorWholeLine
+	noColor = false
+	colorSupported = true
+	defer func() {
+		noColor = oldNoColor
+		colorSupported = oldColorSupported
+		colorWholeLine = oldColorWholeLine
+	}()
+
+	colorWholeLine = true
+	output := captureStdout(func() {
+		processOutput(strings.NewReader("plain \033[1mbold\033[0m after\n"), "t", "out", colorGreen)
+	})
+	want := colorGreen + "[t] " + colorReset + colorGreen + "plain \033[1mbold\033[0m" + colorGreen + " after" + colorReset + "\n"
+	if output != want {
+		t.Errorf("processOutput() with --color-whole-line = %q, want %q", output, want)
+	}
+
+	noColor = true
+	output = captureStdout(func() {
+		processOutput(strings.NewReader("plain\n"), "t", "out", colorGreen)
+	})
+	if output != "[t:out] plain\n" {
+		t.Errorf("processOutput() with --color-whole-line and --no-color = %q, want no color", output)
+	}
+}
@@ -5,6 +5,7 @@ package main
 
 import (
 	"os"
+	"syscall"
 )
 
 // enableVirtualTerminalProcessing enables ANSI color support on Unix-like systems
@@ -20,9 +21,9 @@ func isTerminal(fd uintptr) bool {
 	// but for simplicity, we'll just assume it's a terminal if it's a character device
 	// A more complete solution would use golang.org/x/crypto/ssh/terminal
 	// or golang.org/x/term package
-	stat, err := os.Stdout.Stat()
-	if err != nil {
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(int(fd), &stat); err != nil {
 		return false
 	}
-	return (stat.Mode() & os.ModeCharDevice) != 0
+	return uint32(stat.Mode)&syscall.S_IFMT == syscall.S_IFCHR
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runCompare runs the commands sequentially and then in parallel, prints how
+// long each command and each whole run took in both modes, and returns the
+// results of both runs
+func runCompare(commands []CommandInfo) []CommandResult {
+	commands, skipped, ok := prepareCommands(commands, false, true)
+	if !ok {
+		return nil
+	}
+
+	var sequential, parallel []CommandResult
+	var sequentialTime, parallelTime time.Duration
+	var started time.Time
+	compareStarted := time.Now()
+	withRunSetup(commands, func() {
+		printColoredMessage("Running sequentially", colorBlue)
+		sequential, started = runPass(commands, false, skipped)
+		sequentialTime = time.Since(started)
+
+		printColoredMessage("Running in parallel", colorBlue)
+		parallel, started = runPass(commands, true, skipped)
+		parallelTime = time.Since(started)
+	})
+
+	printText(formatComparison(sequential, sequentialTime, parallel, parallelTime))
+
+	results := append(sequential, parallel...)
+	if reportFile != "" {
+		if err := writeReport(reportFile, "compare", compareStarted, results, skipped); err != nil {
+			printColoredMessage(fmt.Sprintf("Error writing report: %v", err), colorRed)
+		}
+	}
+	return results
+}
+
+// formatComparison renders the durations of the commands in a sequential and
+// a parallel run side by side, followed by which mode was faster. With
+// --bench, the mean duration of each command is compared.
+func formatComparison(sequential []CommandResult, sequentialTime time.Duration, parallel []CommandResult, parallelTime time.Duration) string {
+	parallelStats := make(map[string]BenchStats)
+	for _, s := range computeBenchStats(parallel) {
+		parallelStats[s.Tag] = s
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tSEQUENTIAL\tPARALLEL\tCHANGE")
+	failed := false
+	for _, s := range computeBenchStats(sequential) {
+		p, ok := parallelStats[s.Tag]
+		if !ok {
+			continue
+		}
+		failed = failed || s.Failures > 0 || p.Failures > 0
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Tag, formatSeconds(s.Mean), formatSeconds(p.Mean), formatChange(s.Mean, p.Mean))
+	}
+	fmt.Fprintf(w, "total\t%s\t%s\t%s\n", formatSeconds(sequentialTime.Seconds()), formatSeconds(parallelTime.Seconds()),
+		formatChange(sequentialTime.Seconds(), parallelTime.Seconds()))
+	_ = w.Flush()
+
+	switch {
+	case parallelTime < sequentialTime:
+		fmt.Fprintf(&b, "Parallel was %.2fx faster\n", sequentialTime.Seconds()/parallelTime.Seconds())
+	case sequentialTime < parallelTime:
+		fmt.Fprintf(&b, "Sequential was %.2fx faster\n", parallelTime.Seconds()/sequentialTime.Seconds())
+	default:
+		b.WriteString("Both modes took the same time\n")
+	}
+	if failed {
+		b.WriteString("Some commands failed, so the timings may not be comparable\n")
+	}
+	return b.String()
+}
+
+// formatChange formats the relative change from one duration to another
+func formatChange(from, to float64) string {
+	if from == 0 {
+		return "-"
+	}
+	change := math.Round((to - from) / from * 100)
+	if change == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%+.0f%%", change)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRunCompare tests that both runs share one setup, so the exit trap runs
+// once after both and the report holds the results of both
+func TestRunCompare(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	oldTrapExit, oldReportFile, oldNoColor := trapExit, reportFile, noColor
+	trapExit, reportFile, noColor = "echo cleanup", path, true
+	trapOnce = sync.Once{}
+	defer func() {
+		trapExit, reportFile, noColor = oldTrapExit, oldReportFile, oldNoColor
+		trapArmed.Store(false)
+		trapOnce = sync.Once{}
+	}()
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runCompare([]CommandInfo{{Command: "echo work", Tag: "1"}})
+	})
+
+	if len(results) != 2 {
+		t.Errorf("runCompare() returned %d results, want one for each run", len(results))
+	}
+	if got := strings.Count(output, "[trap-exit:out] cleanup"); got != 1 {
+		t.Errorf("exit trap ran %d times, want once; output = %q", got, output)
+	}
+	if strings.Index(output, "Running in parallel") > strings.Index(output, "cleanup") {
+		t.Errorf("exit trap ran between the runs; output = %q", output)
+	}
+
+	report, err := readReport(path)
+	if err != nil {
+		t.Fatalf("readReport() error = %v", err)
+	}
+	if report.Mode != "compare" || len(report.Results) != 2 {
+		t.Errorf("report = %+v, want both runs in compare mode", report)
+	}
+}
+
+// TestRunCompareDryRun tests that --dry-run shows the plan of both modes
+func TestRunCompareDryRun(t *testing.T) {
+	oldDryRun := dryRun
+	dryRun = true
+	defer func() { dryRun = oldDryRun }()
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runCompare([]CommandInfo{{Command: "echo work", Tag: "1"}})
+	})
+
+	if results != nil {
+		t.Errorf("runCompare() with --dry-run = %v, want no results", results)
+	}
+	sequential, parallel := strings.Index(output, "Commands to run sequentially:"), strings.Index(output, "Commands to run in parallel:")
+	if sequential < 0 || parallel < sequential {
+		t.Errorf("runCompare() with --dry-run output = %q, want the sequential and then the parallel plan", output)
+	}
+}
+
+// TestFormatComparison tests the side by side table of a sequential and a parallel run
+func TestFormatComparison(t *testing.T) {
+	sequential := []CommandResult{
+		{Tag: "build", Success: true, Duration: 2 * time.Second},
+		{Tag: "test", Success: true, Duration: time.Second},
+	}
+	parallel := []CommandResult{
+		{Tag: "build", Success: true, Duration: 3 * time.Second},
+		{Tag: "test", Success: false, Duration: time.Second},
+	}
+
+	got := formatComparison(sequential, 3*time.Second, parallel, 2*time.Second)
+	want := "TAG    SEQUENTIAL  PARALLEL  CHANGE\n" +
+		"build  2s          3s        +50%\n" +
+		"test   1s          1s        0%\n" +
+		"total  3s          2s        -33%\n" +
+		"Parallel was 1.50x faster\n" +
+		"Some commands failed, so the timings may not be comparable\n"
+	if got != want {
+		t.Errorf("formatComparison() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestFormatChange tests formatting relative changes
+func TestFormatChange(t *testing.T) {
+	tests := []struct {
+		from, to float64
+		want     string
+	}{
+		{1, 1.5, "+50%"},
+		{2, 1, "-50%"},
+		{1, 1.001, "0%"},
+		{0, 1, "-"},
+	}
+
+	for _, tt := range tests {
+		if got := formatChange(tt.from, tt.to); got != tt.want {
+			t.Errorf("formatChange(%v, %v) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
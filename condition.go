@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseCondition parses the value of a ?CONDITION tag modifier: "success"
+// or "failure", optionally followed by "=TAG" to refer to an earlier
+// command instead of the previous one
+func parseCondition(value string) (condition string, tag string, err error) {
+	condition, tag, _ = strings.Cut(value, "=")
+	if condition != "success" && condition != "failure" {
+		return "", "", fmt.Errorf("expected success or failure, optionally followed by =TAG")
+	}
+	return condition, tag, nil
+}
+
+// conditionMet decides whether a conditional step of a sequential run
+// runs, given the results of the steps before it. A condition refers to
+// the previous step unless it names a tag. A step that did not run has
+// neither succeeded nor failed, so no condition on it is met. The returned
+// reason says why a condition was not met.
+func conditionMet(cmdInfo CommandInfo, results []CommandResult) (bool, string) {
+	if cmdInfo.RunIf == "" {
+		return true, ""
+	}
+
+	var ref *CommandResult
+	if cmdInfo.RunIfTag == "" {
+		if len(results) == 0 {
+			return false, "there is no previous command"
+		}
+		ref = &results[len(results)-1]
+	} else {
+		for i := len(results) - 1; i >= 0; i-- {
+			if results[i].Tag == cmdInfo.RunIfTag {
+				ref = &results[i]
+				break
+			}
+		}
+		if ref == nil {
+			return false, fmt.Sprintf("no earlier command is tagged '%s'", cmdInfo.RunIfTag)
+		}
+	}
+
+	switch {
+	case ref.Skipped:
+		return false, fmt.Sprintf("[%s] did not run", ref.Tag)
+	case ref.Success && cmdInfo.RunIf == "failure":
+		return false, fmt.Sprintf("[%s] succeeded", ref.Tag)
+	case !ref.Success && cmdInfo.RunIf == "success":
+		return false, fmt.Sprintf("[%s] failed", ref.Tag)
+	}
+	return true, ""
+}
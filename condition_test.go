@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestParseCondition tests parsing of ?CONDITION modifiers
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		value     string
+		condition string
+		tag       string
+		wantErr   bool
+	}{
+		{value: "success", condition: "success"},
+		{value: "failure", condition: "failure"},
+		{value: "failure=build", condition: "failure", tag: "build"},
+		{value: "ok", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		condition, tag, err := parseCondition(tt.value)
+		if (err != nil) != tt.wantErr || condition != tt.condition || tag != tt.tag {
+			t.Errorf("parseCondition(%q) = %q, %q, %v, want %q, %q, error %v", tt.value, condition, tag, err, tt.condition, tt.tag, tt.wantErr)
+		}
+	}
+
+	cmdInfo := applyTagSpec(CommandInfo{Tag: "notify?failure=build", Command: "true"})
+	if cmdInfo.Tag != "notify" || cmdInfo.RunIf != "failure" || cmdInfo.RunIfTag != "build" {
+		t.Errorf("applyTagSpec() = %+v, want a failure condition on build", cmdInfo)
+	}
+}
+
+// TestConditionMet tests conditions on the previous and on named commands
+func TestConditionMet(t *testing.T) {
+	results := []CommandResult{
+		{Tag: "build", Success: false},
+		{Tag: "deploy", Skipped: true},
+		{Tag: "lint", Success: true},
+	}
+
+	tests := []struct {
+		cmdInfo CommandInfo
+		results []CommandResult
+		want    bool
+	}{
+		{cmdInfo: CommandInfo{}, results: nil, want: true},
+		{cmdInfo: CommandInfo{RunIf: "success"}, results: results, want: true},
+		{cmdInfo: CommandInfo{RunIf: "failure"}, results: results, want: false},
+		{cmdInfo: CommandInfo{RunIf: "failure", RunIfTag: "build"}, results: results, want: true},
+		{cmdInfo: CommandInfo{RunIf: "success", RunIfTag: "build"}, results: results, want: false},
+		{cmdInfo: CommandInfo{RunIf: "success", RunIfTag: "deploy"}, results: results, want: false},
+		{cmdInfo: CommandInfo{RunIf: "failure", RunIfTag: "deploy"}, results: results, want: false},
+		{cmdInfo: CommandInfo{RunIf: "success", RunIfTag: "missing"}, results: results, want: false},
+		{cmdInfo: CommandInfo{RunIf: "success"}, results: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got, reason := conditionMet(tt.cmdInfo, tt.results); got != tt.want {
+			t.Errorf("conditionMet(%+v) = %v (%s), want %v", tt.cmdInfo, got, reason, tt.want)
+		}
+	}
+}
+
+// TestSequentialConditions tests that conditional steps run or are skipped by the earlier results
+func TestSequentialConditions(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	tags = []string{}
+	var results []CommandResult
+	output := captureStdout(func() {
+		commands := processCommands([]string{
+			"+build:exit 1",
+			"+deploy?success:echo deploying",
+			"+rollback?failure=build:echo rolling back",
+		})
+		results = runSequential(commands)
+	})
+
+	if !results[1].Skipped || !results[1].Unmet || results[2].Skipped || !results[2].Success {
+		t.Errorf("runSequential() results = %+v, want deploy skipped and rollback run", results)
+	}
+	if strings.Contains(output, "deploying") || !strings.Contains(output, "[rollback:out] rolling back") {
+		t.Errorf("runSequential() output = %q, want only the rollback to run", output)
+	}
+	if !strings.Contains(output, "[deploy] Skipping, condition ?success not met: [build] failed") {
+		t.Errorf("runSequential() output = %q, want the skipped step reported", output)
+	}
+}
+
+// TestSequentialPreviousExit tests that each step sees how the last step that ran ended
+func TestSequentialPreviousExit(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	tags = []string{}
+	output := captureStdout(func() {
+		runSequential(processCommands([]string{
+			"+first:echo \"prev=${RUFL_PREV_EXIT-none}\"; exit 3",
+			"+deploy?success:true",
+			"+check:echo \"prev=$RUFL_PREV_TAG:$RUFL_PREV_EXIT\"",
+		}))
+	})
+
+	if !strings.Contains(output, "[first:out] prev=none") {
+		t.Errorf("runSequential() output = %q, want no previous exit code for the first step", output)
+	}
+	if !strings.Contains(output, "[check:out] prev=first:3") {
+		t.Errorf("runSequential() output = %q, want the exit code of the last step that ran", output)
+	}
+}
+
+// TestSequentialConditionsTagPrefix tests that a condition naming a tag finds
+// it with --tag-prefix and --normalize-tags
+func TestSequentialConditionsTagPrefix(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldNoColor, oldPrefix, oldNormalize := noColor, tagPrefix, normalizeTags
+	noColor, tagPrefix, normalizeTags = true, "ci/", true
+	defer func() { noColor, tagPrefix, normalizeTags = oldNoColor, oldPrefix, oldNormalize }()
+
+	tags = []string{}
+	var results []CommandResult
+	captureStdout(func() {
+		commands := processCommands([]string{
+			"+Build:exit 1",
+			"+lint:true",
+			"+rollback?failure=Build:echo rolling back",
+		})
+		results = runSequential(commands)
+	})
+
+	if len(results) != 3 || results[2].Tag != "ci/rollback" || results[2].Skipped || !results[2].Success {
+		t.Errorf("runSequential() results = %+v, want the rollback to find ci/build and run", results)
+	}
+}
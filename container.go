@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"slices"
+)
+
+// containerRuntimeFailed is the exit code docker and podman use when they
+// could not create or start the container, for example when the image could
+// not be pulled
+const containerRuntimeFailed = 125
+
+var (
+	// Image to run every local command in (--container), empty to run them directly
+	containerImage string
+	// Container runtime to use: auto (docker, else podman) or a program name
+	containerRuntime string
+	// Mount each command's working directory into its container at the same path
+	containerMountDir bool
+)
+
+// findContainerRuntime resolves --container-runtime, looking for docker and
+// then podman in PATH with auto
+func findContainerRuntime(runtime string) (string, error) {
+	if runtime != "auto" {
+		if _, err := exec.LookPath(runtime); err != nil {
+			return "", err
+		}
+		return runtime, nil
+	}
+
+	for _, candidate := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("no container runtime found, install docker or podman or set --container-runtime")
+}
+
+// containerArgs returns the arguments of the container runtime running
+// command in a throwaway container. --init makes signals sent to the
+// runtime reach the command, and -i lets stdin be forwarded to it. env holds
+// the variables rufl sets for the command, which come before the -e ones.
+func containerArgs(image string, dir string, command string, env []string) []string {
+	args := []string{"run", "--rm", "-i", "--init"}
+	if containerMountDir && dir != "" {
+		args = append(args, "-v", dir+":"+dir, "-w", dir)
+	}
+	for _, variable := range slices.Concat(env, envVars) {
+		args = append(args, "-e", variable)
+	}
+	return append(args, image, "sh", "-c", command)
+}
+
+// containerCommand creates a command running cmdInfo in a container of its
+// image, in the command's working directory
+func containerCommand(cmdInfo CommandInfo) *exec.Cmd {
+	// The runtime only mounts absolute paths
+	dir, err := filepath.Abs(commandDir(cmdInfo))
+	if err != nil {
+		dir = ""
+	}
+	return newCommand(containerRuntime, containerArgs(cmdInfo.Image, dir, cmdInfo.Command, cmdInfo.Env)...)
+}
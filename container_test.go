@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestContainerArgs tests the arguments passed to the container runtime
+func TestContainerArgs(t *testing.T) {
+	oldMount, oldEnv := containerMountDir, envVars
+	defer func() { containerMountDir, envVars = oldMount, oldEnv }()
+
+	containerMountDir, envVars = true, []string{"DEBUG=1"}
+	got := containerArgs("alpine:3.20", "/src", "make test", []string{"RUFL_PREV_EXIT=0"})
+	want := []string{"run", "--rm", "-i", "--init", "-v", "/src:/src", "-w", "/src", "-e", "RUFL_PREV_EXIT=0", "-e", "DEBUG=1", "alpine:3.20", "sh", "-c", "make test"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("containerArgs() = %q, want %q", got, want)
+	}
+
+	containerMountDir, envVars = false, nil
+	got = containerArgs("alpine:3.20", "/src", "make test", nil)
+	want = []string{"run", "--rm", "-i", "--init", "alpine:3.20", "sh", "-c", "make test"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("containerArgs() without mount = %q, want %q", got, want)
+	}
+}
+
+// TestContainerCommands tests that only local commands are run in containers
+func TestContainerCommands(t *testing.T) {
+	oldImage, oldTags := containerImage, tags
+	containerImage, tags = "alpine:3.20", []string{}
+	defer func() { containerImage, tags = oldImage, oldTags }()
+
+	var commands []CommandInfo
+	captureStdout(func() {
+		commands = processCommands([]string{"+local:make", "+remote@ssh://web1:uptime"})
+	})
+
+	if len(commands) != 2 || commands[0].Image != "alpine:3.20" || commands[1].Image != "" {
+		t.Errorf("processCommands() = %+v, want only the local command in a container", commands)
+	}
+}
+
+// TestContainerRun tests running a command through a container runtime
+func TestContainerRun(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	// A fake runtime prints its arguments up to the image and runs the command
+	dir := t.TempDir()
+	fake := "#!/bin/sh\nwhile [ \"$1\" != img ]; do printf '%s ' \"$1\"; shift; done\necho\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "fake-runtime"), []byte(fake), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	found, err := findContainerRuntime("fake-runtime")
+	if err != nil {
+		t.Fatalf("findContainerRuntime() error = %v", err)
+	}
+
+	oldRuntime, oldMount, oldNoColor, oldWorkDir := containerRuntime, containerMountDir, noColor, workDir
+	containerRuntime, containerMountDir, noColor, workDir = found, true, true, dir
+	defer func() {
+		containerRuntime, containerMountDir, noColor, workDir = oldRuntime, oldMount, oldNoColor, oldWorkDir
+	}()
+
+	var result CommandResult
+	output := captureStdout(func() {
+		result = runCommand(CommandInfo{Command: "echo inside; exit 125", Tag: "box", Image: "img"}, nil)
+	})
+
+	if result.ExitCode != containerRuntimeFailed {
+		t.Errorf("runCommand() exit code = %d, want %d", result.ExitCode, containerRuntimeFailed)
+	}
+	for _, want := range []string{
+		"[box] Executing in img: echo inside; exit 125",
+		"[box:out] run --rm -i --init -v " + dir + ":" + dir + " -w " + dir,
+		"[box:out] inside",
+		"[box] fake-runtime could not start a container of img",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("runCommand() output = %q, want %q", output, want)
+		}
+	}
+}
+
+// TestFindContainerRuntimeMissing tests that a missing runtime is reported
+func TestFindContainerRuntimeMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := findContainerRuntime("auto"); err == nil {
+		t.Error("findContainerRuntime(auto) expected an error without docker or podman")
+	}
+}
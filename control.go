@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	// Read control lines such as "k build" from stdin to stop single commands
+	controlStdin bool
+	// Tags of commands stopped with a control line, so they are not restarted
+	controlStopped sync.Map
+)
+
+// startControl reads control lines from rufl's stdin while the commands run
+func startControl() {
+	printColoredMessage("Type 'k TAG' and Enter to stop a command, 'l' to list the running ones", colorBlue)
+	go readControlLines(os.Stdin)
+}
+
+// readControlLines handles control lines until input ends:
+//
+//	k TAG   stop the running commands tagged TAG (also "kill TAG")
+//	l       list the running commands (also "list")
+//
+// The tag is the rest of the line after the command word, so it may contain
+// spaces.
+func readControlLines(input io.Reader) {
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		word, rest := line, ""
+		if i := strings.IndexFunc(line, unicode.IsSpace); i >= 0 {
+			word, rest = line[:i], strings.TrimSpace(line[i:])
+		}
+
+		switch {
+		case (word == "k" || word == "kill") && rest != "":
+			stopTaggedCommands(rest)
+		case (word == "l" || word == "list") && rest == "":
+			listActiveCommands()
+		default:
+			printColoredMessage(fmt.Sprintf("Unknown control line '%s', use 'k TAG' or 'l'", line), colorYellow)
+		}
+	}
+}
+
+// activeCommandTag returns the tag of an activeCommands key, which is the
+// tag followed by a dash and the process ID
+func activeCommandTag(key string) string {
+	if i := strings.LastIndex(key, "-"); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// stopTaggedCommands stops the active commands with the given tag, leaving
+// the others running. Stopped commands are not restarted.
+func stopTaggedCommands(tag string) {
+	var cmds []*exec.Cmd
+	activeCommands.Range(func(key, value interface{}) bool {
+		if activeCommandTag(key.(string)) == tag {
+			cmds = append(cmds, value.(*exec.Cmd))
+		}
+		return true
+	})
+
+	if len(cmds) == 0 {
+		printColoredMessage(fmt.Sprintf("No running command tagged '%s'", tag), colorYellow)
+		return
+	}
+
+	controlStopped.Store(tag, true)
+	printCommandMessage(tag, "Stopping on request", colorYellow)
+	for _, cmd := range cmds {
+		terminateCommand(cmd)
+	}
+}
+
+// wasStopped reports whether the command with the given tag was stopped
+// with a control line
+func wasStopped(tag string) bool {
+	_, ok := controlStopped.Load(tag)
+	return ok
+}
+
+// resetStoppedCommands forgets the commands stopped with a control line, so
+// a stop only prevents restarts within the run it was given in
+func resetStoppedCommands() {
+	controlStopped.Clear()
+}
+
+// listActiveCommands prints the tags of the running commands
+func listActiveCommands() {
+	var tags []string
+	activeCommands.Range(func(key, value interface{}) bool {
+		tags = append(tags, activeCommandTag(key.(string)))
+		return true
+	})
+
+	if len(tags) == 0 {
+		printColoredMessage("No commands running", colorBlue)
+		return
+	}
+	sort.Strings(tags)
+	printColoredMessage("Running: "+strings.Join(tags, ", "), colorBlue)
+}
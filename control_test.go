@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestActiveCommandTag tests taking the tag from an activeCommands key
+func TestActiveCommandTag(t *testing.T) {
+	for key, want := range map[string]string{"build-4242": "build", "web-api-17": "web-api", "x": "x"} {
+		if got := activeCommandTag(key); got != want {
+			t.Errorf("activeCommandTag(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// TestControlLines tests messages for control lines that do not stop anything
+func TestControlLines(t *testing.T) {
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	output := captureStdout(func() {
+		readControlLines(strings.NewReader("k missing\n\nl\nhello world\nkill  Build Step \nl all\n"))
+	})
+
+	for _, want := range []string{"No running command tagged 'missing'", "No commands running", "Unknown control line 'hello world'",
+		"No running command tagged 'Build Step'", "Unknown control line 'l all'"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("readControlLines() output = %q, want %q", output, want)
+		}
+	}
+}
+
+// TestControlStop tests that a command stopped by tag is not restarted while the others keep running
+func TestControlStop(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldPolicy, oldDelay, oldMax, oldNoColor := restartPolicy, restartDelay, maxRestarts, noColor
+	restartPolicy, restartDelay, maxRestarts, noColor = "always", time.Millisecond, 2, true
+	defer func() {
+		restartPolicy, restartDelay, maxRestarts, noColor = oldPolicy, oldDelay, oldMax, oldNoColor
+		controlStopped.Delete("stuck")
+	}()
+
+	var stuck, other CommandResult
+	output := captureStdout(func() {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			stuck = executeCommand(CommandInfo{Command: "sleep 10", Tag: "stuck"})
+		}()
+		go func() {
+			defer wg.Done()
+			other = executeCommand(CommandInfo{Command: "sleep 0.2", Tag: "other"})
+		}()
+
+		for deadline := time.Now().Add(2 * time.Second); countActiveCommands() < 2 && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+		stopTaggedCommands("stuck")
+		wg.Wait()
+	})
+
+	if stuck.Success || stuck.Restarts != 0 {
+		t.Errorf("stopped command result = %+v, want a failure without restarts", stuck)
+	}
+	if other.Restarts != 2 || !strings.Contains(output, "[stuck] Stopping on request") {
+		t.Errorf("other command result = %+v with output %q, want it to keep running and restarting", other, output)
+	}
+}
+
+// TestControlStopResetPerRun tests that a stop given in one run does not keep
+// the command from restarting in the next run
+func TestControlStopResetPerRun(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() {
+		noColor = oldNoColor
+		controlStopped.Delete("build")
+	}()
+
+	controlStopped.Store("build", true)
+	captureStdout(func() {
+		runCommands([]CommandInfo{{Command: "true", Tag: "build"}}, false)
+	})
+
+	if wasStopped("build") {
+		t.Error("wasStopped() = true after a new run, want the stop forgotten")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Number of copies of each command to run, 0 to run each command once
+var commandCount int
+
+// expandCount replaces every command with count copies, with {i} in the
+// command replaced by the copy's index (0 to count-1) and {n} by count.
+// Copies of commands the user tagged keep their tag. The others are tagged
+// after their program, so "worker --id {i}" becomes worker-0, worker-1 and
+// so on, numbered on from earlier commands running the same program.
+func expandCount(commands []CommandInfo, count int) []CommandInfo {
+	used := make(map[string]bool)
+	for _, cmdInfo := range commands {
+		used[cmdInfo.Tag] = true
+	}
+	next := make(map[string]int)
+
+	var expanded []CommandInfo
+	for _, cmdInfo := range commands {
+		// Only commands with a numbered default tag get a tag of their own
+		_, err := strconv.Atoi(cmdInfo.Tag)
+		generated := err == nil
+		program := programName(cmdInfo.Command, cmdInfo.Tag)
+
+		for i := 0; i < count; i++ {
+			cmdCopy := cmdInfo
+			cmdCopy.Command = strings.NewReplacer("{i}", strconv.Itoa(i), "{n}", strconv.Itoa(count)).Replace(cmdInfo.Command)
+			if generated {
+				cmdCopy.Tag = nextCopyTag(program, next, used)
+			}
+			cmdCopy.Index = len(expanded)
+			expanded = append(expanded, cmdCopy)
+		}
+	}
+	return expanded
+}
+
+// nextCopyTag returns the first PROGRAM-N tag that is not in use yet,
+// counting on from the last one given out for the program
+func nextCopyTag(program string, next map[string]int, used map[string]bool) string {
+	for {
+		tag := program + "-" + strconv.Itoa(next[program])
+		next[program]++
+		if !used[tag] {
+			used[tag] = true
+			return tag
+		}
+	}
+}
+
+// programName returns the base name of the program a command runs, or
+// fallback when the command is empty
+func programName(command string, fallback string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return fallback
+	}
+	return filepath.Base(fields[0])
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestExpandCount tests fanning out commands with --count
+func TestExpandCount(t *testing.T) {
+	commands := []CommandInfo{
+		{Command: "./bin/worker --id {i} --of {n}", Tag: "1", Index: 0},
+		{Command: "curl -s localhost", Tag: "load", Index: 1, Priority: 2},
+		{Command: "worker --slow {i}", Tag: "3", Index: 2},
+		{Command: "sleep {i}", Tag: "sleep-1", Index: 3},
+		{Command: "sleep {i}", Tag: "5", Index: 4},
+	}
+
+	got := expandCount(commands, 2)
+	want := []CommandInfo{
+		{Command: "./bin/worker --id 0 --of 2", Tag: "worker-0", Index: 0},
+		{Command: "./bin/worker --id 1 --of 2", Tag: "worker-1", Index: 1},
+		{Command: "curl -s localhost", Tag: "load", Index: 2, Priority: 2},
+		{Command: "curl -s localhost", Tag: "load", Index: 3, Priority: 2},
+		{Command: "worker --slow 0", Tag: "worker-2", Index: 4},
+		{Command: "worker --slow 1", Tag: "worker-3", Index: 5},
+		{Command: "sleep 0", Tag: "sleep-1", Index: 6},
+		{Command: "sleep 1", Tag: "sleep-1", Index: 7},
+		{Command: "sleep 0", Tag: "sleep-0", Index: 8},
+		{Command: "sleep 1", Tag: "sleep-2", Index: 9},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandCount() = %v, want %v", got, want)
+	}
+}
+
+// TestProcessCommandsCount tests that --count applies after tags are parsed
+func TestProcessCommandsCount(t *testing.T) {
+	oldCount := commandCount
+	defer func() { commandCount = oldCount }()
+
+	tags = []string{}
+	commandCount = 3
+
+	got := processCommands([]string{"+shard!1:go test -shard {i}/{n}"})
+	want := []CommandInfo{
+		{Command: "go test -shard 0/3", Tag: "shard", Index: 0, Priority: 1},
+		{Command: "go test -shard 1/3", Tag: "shard", Index: 1, Priority: 1},
+		{Command: "go test -shard 2/3", Tag: "shard", Index: 2, Priority: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with --count = %v, want %v", got, want)
+	}
+}
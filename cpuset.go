@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// Raw value of the --cpuset flag
+	cpuSetFlag string
+	// CPUs commands are pinned to, empty when not pinned
+	cpuSet []int
+)
+
+// parseCPUList parses a CPU list such as "0-3,6,8-9" into CPU numbers
+func parseCPUList(value string) ([]int, error) {
+	var cpus []int
+	seen := make(map[int]bool)
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("invalid CPU list '%s'", value)
+		}
+
+		first, last := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid CPU '%s' in list '%s'", first, value)
+		}
+		end, err := strconv.Atoi(last)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid CPU range '%s' in list '%s'", part, value)
+		}
+
+		for cpu := start; cpu <= end; cpu++ {
+			if !seen[cpu] {
+				seen[cpu] = true
+				cpus = append(cpus, cpu)
+			}
+		}
+	}
+
+	return cpus, nil
+}
@@ -0,0 +1,22 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// cpuSetSupported indicates if commands can be pinned to CPUs
+const cpuSetSupported = true
+
+// applyCPUSet pins the process to the given CPUs. Threads and children the
+// process creates afterwards inherit the affinity.
+func applyCPUSet(pid int, cpus []int) error {
+	var set unix.CPUSet
+	set.Zero()
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	return unix.SchedSetaffinity(pid, &set)
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// cpuSetSupported indicates if commands can be pinned to CPUs
+const cpuSetSupported = false
+
+// applyCPUSet is only supported on Linux
+func applyCPUSet(pid int, cpus []int) error {
+	return errors.New("CPU affinity is only supported on Linux")
+}
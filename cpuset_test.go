@@ -0,0 +1,37 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestParseCPUList tests parsing of CPU lists
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []int
+		wantErr bool
+	}{
+		{value: "0", want: []int{0}},
+		{value: "0-3", want: []int{0, 1, 2, 3}},
+		{value: "0-1,4,6-7", want: []int{0, 1, 4, 6, 7}},
+		{value: "2, 2-3", want: []int{2, 3}},
+		{value: "", wantErr: true},
+		{value: "3-1", wantErr: true},
+		{value: "a-b", wantErr: true},
+		{value: "1,,2", wantErr: true},
+		{value: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseCPUList(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseCPUList(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCPUList(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
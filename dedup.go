@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+// Number of consecutive identical lines printed before further copies are
+// collapsed into a single line (--dedup), 0 to print every line
+var dedupThreshold int
+
+// lineDeduper collapses runs of identical lines of a single output stream
+type lineDeduper struct {
+	threshold int
+	last      string
+	count     int
+}
+
+// add returns the lines to print for the next line of output. The first
+// threshold copies of a line are printed, further copies are counted until a
+// different line appears.
+func (d *lineDeduper) add(line string) []string {
+	if d.threshold <= 0 {
+		return []string{line}
+	}
+
+	if d.count > 0 && line == d.last {
+		d.count++
+		if d.count <= d.threshold {
+			return []string{line}
+		}
+		return nil
+	}
+
+	lines := d.flush()
+	d.last, d.count = line, 1
+	return append(lines, line)
+}
+
+// flush returns the line summarizing the copies of the last line that were
+// not printed, if any, and starts over
+func (d *lineDeduper) flush() []string {
+	repeats := d.count - d.threshold
+	d.count = 0
+
+	switch {
+	case repeats <= 0:
+		return nil
+	case repeats == 1:
+		// A summary would be no shorter than the line itself
+		return []string{d.last}
+	default:
+		return []string{fmt.Sprintf("%s (repeated %d times)", d.last, repeats)}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLineDeduper tests collapsing runs of identical lines
+func TestLineDeduper(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		input     []string
+		want      []string
+	}{
+		{"disabled", 0, []string{"a", "a", "a"}, []string{"a", "a", "a"}},
+		{"collapsed", 1, []string{"a", "a", "a", "a", "b"}, []string{"a", "a (repeated 3 times)", "b"}},
+		{"single repeat", 1, []string{"a", "a", "b"}, []string{"a", "a", "b"}},
+		{"threshold", 2, []string{"a", "a", "a", "a", "b", "b"}, []string{"a", "a", "a (repeated 2 times)", "b", "b"}},
+		{"repeat at end", 1, []string{"b", "a", "a", "a"}, []string{"b", "a", "a (repeated 2 times)"}},
+		{"run starts over", 1, []string{"a", "a", "a", "b", "a", "a", "a"}, []string{"a", "a (repeated 2 times)", "b", "a", "a (repeated 2 times)"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &lineDeduper{threshold: tt.threshold}
+			var got []string
+			for _, line := range tt.input {
+				got = append(got, d.add(line)...)
+			}
+			got = append(got, d.flush()...)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lines = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDedupOutput tests that repeated output lines are collapsed with the command prefix
+func TestDedupOutput(t *testing.T) {
+	oldThreshold, oldNoColor := dedupThreshold, noColor
+	dedupThreshold, noColor = 1, true
+	defer func() { dedupThreshold, noColor = oldThreshold, oldNoColor }()
+
+	output := captureStdout(func() {
+		processCommandOutput(strings.NewReader("retrying\nretrying\nretrying\nconnected\n"), "db", "out", colorGreen, time.Now(), nil)
+	})
+
+	want := "[db:out] retrying\n[db:out] retrying (repeated 2 times)\n[db:out] connected\n"
+	if output != want {
+		t.Errorf("processCommandOutput() with --dedup = %q, want %q", output, want)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// Start delays of tags as TAG=DURATION (--delay-tag)
+	delayTagFlags []string
+	// Start delays parsed from --delay-tag by tag
+	tagDelays map[string]time.Duration
+)
+
+// parseTagDelays parses TAG=DURATION values into a map of tag names to delays
+func parseTagDelays(values []string) (map[string]time.Duration, error) {
+	delays := make(map[string]time.Duration)
+	for _, value := range values {
+		tag, duration, ok := strings.Cut(value, "=")
+		if !ok || tag == "" {
+			return nil, fmt.Errorf("invalid tag delay '%s', expected 'TAG=DURATION'", value)
+		}
+
+		delay, err := parseDelay(duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay '%s' for tag '%s', %v", duration, tag, err)
+		}
+		delays[finalTag(tag)] = delay
+	}
+	return delays, nil
+}
+
+// parseDelay parses a start delay such as 2s or 500ms
+func parseDelay(value string) (time.Duration, error) {
+	delay, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration such as 2s")
+	}
+	if delay < 0 {
+		return 0, fmt.Errorf("expected a duration that is not negative")
+	}
+	return delay, nil
+}
+
+// tagSettingKeys are the settings an @ modifier can set
+var tagSettingKeys = []string{"delay", "weight", "encoding", "timeout", "dir"}
+
+// isTagSetting reports whether text starts with the key of a setting and =
+func isTagSetting(text string) bool {
+	key, _, ok := strings.Cut(text, "=")
+	return ok && slices.Contains(tagSettingKeys, key)
+}
+
+// applyTagSetting applies the value of an @ modifier, such as delay=2s,
+// weight=4, encoding=cp1252, timeout=5m or dir=web, to a command
+func applyTagSetting(cmdInfo *CommandInfo, value string) error {
+	key, setting, _ := strings.Cut(value, "=")
+	switch key {
+	case "delay":
+		delay, err := parseDelay(setting)
+		if err != nil {
+			return err
+		}
+		cmdInfo.Delay = delay
+	case "weight":
+		weight, err := parseWeight(setting)
+		if err != nil {
+			return err
+		}
+		cmdInfo.Weight = weight
+	case "encoding":
+		if _, err := lookupEncoding(setting); err != nil {
+			return err
+		}
+		cmdInfo.Encoding = setting
+	case "timeout":
+		timeout, err := parseTimeout(setting)
+		if err != nil {
+			return err
+		}
+		cmdInfo.Timeout = timeout
+	case "dir":
+		if setting == "" {
+			return fmt.Errorf("expected a directory")
+		}
+		cmdInfo.Dir = setting
+	default:
+		return fmt.Errorf("expected delay=DURATION, weight=N, encoding=NAME, timeout=DURATION or dir=PATH")
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// TestParseTagDelays tests parsing --delay-tag values
+func TestParseTagDelays(t *testing.T) {
+	got, err := parseTagDelays([]string{"web=3s", "db=500ms"})
+	if err != nil {
+		t.Fatalf("parseTagDelays() error = %v", err)
+	}
+	if want := map[string]time.Duration{"web": 3 * time.Second, "db": 500 * time.Millisecond}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTagDelays() = %v, want %v", got, want)
+	}
+
+	for _, invalid := range []string{"web", "=3s", "web=soon", "web=-1s"} {
+		if _, err := parseTagDelays([]string{invalid}); err == nil {
+			t.Errorf("parseTagDelays(%q) expected an error", invalid)
+		}
+	}
+}
+
+// TestDelayTagSpec tests setting a start delay with an @ modifier
+func TestDelayTagSpec(t *testing.T) {
+	cmdInfo := applyTagSpec(CommandInfo{Tag: "web@delay=2s!1", Command: "true"})
+	if cmdInfo.Tag != "web" || cmdInfo.Delay != 2*time.Second || cmdInfo.Priority != 1 {
+		t.Errorf("applyTagSpec() = %+v, want web with a 2s delay and priority 1", cmdInfo)
+	}
+
+	parseWarnings = nil
+	defer func() { parseWarnings = nil }()
+	cmdInfo = applyTagSpec(CommandInfo{Tag: "web@delay=soon", Command: "true"})
+	if cmdInfo.Tag != "web" || cmdInfo.Delay != 0 || len(parseWarnings) != 1 {
+		t.Errorf("applyTagSpec() = %+v with warnings %q, want an invalid setting warning", cmdInfo, parseWarnings)
+	}
+
+	// Only known settings start a modifier, other text after @ stays in the tag
+	parseWarnings = nil
+	cmdInfo = applyTagSpec(CommandInfo{Tag: "web@wait=2s", Command: "true"})
+	if cmdInfo.Tag != "web@wait=2s" || cmdInfo.Delay != 0 || len(parseWarnings) != 0 {
+		t.Errorf("applyTagSpec() = %+v with warnings %q, want the tag kept as it is", cmdInfo, parseWarnings)
+	}
+}
+
+// TestTimeoutTagSpec tests setting a command's timeout with an @ modifier
+func TestTimeoutTagSpec(t *testing.T) {
+	cmdInfo := applyTagSpec(CommandInfo{Tag: "build@timeout=5m", Command: "make"})
+	if cmdInfo.Tag != "build" || cmdInfo.Timeout != 5*time.Minute {
+		t.Errorf("applyTagSpec() = %+v, want build with a 5m timeout", cmdInfo)
+	}
+
+	parseWarnings = nil
+	defer func() { parseWarnings = nil }()
+	for _, invalid := range []string{"timeout=soon", "timeout=0s", "timeout=-1m"} {
+		cmdInfo = applyTagSpec(CommandInfo{Tag: "build@" + invalid, Command: "make"})
+		if cmdInfo.Timeout != 0 {
+			t.Errorf("applyTagSpec(%q) timeout = %v, want none", invalid, cmdInfo.Timeout)
+		}
+	}
+	if len(parseWarnings) != 3 {
+		t.Errorf("applyTagSpec() warnings = %q, want one per invalid timeout", parseWarnings)
+	}
+}
+
+// TestRunParallelDelay tests that a delayed command does not hold up the commands after it
+func TestRunParallelDelay(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	commands := []CommandInfo{
+		{Command: "echo app", Tag: "app", Index: 0, Delay: 200 * time.Millisecond},
+		{Command: "echo db", Tag: "db", Index: 1},
+	}
+
+	var results []CommandResult
+	started := time.Now()
+	output := captureStdout(func() {
+		results = runParallel(commands)
+	})
+
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Errorf("runParallel() took %v, want the app to wait 200ms", elapsed)
+	}
+	if !results[0].Success || !results[1].Success {
+		t.Errorf("runParallel() results = %+v, want both to succeed", results)
+	}
+
+	var launches []string
+	for _, match := range regexp.MustCompile(`\[(\w+)\] Executing`).FindAllStringSubmatch(output, -1) {
+		launches = append(launches, match[1])
+	}
+	if want := []string{"db", "app"}; !reflect.DeepEqual(launches, want) {
+		t.Errorf("launch order = %v, want %v", launches, want)
+	}
+	if !regexp.MustCompile(`\[app\] Starting in 200ms`).MatchString(output) {
+		t.Errorf("runParallel() output = %q, want the delay to be announced", output)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// Tags of commands to run detached (--detach)
+	detachTags []string
+	// Wait for detached commands at the end of the run instead of stopping them
+	waitDetached bool
+	// Detached commands that have not finished yet
+	detachedWg sync.WaitGroup
+	// Number of detached commands that have not finished yet
+	detachedRunning atomic.Int32
+	// Set while detached commands are being stopped, so they are not restarted
+	stoppingDetached atomic.Bool
+)
+
+// detachCommand starts a command in the background and returns as soon as
+// it has been launched, without waiting for it to finish. The result only
+// tells that the command was detached; it ends up in the output as usual.
+func detachCommand(cmdInfo CommandInfo, launched func()) CommandResult {
+	started := make(chan struct{})
+	detachedWg.Add(1)
+	detachedRunning.Add(1)
+	go func() {
+		defer detachedWg.Done()
+		defer detachedRunning.Add(-1)
+		executeCommandNotify(cmdInfo, func() { close(started) })
+	}()
+
+	<-started
+	if launched != nil {
+		launched()
+	}
+	return CommandResult{Tag: cmdInfo.Tag, Command: cmdInfo.Command, Success: true, Detached: true}
+}
+
+// startCommand runs a command to completion, or detaches it
+func startCommand(cmdInfo CommandInfo, launched func()) CommandResult {
+	if cmdInfo.Detach {
+		return detachCommand(cmdInfo, launched)
+	}
+	return executeCommandNotify(cmdInfo, launched)
+}
+
+// finishDetached deals with detached commands still running once all other
+// commands are done: it waits for them with --wait-detached and otherwise
+// stops them, killing those still running after --halt-timeout
+func finishDetached() {
+	running := int(detachedRunning.Load())
+	if running == 0 {
+		return
+	}
+
+	if waitDetached {
+		printColoredMessage(fmt.Sprintf("Waiting for %s running detached", formatCommandCount(running)), colorBlue)
+		detachedWg.Wait()
+		return
+	}
+
+	printColoredMessage(fmt.Sprintf("Stopping %s running detached", formatCommandCount(running)), colorYellow)
+	stoppingDetached.Store(true)
+	defer stoppingDetached.Store(false)
+
+	// Only detached commands are left at this point
+	terminateActiveCommands()
+	if !waitForCommands(haltTimeout) {
+		printColoredMessage(fmt.Sprintf("Detached commands still running after %v, killing them", haltTimeout), colorRed)
+		killActiveCommands()
+	}
+	detachedWg.Wait()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDetachedCommandIsStopped tests that the run does not wait for a detached
+// command and stops it once the other commands are done
+func TestDetachedCommandIsStopped(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldNoColor := noColor
+	oldNoBanner := noBanner
+	noColor = true
+	noBanner = false
+	defer func() {
+		noColor = oldNoColor
+		noBanner = oldNoBanner
+	}()
+
+	tags = []string{}
+	commands := processCommands([]string{"+server&:sleep 10", "+test:echo testing"})
+	if !commands[0].Detach || commands[1].Detach {
+		t.Fatalf("processCommands() = %v, want only the server detached", commands)
+	}
+
+	start := time.Now()
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runCommands(commands, false)
+	})
+
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("runCommands() took %v, want it not to wait for the detached command", elapsed)
+	}
+	if len(results) != 2 || !results[0].Detached || !results[1].Success {
+		t.Errorf("runCommands() = %+v, want a detached server and a successful test", results)
+	}
+	for _, want := range []string{"[server] Detached (pid ", "[test:out] testing", "Stopping 1 command running detached", "1 succeeded, 0 failed, 1 detached"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("runCommands() output = %q, want it to contain %q", output, want)
+		}
+	}
+	if countActiveCommands() != 0 {
+		t.Error("the detached command is still running after the run")
+	}
+}
+
+// TestWaitDetached tests that --wait-detached lets detached commands finish
+func TestWaitDetached(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldNoColor := noColor
+	oldNoBanner := noBanner
+	oldWait := waitDetached
+	oldDetachTags := detachTags
+	noColor = true
+	noBanner = true
+	waitDetached = true
+	detachTags = []string{"bg"}
+	defer func() {
+		noColor = oldNoColor
+		noBanner = oldNoBanner
+		waitDetached = oldWait
+		detachTags = oldDetachTags
+	}()
+
+	tags = []string{}
+	commands := processCommands([]string{"+bg:sleep 0.2; echo background done", "+fg:echo foreground"})
+	output := captureStdout(func() {
+		runCommands(commands, true)
+	})
+
+	if !strings.Contains(output, "Waiting for 1 command running detached") || !strings.Contains(output, "[bg:out] background done") {
+		t.Errorf("runCommands() output = %q, want the detached command to finish", output)
+	}
+}
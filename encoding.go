@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// Character encoding of command output, decoded to UTF-8 before it is
+// printed (--input-encoding)
+var inputEncoding string
+
+// lookupEncoding returns the encoding with a name such as cp1252, shift_jis
+// or ibm437, or nil for UTF-8, which is passed through as it is
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ToLower(name) {
+	case "", "utf-8", "utf8":
+		return nil, nil
+	}
+
+	// Browser names cover most legacy encodings, IANA names the DOS code pages
+	if enc, err := htmlindex.Get(name); err == nil {
+		if canonical, _ := htmlindex.Name(enc); canonical == "utf-8" {
+			return nil, nil
+		}
+		return enc, nil
+	}
+	if enc, err := ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	return nil, fmt.Errorf("unknown encoding '%s'", name)
+}
+
+// decodeOutput returns a reader that decodes the output of a command from
+// its own encoding, or --input-encoding, to UTF-8
+func decodeOutput(reader io.Reader, cmdInfo CommandInfo) io.Reader {
+	name := cmdInfo.Encoding
+	if name == "" {
+		name = inputEncoding
+	}
+
+	// Encodings are checked when options and tags are parsed
+	enc, err := lookupEncoding(name)
+	if err != nil || enc == nil {
+		return reader
+	}
+	return transform.NewReader(reader, enc.NewDecoder())
+}
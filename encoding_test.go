@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestLookupEncoding tests looking up encodings by their common names
+func TestLookupEncoding(t *testing.T) {
+	for _, name := range []string{"cp1252", "windows-1252", "Shift_JIS", "latin1", "ibm437"} {
+		if enc, err := lookupEncoding(name); err != nil || enc == nil {
+			t.Errorf("lookupEncoding(%q) = %v, %v, want an encoding", name, enc, err)
+		}
+	}
+	for _, name := range []string{"", "utf-8", "UTF8", "unicode-1-1-utf-8"} {
+		if enc, err := lookupEncoding(name); err != nil || enc != nil {
+			t.Errorf("lookupEncoding(%q) = %v, %v, want UTF-8 passed through", name, enc, err)
+		}
+	}
+	if _, err := lookupEncoding("klingon"); err == nil {
+		t.Error("lookupEncoding(\"klingon\") expected an error")
+	}
+}
+
+// TestDecodeOutput tests decoding output with --input-encoding and per-command encodings
+func TestDecodeOutput(t *testing.T) {
+	oldInputEncoding := inputEncoding
+	defer func() { inputEncoding = oldInputEncoding }()
+
+	decode := func(input string, cmdInfo CommandInfo) string {
+		data, err := io.ReadAll(decodeOutput(strings.NewReader(input), cmdInfo))
+		if err != nil {
+			t.Fatalf("decodeOutput() error = %v", err)
+		}
+		return string(data)
+	}
+
+	inputEncoding = "utf-8"
+	if got := decode("caf\xe9\n", CommandInfo{}); got != "caf\xe9\n" {
+		t.Errorf("decodeOutput() with utf-8 = %q, want the bytes passed through", got)
+	}
+
+	inputEncoding = "cp1252"
+	if got := decode("caf\xe9 \x80\n", CommandInfo{}); got != "café €\n" {
+		t.Errorf("decodeOutput() with cp1252 = %q, want %q", got, "café €\n")
+	}
+	if got := decode("\x83e\x83X\x83g\n", CommandInfo{Encoding: "shift_jis"}); got != "テスト\n" {
+		t.Errorf("decodeOutput() with a shift_jis command = %q, want %q", got, "テスト\n")
+	}
+
+	cmdInfo := applyTagSpec(CommandInfo{Tag: "legacy@encoding=cp1252", Command: "tool.exe"})
+	if cmdInfo.Tag != "legacy" || cmdInfo.Encoding != "cp1252" {
+		t.Errorf("applyTagSpec() = %+v, want legacy with the cp1252 encoding", cmdInfo)
+	}
+}
+
+// TestRunCommandEncoding tests that the output of a command is decoded before it is printed
+func TestRunCommandEncoding(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	output := captureStdout(func() {
+		runCommand(CommandInfo{Command: `printf 'caf\351\n'`, Tag: "legacy", Encoding: "latin1"}, nil)
+	})
+	if !strings.Contains(output, "[legacy:out] café\n") {
+		t.Errorf("runCommand() output = %q, want the latin1 output decoded", output)
+	}
+}
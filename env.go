@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+var (
+	// Start commands with an empty environment instead of rufl's own
+	noInheritEnv bool
+	// Glob patterns of variable names to inherit, e.g. "GO*,HOME,PATH"
+	inheritPatterns []string
+)
+
+// inheritedEnv returns the part of rufl's environment passed on to commands.
+// Everything is inherited by default; --no-inherit-env starts empty and
+// --inherit keeps only the variables whose names match one of its patterns.
+func inheritedEnv() []string {
+	if !noInheritEnv && len(inheritPatterns) == 0 {
+		return os.Environ()
+	}
+
+	var env []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if matchesInherit(name) {
+			env = append(env, entry)
+		}
+	}
+	return env
+}
+
+// matchesInherit reports whether a variable name matches an --inherit pattern.
+// Each flag value may hold several comma-separated patterns.
+func matchesInherit(name string) bool {
+	for _, value := range inheritPatterns {
+		for _, pattern := range strings.Split(value, ",") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestInheritedEnv tests filtering the inherited environment with --no-inherit-env and --inherit
+func TestInheritedEnv(t *testing.T) {
+	oldNoInherit := noInheritEnv
+	oldPatterns := inheritPatterns
+	defer func() {
+		noInheritEnv = oldNoInherit
+		inheritPatterns = oldPatterns
+	}()
+
+	t.Setenv("RUFL_TEST_GOPATH", "/go")
+	t.Setenv("RUFL_TEST_GOOS", "linux")
+	t.Setenv("RUFL_TEST_HOME", "/home/me")
+
+	filtered := func() []string {
+		var got []string
+		for _, entry := range inheritedEnv() {
+			if strings.HasPrefix(entry, "RUFL_TEST_") {
+				got = append(got, entry)
+			}
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	noInheritEnv = false
+	inheritPatterns = nil
+	if got := filtered(); len(got) != 3 {
+		t.Errorf("inheritedEnv() by default = %v, want all variables", got)
+	}
+
+	noInheritEnv = true
+	if got := filtered(); len(got) != 0 {
+		t.Errorf("inheritedEnv() with --no-inherit-env = %v, want none", got)
+	}
+
+	inheritPatterns = []string{"RUFL_TEST_GO*, PATH", "RUFL_TEST_HOME"}
+	want := []string{"RUFL_TEST_GOOS=linux", "RUFL_TEST_GOPATH=/go", "RUFL_TEST_HOME=/home/me"}
+	if got := filtered(); !reflect.DeepEqual(got, want) {
+		t.Errorf("inheritedEnv() with --inherit = %v, want %v", got, want)
+	}
+
+	noInheritEnv = false
+	inheritPatterns = []string{"RUFL_TEST_GO*"}
+	want = []string{"RUFL_TEST_GOOS=linux", "RUFL_TEST_GOPATH=/go"}
+	if got := filtered(); !reflect.DeepEqual(got, want) {
+		t.Errorf("inheritedEnv() with --inherit alone = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	// File descriptor to write lifecycle events to, 0 disables it
+	eventsFD int
+	// Unix socket to write lifecycle events to
+	eventsSocket string
+	// Destination of lifecycle events, nil when events are disabled
+	eventsWriter io.Writer
+	// Mutex serializing writes to eventsWriter
+	eventsMutex sync.Mutex
+)
+
+// Event is a machine-readable lifecycle event, written as one JSON object per line
+type Event struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Tag      string    `json:"tag"`
+	Command  string    `json:"command,omitempty"`
+	PID      int       `json:"pid,omitempty"`
+	Stream   string    `json:"stream,omitempty"`
+	Line     string    `json:"line,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Duration float64   `json:"duration_seconds,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// setupEvents opens the events destination selected with --events-fd or --events-socket
+func setupEvents() error {
+	switch {
+	case eventsFD > 0 && eventsSocket != "":
+		return fmt.Errorf("--events-fd and --events-socket cannot be used together")
+	case eventsFD > 0:
+		eventsWriter = os.NewFile(uintptr(eventsFD), "events")
+	case eventsSocket != "":
+		conn, err := net.Dial("unix", eventsSocket)
+		if err != nil {
+			return fmt.Errorf("connecting to events socket: %w", err)
+		}
+		eventsWriter = conn
+	}
+	return nil
+}
+
+// emitEvent writes an event to the events stream if one is configured, its
+// progress line to --progress-fd, updates the --metrics-file and runs the
+// event's hooks
+func emitEvent(event Event) {
+	emitProgress(event)
+	recordMetrics(event)
+	dispatchHooks(event)
+
+	if eventsWriter == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	// A broken events consumer must not affect the commands being run
+	_, _ = eventsWriter.Write(append(data, '\n'))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// Expected output of tags as TAG=REGEX (--expect)
+	expectFlags []string
+	// Patterns parsed from --expect by tag
+	outputExpectations map[string][]*regexp.Regexp
+)
+
+// expectRun tracks which expected patterns a run of a command has printed
+type expectRun struct {
+	mutex    sync.Mutex
+	patterns []*regexp.Regexp
+	matched  []bool
+}
+
+// parseExpectations parses TAG=REGEX values into a map of tags to the
+// patterns their output must match, keyed by the final tags
+func parseExpectations(values []string) (map[string][]*regexp.Regexp, error) {
+	parsed := make(map[string][]*regexp.Regexp)
+	for _, value := range values {
+		tag, expr, ok := strings.Cut(value, "=")
+		if !ok || tag == "" || expr == "" {
+			return nil, fmt.Errorf("invalid expectation '%s', expected 'TAG=REGEX'", value)
+		}
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expectation for tag '%s': %w", tag, err)
+		}
+		tag = finalTag(tag)
+		parsed[tag] = append(parsed[tag], pattern)
+	}
+	return parsed, nil
+}
+
+// startExpectations starts checking the output of a run of a command
+// against its expected patterns. It returns nil if the tag has none.
+func startExpectations(tag string) *expectRun {
+	patterns := outputExpectations[tag]
+	if len(patterns) == 0 {
+		return nil
+	}
+	return &expectRun{patterns: patterns, matched: make([]bool, len(patterns))}
+}
+
+// check checks a line of the run's output, stdout or stderr, against the
+// patterns it has not printed yet. It does nothing on a nil run.
+func (r *expectRun) check(line string) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, pattern := range r.patterns {
+		if !r.matched[i] && pattern.MatchString(line) {
+			r.matched[i] = true
+		}
+	}
+}
+
+// finish returns the patterns no line of the run's output matched
+func (r *expectRun) finish() []string {
+	if r == nil {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var unmet []string
+	for i, pattern := range r.patterns {
+		if !r.matched[i] {
+			unmet = append(unmet, pattern.String())
+		}
+	}
+	return unmet
+}
+
+// exitOnFailedExpectations makes rufl exit with status 1 if any command did
+// not print what --expect requires, so a run can serve as a test step
+func exitOnFailedExpectations(results []CommandResult) {
+	if slices.ContainsFunc(results, func(result CommandResult) bool { return result.MissingOutput }) {
+		exitRufl(1)
+	}
+}
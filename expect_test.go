@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestParseExpectations tests parsing --expect values
+func TestParseExpectations(t *testing.T) {
+	got, err := parseExpectations([]string{`test=^ok\s`, "test=PASS", "lint=a=b"})
+	if err != nil {
+		t.Fatalf("parseExpectations() error = %v", err)
+	}
+	if len(got["test"]) != 2 || got["test"][1].String() != "PASS" || got["lint"][0].String() != "a=b" {
+		t.Errorf("parseExpectations() = %v, want two patterns for test and a=b for lint", got)
+	}
+
+	for _, invalid := range []string{"test", "=ok", "test=", "test=(ok"} {
+		if _, err := parseExpectations([]string{invalid}); err == nil {
+			t.Errorf("parseExpectations(%q) expected an error", invalid)
+		}
+	}
+}
+
+// TestRunCommandExpect tests that a command fails unless its output has every expected match
+func TestRunCommandExpect(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	oldExpectations, oldNoColor := outputExpectations, noColor
+	defer func() { outputExpectations, noColor = oldExpectations, oldNoColor }()
+	noColor = true
+
+	var err error
+	outputExpectations, err = parseExpectations([]string{`version=^v\d+\.\d+`, "version=warnings: 0"})
+	if err != nil {
+		t.Fatalf("parseExpectations() error = %v", err)
+	}
+
+	// Expected lines may come from stdout or stderr
+	var result CommandResult
+	output := captureStdout(func() {
+		result = runCommand(CommandInfo{Command: "echo v1.2.3; echo 'warnings: 0' >&2", Tag: "version"}, nil)
+	})
+	if !result.Success {
+		t.Errorf("runCommand() = %+v, want success, output = %q", result, output)
+	}
+
+	output = captureStdout(func() {
+		result = runCommand(CommandInfo{Command: "echo v1.2.3; echo 'warnings: 2'", Tag: "version"}, nil)
+	})
+	if result.Success || result.ExitCode != 0 || !result.MissingOutput {
+		t.Errorf("runCommand() = %+v, want a failure with exit code 0 and missing output", result)
+	}
+	if !strings.Contains(output, "[version] Expected output not found: warnings: 0") || strings.Contains(output, "not found: ^v") {
+		t.Errorf("runCommand() output = %q, want only the missing pattern reported", output)
+	}
+	if strings.Contains(output, "Command completed successfully") {
+		t.Errorf("runCommand() output = %q, want no success message", output)
+	}
+
+	// Commands without expectations are not affected
+	captureStdout(func() {
+		result = runCommand(CommandInfo{Command: "true", Tag: "other"}, nil)
+	})
+	if !result.Success {
+		t.Errorf("runCommand() without expectations = %+v, want success", result)
+	}
+
+	// A command that fails but prints what was expected has no missing output
+	captureStdout(func() {
+		result = runCommand(CommandInfo{Command: "echo v1.2.3; echo 'warnings: 0'; exit 1", Tag: "version"}, nil)
+	})
+	if result.Success || result.MissingOutput {
+		t.Errorf("runCommand() = %+v, want a failure without missing output", result)
+	}
+}
+
+// TestRunCommandExpectSameTag tests that concurrent runs with the same tag
+// are checked against their own output
+func TestRunCommandExpectSameTag(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	oldExpectations, oldNoColor := outputExpectations, noColor
+	defer func() { outputExpectations, noColor = oldExpectations, oldNoColor }()
+	noColor = true
+
+	var err error
+	outputExpectations, err = parseExpectations([]string{"shard=^ok$"})
+	if err != nil {
+		t.Fatalf("parseExpectations() error = %v", err)
+	}
+
+	var passing, failing CommandResult
+	captureStdout(func() {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			passing = runCommand(CommandInfo{Command: "sleep 0.2; echo ok", Tag: "shard"}, nil)
+		}()
+		go func() {
+			defer wg.Done()
+			failing = runCommand(CommandInfo{Command: "sleep 0.1; echo broken", Tag: "shard"}, nil)
+		}()
+		wg.Wait()
+	})
+
+	if !passing.Success || failing.Success || !failing.MissingOutput {
+		t.Errorf("runCommand() = %+v and %+v, want only the run printing ok to succeed", passing, failing)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Directory to create a FIFO per tag in, as TAG.fifo, that the command's
+// output is also written to (--fifo-dir)
+var fifoDir string
+
+// setupFifoDir creates the directory selected with --fifo-dir
+func setupFifoDir() error {
+	if fifoDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(fifoDir, 0755); err != nil {
+		return fmt.Errorf("creating FIFO directory: %w", err)
+	}
+	return nil
+}
+
+// fifoFileName returns the name of the FIFO of a tag, with characters that
+// cannot be used in file names replaced
+func fifoFileName(tag string) string {
+	return strings.TrimSuffix(logFileName(tag), ".log") + ".fifo"
+}
@@ -0,0 +1,157 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+var (
+	// FIFO of each tag in --fifo-dir, created before the commands start or
+	// with the tag's first line
+	fifoWriters = make(map[string]*fifoWriter)
+	// Mutex guarding fifoWriters and serializing writes to the FIFOs
+	fifoMutex sync.Mutex
+)
+
+// fifoWriter writes lines to a FIFO without ever blocking the command. The
+// FIFO is opened once a reader has opened it, and lines are dropped while
+// nobody reads or while the reader falls behind.
+type fifoWriter struct {
+	path string
+	// Write end of the FIFO, -1 while no reader has opened it
+	fd int
+	// Rest of a line the reader had no room for, written before the next one
+	pending []byte
+	// Set if the FIFO could not be created
+	failed bool
+}
+
+// createFifos creates the FIFOs of all commands up front, so readers can
+// open them before the commands print anything
+func createFifos(commands []CommandInfo) {
+	if fifoDir == "" {
+		return
+	}
+
+	fifoMutex.Lock()
+	defer fifoMutex.Unlock()
+	for _, cmdInfo := range commands {
+		fifoFor(cmdInfo.Tag)
+	}
+}
+
+// fifoFor returns the writer of a tag's FIFO, creating the FIFO if needed.
+// Must be called with fifoMutex held.
+func fifoFor(tag string) *fifoWriter {
+	w, ok := fifoWriters[tag]
+	if ok {
+		return w
+	}
+
+	w = &fifoWriter{path: filepath.Join(fifoDir, fifoFileName(tag)), fd: -1}
+	if err := makeFifo(w.path); err != nil {
+		// Reported once, the command's output is still printed
+		printCommandMessage(tag, fmt.Sprintf("Error creating FIFO: %v", err), colorRed)
+		w.failed = true
+	}
+	fifoWriters[tag] = w
+	return w
+}
+
+// makeFifo creates a FIFO at path, or reuses the FIFO already there
+func makeFifo(path string) error {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s exists and is not a FIFO", path)
+		}
+		return nil
+	}
+	return syscall.Mkfifo(path, 0644)
+}
+
+// fifoOutputLine writes a line of a command's output to the command's FIFO
+// in --fifo-dir. Lines are written whether or not they are printed.
+func fifoOutputLine(tag string, line string) {
+	if fifoDir == "" {
+		return
+	}
+	if !keepANSIInFiles {
+		line = ansiPattern.ReplaceAllString(line, "")
+	}
+
+	fifoMutex.Lock()
+	defer fifoMutex.Unlock()
+	fifoFor(tag).writeLine(line)
+}
+
+// writeLine writes a line to the FIFO if a reader has room for it
+func (w *fifoWriter) writeLine(line string) {
+	if w.failed {
+		return
+	}
+	if w.fd < 0 {
+		// Opening the write end fails with ENXIO until a reader opens it
+		fd, err := syscall.Open(w.path, syscall.O_WRONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return
+		}
+		w.fd = fd
+	}
+
+	// The rest of a partly written line goes first, so lines stay whole
+	if len(w.pending) > 0 && !w.write(w.pending) {
+		return
+	}
+	w.write([]byte(line + "\n"))
+}
+
+// write writes data to the FIFO and reports whether all of it was written.
+// What the reader had no room for is kept as pending, unless nothing was
+// written, in which case the data is dropped.
+func (w *fifoWriter) write(data []byte) bool {
+	n, err := syscall.Write(w.fd, data)
+	if errors.Is(err, syscall.EPIPE) {
+		// The reader is gone; open the FIFO again once another one comes
+		w.close()
+		return false
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n > 0 && n < len(data) {
+		w.pending = append([]byte(nil), data[n:]...)
+	} else if n == len(data) {
+		w.pending = nil
+	}
+	return n == len(data)
+}
+
+// close closes the write end of the FIFO, which ends the output for the reader
+func (w *fifoWriter) close() {
+	if w.fd >= 0 {
+		_ = syscall.Close(w.fd)
+	}
+	w.fd = -1
+	w.pending = nil
+}
+
+// closeFifos closes and removes the FIFOs, so readers see the end of the
+// output
+func closeFifos() {
+	fifoMutex.Lock()
+	defer fifoMutex.Unlock()
+	for tag, w := range fifoWriters {
+		w.close()
+		if !w.failed {
+			_ = os.Remove(w.path)
+		}
+		delete(fifoWriters, tag)
+	}
+}
@@ -0,0 +1,70 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// TestFifoOutput tests that output reaches a reader of the tag's FIFO without blocking when there is none
+func TestFifoOutput(t *testing.T) {
+	oldFifoDir, oldNoColor, oldKeepANSI := fifoDir, noColor, keepANSIInFiles
+	fifoDir, noColor, keepANSIInFiles = t.TempDir(), true, false
+	defer func() {
+		closeFifos()
+		fifoDir, noColor, keepANSIInFiles = oldFifoDir, oldNoColor, oldKeepANSI
+	}()
+
+	createFifos([]CommandInfo{{Tag: "build"}, {Tag: "ci/test"}})
+	path := filepath.Join(fifoDir, "build.fifo")
+	if info, err := os.Stat(path); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("os.Stat(%s) = %v, %v, want a FIFO", path, info, err)
+	}
+	if _, err := os.Stat(filepath.Join(fifoDir, "ci_test.fifo")); err != nil {
+		t.Errorf("FIFO of tag ci/test not created: %v", err)
+	}
+
+	// Nobody reads yet, so the line is dropped instead of blocking
+	captureStdout(func() {
+		processOutput(strings.NewReader("unread\n"), "build", "out", colorGreen)
+	})
+
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatalf("opening the FIFO failed: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	output := captureStdout(func() {
+		processOutput(strings.NewReader("\x1b[32mcompiled\x1b[0m\ndone\n"), "build", "out", colorGreen)
+	})
+	if !strings.Contains(output, "[build:out] done") {
+		t.Errorf("processOutput() output = %q, want the lines printed as well", output)
+	}
+	closeFifos()
+
+	buf := make([]byte, 4096)
+	n, _ := syscall.Read(fd, buf)
+	if got, want := string(buf[:max(n, 0)]), "compiled\ndone\n"; got != want {
+		t.Errorf("FIFO contents = %q, want %q", got, want)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("FIFO still exists after closeFifos(): %v", err)
+	}
+}
+
+// TestMakeFifoExistingFile tests that a regular file in the way of a FIFO is an error
+func TestMakeFifoExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "build.fifo")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := makeFifo(path); err == nil {
+		t.Error("makeFifo() expected an error for a regular file")
+	}
+}
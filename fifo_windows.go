@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package main
+
+// createFifos does nothing on Windows, where --fifo-dir is rejected
+func createFifos(commands []CommandInfo) {}
+
+// fifoOutputLine does nothing on Windows, where --fifo-dir is rejected
+func fifoOutputLine(tag string, line string) {}
+
+// closeFifos does nothing on Windows, where --fifo-dir is rejected
+func closeFifos() {}
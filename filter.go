@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Patterns of lines to show (--grep)
+	grepPatterns []string
+	// Patterns of lines to hide (--grep-out)
+	grepOutPatterns []string
+	// Per-tag patterns of lines to show (--tag-grep, format: TAG:REGEX)
+	tagGrepPatterns []string
+	// Per-tag patterns of lines to hide (--tag-grep-out, format: TAG:REGEX)
+	tagGrepOutPatterns []string
+	// Filter applied to the output of all commands
+	globalFilter lineFilter
+	// Filters applied to the output of specific tags
+	tagFilters = map[string]*lineFilter{}
+)
+
+// lineFilter decides which output lines are printed. A line is printed if it
+// matches at least one include pattern (or there are none) and no exclude
+// pattern.
+type lineFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// allows reports whether the line passes the filter
+func (f *lineFilter) allows(line string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(line) {
+			return false
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupFilters compiles the --grep, --grep-out, --tag-grep and --tag-grep-out patterns
+func setupFilters() error {
+	globalFilter = lineFilter{}
+	tagFilters = map[string]*lineFilter{}
+
+	for _, pattern := range grepPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid --grep pattern '%s': %w", pattern, err)
+		}
+		globalFilter.include = append(globalFilter.include, re)
+	}
+
+	for _, pattern := range grepOutPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid --grep-out pattern '%s': %w", pattern, err)
+		}
+		globalFilter.exclude = append(globalFilter.exclude, re)
+	}
+
+	for _, value := range tagGrepPatterns {
+		tag, re, err := parseTagPattern(value)
+		if err != nil {
+			return fmt.Errorf("invalid --tag-grep value: %w", err)
+		}
+		f := tagFilter(finalTag(tag))
+		f.include = append(f.include, re)
+	}
+
+	for _, value := range tagGrepOutPatterns {
+		tag, re, err := parseTagPattern(value)
+		if err != nil {
+			return fmt.Errorf("invalid --tag-grep-out value: %w", err)
+		}
+		f := tagFilter(finalTag(tag))
+		f.exclude = append(f.exclude, re)
+	}
+
+	return nil
+}
+
+// tagFilter returns the filter for a tag, creating it if needed
+func tagFilter(tag string) *lineFilter {
+	f, ok := tagFilters[tag]
+	if !ok {
+		f = &lineFilter{}
+		tagFilters[tag] = f
+	}
+	return f
+}
+
+// parseTagPattern parses a TAG:REGEX value
+func parseTagPattern(value string) (string, *regexp.Regexp, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", nil, fmt.Errorf("'%s', expected 'TAG:REGEX'", value)
+	}
+
+	re, err := regexp.Compile(parts[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("'%s': %w", value, err)
+	}
+	return parts[0], re, nil
+}
+
+// shouldPrintLine reports whether an output line of the given tag passes
+// both the global filter and the tag's own filter
+func shouldPrintLine(tag string, line string) bool {
+	if !globalFilter.allows(line) {
+		return false
+	}
+	if f, ok := tagFilters[tag]; ok {
+		return f.allows(line)
+	}
+	return true
+}
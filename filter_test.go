@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+// TestShouldPrintLine tests global and per-tag output filtering
+func TestShouldPrintLine(t *testing.T) {
+	oldGrep, oldGrepOut := grepPatterns, grepOutPatterns
+	oldTagGrep, oldTagGrepOut := tagGrepPatterns, tagGrepOutPatterns
+	defer func() {
+		grepPatterns, grepOutPatterns = oldGrep, oldGrepOut
+		tagGrepPatterns, tagGrepOutPatterns = oldTagGrep, oldTagGrepOut
+		if err := setupFilters(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	grepPatterns = []string{"error|warn"}
+	grepOutPatterns = []string{"DEBUG"}
+	tagGrepPatterns = []string{"db:slow query"}
+	tagGrepOutPatterns = []string{"api:healthcheck"}
+	if err := setupFilters(); err != nil {
+		t.Fatalf("setupFilters() error = %v", err)
+	}
+
+	tests := []struct {
+		tag  string
+		line string
+		want bool
+	}{
+		{tag: "web", line: "an error occurred", want: true},
+		{tag: "web", line: "warn: disk almost full", want: true},
+		{tag: "web", line: "request served", want: false},
+		{tag: "web", line: "DEBUG error details", want: false},
+		{tag: "db", line: "error: slow query", want: true},
+		{tag: "db", line: "error: connection lost", want: false},
+		{tag: "api", line: "error in healthcheck", want: false},
+		{tag: "api", line: "error in handler", want: true},
+	}
+
+	for _, tt := range tests {
+		if got := shouldPrintLine(tt.tag, tt.line); got != tt.want {
+			t.Errorf("shouldPrintLine(%q, %q) = %v, want %v", tt.tag, tt.line, got, tt.want)
+		}
+	}
+}
+
+// TestSetupFiltersInvalid tests that invalid patterns are rejected
+func TestSetupFiltersInvalid(t *testing.T) {
+	oldGrep, oldTagGrep := grepPatterns, tagGrepPatterns
+	defer func() {
+		grepPatterns, tagGrepPatterns = oldGrep, oldTagGrep
+		if err := setupFilters(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	grepPatterns = []string{"("}
+	if err := setupFilters(); err == nil {
+		t.Error("setupFilters() expected an error for an invalid regex")
+	}
+
+	grepPatterns = nil
+	tagGrepPatterns = []string{"no-separator"}
+	if err := setupFilters(); err == nil {
+		t.Error("setupFilters() expected an error for a missing tag")
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	// Expand glob patterns in arguments of directly executed commands (--expand-globs)
+	expandGlobs bool
+	// What to do with a pattern that matches no files: keep or error
+	globNoMatch string
+)
+
+// isGlobChar reports whether a shell special character is part of glob syntax
+func isGlobChar(char string) bool {
+	return char == "*" || char == "?" || char == "[" || char == "]"
+}
+
+// expandGlobArgs replaces every argument containing a glob pattern with the
+// files matching it, sorted by name. The program itself is not expanded. A
+// pattern without matches is kept as it is, or is an error with
+// --glob-no-match=error. Relative patterns are matched in dir, or in the
+// current directory when dir is empty.
+func expandGlobArgs(dir string, args []string) ([]string, error) {
+	expanded := []string{args[0]}
+	for _, arg := range args[1:] {
+		if !strings.ContainsAny(arg, "*?[") {
+			expanded = append(expanded, arg)
+			continue
+		}
+
+		matches, err := globIn(dir, arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern '%s': %w", arg, err)
+		}
+		if len(matches) == 0 {
+			if globNoMatch == "error" {
+				return nil, fmt.Errorf("no files match '%s'", arg)
+			}
+			expanded = append(expanded, arg)
+			continue
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// globIn matches a pattern in dir, returning the matches relative to dir
+// when the pattern is relative
+func globIn(dir string, pattern string) ([]string, error) {
+	if dir == "" || filepath.IsAbs(pattern) {
+		return filepath.Glob(pattern)
+	}
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, err
+	}
+	for i, match := range matches {
+		if rel, err := filepath.Rel(dir, match); err == nil {
+			matches[i] = rel
+		}
+	}
+	return matches, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestExpandGlobArgs tests glob expansion of command arguments
+func TestExpandGlobArgs(t *testing.T) {
+	oldNoMatch := globNoMatch
+	defer func() { globNoMatch = oldNoMatch }()
+
+	dir := t.TempDir()
+	for _, name := range []string{"b.txt", "a.txt", "c.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	globNoMatch = "keep"
+	got, err := expandGlobArgs("", []string{"cat", "-n", filepath.Join(dir, "*.txt"), filepath.Join(dir, "*.go")})
+	if err != nil {
+		t.Fatalf("expandGlobArgs() failed: %v", err)
+	}
+	want := []string{"cat", "-n", filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "*.go")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandGlobArgs() = %v, want %v", got, want)
+	}
+
+	got, err = expandGlobArgs(dir, []string{"cat", "*.txt", filepath.Join(dir, "*.md")})
+	if err != nil {
+		t.Fatalf("expandGlobArgs() in a directory failed: %v", err)
+	}
+	want = []string{"cat", "a.txt", "b.txt", filepath.Join(dir, "c.md")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandGlobArgs() in a directory = %v, want %v", got, want)
+	}
+
+	globNoMatch = "error"
+	if _, err := expandGlobArgs("", []string{"cat", filepath.Join(dir, "*.go")}); err == nil {
+		t.Error("expandGlobArgs() with --glob-no-match=error succeeded, want an error")
+	}
+}
+
+// TestNeedsShellWithExpandGlobs tests that glob patterns alone do not need a shell when rufl expands them
+func TestNeedsShellWithExpandGlobs(t *testing.T) {
+	oldExpandGlobs := expandGlobs
+	defer func() { expandGlobs = oldExpandGlobs }()
+
+	expandGlobs = true
+	if needsShell("ls *.txt file[12].go") {
+		t.Error("needsShell() = true for globs with --expand-globs, want false")
+	}
+	if !needsShell("ls *.txt | wc -l") {
+		t.Error("needsShell() = false for a pipe with --expand-globs, want true")
+	}
+
+	expandGlobs = false
+	if !needsShell("ls *.txt") {
+		t.Error("needsShell() = false for globs without --expand-globs, want true")
+	}
+}
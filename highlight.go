@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ANSI codes for highlighted commands. styleNormal ends bold and dim text
+// without resetting the color of the surrounding message.
+const (
+	styleBold   = "\033[1m"
+	styleNormal = "\033[22m"
+)
+
+// Highlight the program name and flags in echoed commands
+var highlightCommands bool
+
+// shellSeparators are the tokens after which a new program starts
+var shellSeparators = map[string]bool{"|": true, "||": true, "&&": true, ";": true, "&": true, "(": true}
+
+// echoCommand returns a command as shown in the "Executing" messages,
+// highlighted with --highlight-commands unless color is disabled
+func echoCommand(command string) string {
+	if !highlightCommands || noColor || !colorSupported {
+		return command
+	}
+	return highlightCommand(command)
+}
+
+// highlightCommand makes program names bold and flags dim. Tokens are split
+// on whitespace outside of quotes, which is enough for reading purposes.
+func highlightCommand(command string) string {
+	var b strings.Builder
+	program := true
+	for _, token := range splitTokens(command) {
+		trimmed := strings.TrimSpace(token)
+		switch {
+		case trimmed == "":
+			b.WriteString(token)
+			continue
+		case shellSeparators[trimmed]:
+			b.WriteString(token)
+			program = true
+			continue
+		case program && !strings.Contains(trimmed, "="):
+			b.WriteString(styleToken(token, styleBold))
+			program = false
+		case strings.HasPrefix(trimmed, "-"):
+			b.WriteString(styleToken(token, colorDim))
+		default:
+			b.WriteString(token)
+		}
+	}
+	return b.String()
+}
+
+// styleToken wraps the text of a token in a style, leaving surrounding whitespace alone
+func styleToken(token string, style string) string {
+	start := len(token) - len(strings.TrimLeft(token, " \t\n"))
+	end := len(strings.TrimRight(token, " \t\n"))
+	return token[:start] + style + token[start:end] + styleNormal + token[end:]
+}
+
+// splitTokens splits a command into tokens that each carry the whitespace
+// preceding them, so joining them gives back the command
+func splitTokens(command string) []string {
+	var tokens []string
+	var quote rune
+	start := 0
+	inToken := false
+	for i, r := range command {
+		isSpace := r == ' ' || r == '\t' || r == '\n'
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inToken = true
+		case isSpace && inToken:
+			tokens = append(tokens, command[start:i])
+			start = i
+			inToken = false
+		case !isSpace:
+			inToken = true
+		}
+	}
+	if start < len(command) {
+		tokens = append(tokens, command[start:])
+	}
+	return tokens
+}
+
+var (
+	// Raw --highlight values, REGEX or COLOR:REGEX
+	highlightFlags []string
+	// Compiled output highlights, in order of precedence
+	outputHighlights []outputHighlight
+)
+
+// highlightPalette gives highlights without an explicit color distinct colors
+var highlightPalette = []string{colorRed, colorYellow, colorPurple, colorCyan, colorBlue, colorGreen}
+
+// outputHighlight is a pattern whose matches in output lines are shown in color
+type outputHighlight struct {
+	pattern *regexp.Regexp
+	color   string
+}
+
+// parseHighlights compiles --highlight values. A value may start with a
+// color name and a colon; otherwise colors are taken from the palette in turn.
+func parseHighlights(values []string) ([]outputHighlight, error) {
+	var highlights []outputHighlight
+	for i, value := range values {
+		color := highlightPalette[i%len(highlightPalette)]
+		pattern := value
+		if name, rest, ok := strings.Cut(value, ":"); ok {
+			if named, known := colorNames[strings.ToLower(name)]; known {
+				color, pattern = named, rest
+			}
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --highlight pattern '%s': %w", pattern, err)
+		}
+		highlights = append(highlights, outputHighlight{pattern: re, color: color})
+	}
+	return highlights, nil
+}
+
+// highlightLine shows the matches of the --highlight patterns in bold color.
+// Where matches overlap, the pattern given first wins. Lines are returned
+// unchanged when color is disabled.
+func highlightLine(line string) string {
+	if len(outputHighlights) == 0 || noColor || !colorSupported {
+		return line
+	}
+
+	// Color of each byte of the line, empty where nothing matched
+	colors := make([]string, len(line))
+	matched := false
+	for _, highlight := range outputHighlights {
+		for _, match := range highlight.pattern.FindAllStringIndex(line, -1) {
+			for i := match[0]; i < match[1]; i++ {
+				if colors[i] == "" {
+					colors[i] = highlight.color
+					matched = true
+				}
+			}
+		}
+	}
+	if !matched {
+		return line
+	}
+
+	var b strings.Builder
+	current := ""
+	for i := 0; i < len(line); i++ {
+		if colors[i] != current {
+			if current != "" {
+				b.WriteString(colorReset)
+			}
+			if colors[i] != "" {
+				b.WriteString(styleBold + colors[i])
+			}
+			current = colors[i]
+		}
+		b.WriteByte(line[i])
+	}
+	if current != "" {
+		b.WriteString(colorReset)
+	}
+	return b.String()
+}
+
+// resetPattern matches escape sequences that reset all colors and attributes
+var resetPattern = regexp.MustCompile(`\x1b\[0?m`)
+
+// colorLine colors a whole line of output. Colors of the line's own are
+// kept, and the line color is restored wherever the line resets them.
+func colorLine(line string, color string) string {
+	return color + resetPattern.ReplaceAllString(line, "${0}"+color) + colorReset
+}
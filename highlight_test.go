@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestSplitTokens tests that tokens keep their whitespace and quoted spaces
+func TestSplitTokens(t *testing.T) {
+	command := `go  build -o "my app" ./...`
+	tokens := splitTokens(command)
+	if strings.Join(tokens, "") != command {
+		t.Errorf("splitTokens(%q) = %q, which does not join back to the command", command, tokens)
+	}
+	if len(tokens) != 5 || tokens[3] != ` "my app"` {
+		t.Errorf("splitTokens(%q) = %q, want 5 tokens with the quoted argument intact", command, tokens)
+	}
+}
+
+// TestHighlightCommand tests that programs are bold and flags dim
+func TestHighlightCommand(t *testing.T) {
+	bold := func(s string) string { return styleBold + s + styleNormal }
+	dim := func(s string) string { return colorDim + s + styleNormal }
+
+	tests := []struct {
+		command string
+		want    string
+	}{
+		{command: "go build ./...", want: bold("go") + " build ./..."},
+		{command: "go test -race -v ./...", want: bold("go") + " test " + dim("-race") + " " + dim("-v") + " ./..."},
+		{command: "ls -l | grep -v x && make", want: bold("ls") + " " + dim("-l") + " | " + bold("grep") + " " + dim("-v") + " x && " + bold("make")},
+		{command: "CGO_ENABLED=0 go build", want: "CGO_ENABLED=0 " + bold("go") + " build"},
+		{command: "echo '-not a flag'", want: bold("echo") + " '-not a flag'"},
+	}
+
+	for _, tt := range tests {
+		if got := highlightCommand(tt.command); got != tt.want {
+			t.Errorf("highlightCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+// TestEchoCommand tests that highlighting is off by default and without color
+func TestEchoCommand(t *testing.T) {
+	oldHighlight := highlightCommands
+	oldNoColor := noColor
+	oldColorSupported := colorSupported
+	defer func() {
+		highlightCommands = oldHighlight
+		noColor = oldNoColor
+		colorSupported = oldColorSupported
+	}()
+
+	colorSupported = true
+	noColor = false
+	highlightCommands = false
+	if got := echoCommand("go build"); got != "go build" {
+		t.Errorf("echoCommand() without --highlight-commands = %q", got)
+	}
+
+	highlightCommands = true
+	if got := echoCommand("go build"); got != styleBold+"go"+styleNormal+" build" {
+		t.Errorf("echoCommand() with --highlight-commands = %q", got)
+	}
+
+	noColor = true
+	if got := echoCommand("go build"); got != "go build" {
+		t.Errorf("echoCommand() with --no-color = %q", got)
+	}
+}
+
+// TestParseHighlights tests that highlights get palette colors unless one is named
+func TestParseHighlights(t *testing.T) {
+	highlights, err := parseHighlights([]string{"ERROR", "blue:WARN", "a:b"})
+	if err != nil {
+		t.Fatalf("parseHighlights() error = %v", err)
+	}
+	if highlights[0].color != highlightPalette[0] || highlights[0].pattern.String() != "ERROR" {
+		t.Errorf("highlights[0] = %v, want ERROR in the first palette color", highlights[0])
+	}
+	if highlights[1].color != colorBlue || highlights[1].pattern.String() != "WARN" {
+		t.Errorf("highlights[1] = %v, want WARN in blue", highlights[1])
+	}
+	if highlights[2].pattern.String() != "a:b" {
+		t.Errorf("highlights[2] pattern = %q, want the unknown color kept in the pattern", highlights[2].pattern)
+	}
+
+	if _, err := parseHighlights([]string{"("}); err == nil {
+		t.Error("parseHighlights() error = nil, want an error for an invalid pattern")
+	}
+}
+
+// TestHighlightLine tests that matches are colored, the first pattern winning overlaps
+func TestHighlightLine(t *testing.T) {
+	oldHighlights := outputHighlights
+	oldNoColor := noColor
+	oldColorSupported := colorSupported
+	colorSupported = true
+	defer func() {
+		outputHighlights = oldHighlights
+		noColor = oldNoColor
+		colorSupported = oldColorSupported
+	}()
+
+	outputHighlights, _ = parseHighlights([]string{"red:ERROR", "yellow:ERR|WARN"})
+	red := func(s string) string { return styleBold + colorRed + s + colorReset }
+	yellow := func(s string) string { return styleBold + colorYellow + s + colorReset }
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "all good", want: "all good"},
+		{line: "ERROR: disk full", want: red("ERROR") + ": disk full"},
+		{line: "WARN then ERR", want: yellow("WARN") + " then " + yellow("ERR")},
+		{line: "ERRORWARN", want: red("ERROR") + yellow("WARN")},
+	}
+
+	noColor = false
+	for _, tt := range tests {
+		if got := highlightLine(tt.line); got != tt.want {
+			t.Errorf("highlightLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	noColor = true
+	if got := highlightLine("ERROR"); got != "ERROR" {
+		t.Errorf("highlightLine() with --no-color = %q, want the line unchanged", got)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	// Do not record the run in the history file
+	noHistory bool
+	// Number of runs listed by the history subcommand
+	historyLimit int
+)
+
+// HistoryEntry is a run recorded in the history file, one JSON object per line
+type HistoryEntry struct {
+	Time     time.Time        `json:"time"`
+	Dir      string           `json:"dir,omitempty"`
+	Args     []string         `json:"args"`
+	Mode     string           `json:"mode"`
+	Commands []HistoryCommand `json:"commands"`
+	Success  bool             `json:"success"`
+	Failed   int              `json:"failed"`
+	Duration float64          `json:"duration_seconds"`
+}
+
+// HistoryCommand is a command of a run recorded in the history file
+type HistoryCommand struct {
+	Tag     string `json:"tag"`
+	Command string `json:"command"`
+	// Everything parsed from the command's tag and options, such as its
+	// host, priority and color, so a rerun runs it the same way
+	Info *CommandInfo `json:"info,omitempty"`
+}
+
+// historyPath returns the location of the history file, ~/.rufl/history.jsonl
+func historyPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".rufl", "history.jsonl"), nil
+}
+
+// newHistoryEntry describes a finished run for the history file
+func newHistoryEntry(args []string, parallel bool, commands []CommandInfo, started time.Time, results []CommandResult) HistoryEntry {
+	entry := HistoryEntry{
+		Time:     started,
+		Args:     args,
+		Mode:     "sequential",
+		Commands: []HistoryCommand{},
+		Success:  true,
+		Duration: time.Since(started).Seconds(),
+	}
+	if parallel {
+		entry.Mode = "parallel"
+	}
+	if dir, err := os.Getwd(); err == nil {
+		entry.Dir = dir
+	}
+	for _, cmdInfo := range commands {
+		info := cmdInfo
+		// Relative to the recorded directory, with the --chdir of this run
+		info.Dir = commandDir(cmdInfo)
+		entry.Commands = append(entry.Commands, HistoryCommand{Tag: cmdInfo.Tag, Command: cmdInfo.Command, Info: &info})
+	}
+	for _, result := range results {
+		if !result.Success && !result.Skipped {
+			entry.Success = false
+			entry.Failed++
+		}
+	}
+	return entry
+}
+
+// appendHistory appends a run to the history file at path, creating it if needed
+func appendHistory(path string, entry HistoryEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// recordHistory appends a finished run of rufl with args to the history file,
+// unless --no-history is set or nothing was run
+func recordHistory(args []string, parallel bool, commands []CommandInfo, started time.Time, results []CommandResult) {
+	if noHistory || dryRun {
+		return
+	}
+	path, err := historyPath()
+	if err == nil {
+		err = appendHistory(path, newHistoryEntry(args, parallel, commands, started, results))
+	}
+	if err != nil {
+		printColoredMessage(fmt.Sprintf("Error writing history: %v", err), colorRed)
+	}
+}
+
+// readHistory reads the last limit runs from the history file at path, oldest
+// first. Lines that cannot be parsed are skipped; a missing file is an empty history.
+func readHistory(path string, limit int) ([]HistoryEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// lastRun returns the most recent run recorded in the history file at path
+func lastRun(path string) (*HistoryEntry, error) {
+	entries, err := readHistory(path, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no runs recorded in %s", path)
+	}
+	return &entries[0], nil
+}
+
+// historyCommands turns a recorded run back into the commands to run and
+// whether they run in parallel. Runs recorded before the full command was
+// kept only have a tag and command. Commands run in the directory they ran
+// in when recorded, whatever the current directory is.
+func historyCommands(entry *HistoryEntry) ([]CommandInfo, bool) {
+	var commands []CommandInfo
+	for i, command := range entry.Commands {
+		cmdInfo := CommandInfo{Command: command.Command, Tag: command.Tag}
+		if command.Info != nil {
+			cmdInfo = *command.Info
+		}
+		if entry.Dir != "" && !filepath.IsAbs(cmdInfo.Dir) {
+			cmdInfo.Dir = filepath.Join(entry.Dir, cmdInfo.Dir)
+		}
+		cmdInfo.Index = i
+		commands = append(commands, cmdInfo)
+	}
+	return commands, entry.Mode == "parallel"
+}
+
+// rerunLast runs the commands of the most recent run again, with the
+// options of the current invocation
+func rerunLast() error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	entry, err := lastRun(path)
+	if err != nil {
+		return err
+	}
+	commands, parallel := historyCommands(entry)
+	if len(commands) == 0 {
+		return fmt.Errorf("the last run has no commands")
+	}
+
+	printColoredMessage("Rerunning: "+shellCommandLine(append([]string{"rufl"}, entry.Args...)), colorBlue)
+	started := time.Now()
+	results := runCommands(commands, parallel)
+	recordHistory(entry.Args, parallel, commands, started, results)
+	exitOnFailedExpectations(results)
+	return nil
+}
+
+// formatHistory lists runs as a table with the command line to rerun each one
+func formatHistory(entries []HistoryEntry) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tMODE\tRESULT\tDURATION\tCOMMAND")
+	for _, entry := range entries {
+		result := "ok"
+		if !entry.Success {
+			result = fmt.Sprintf("%d failed", entry.Failed)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Mode,
+			result, formatSeconds(entry.Duration), shellCommandLine(append([]string{"rufl"}, entry.Args...)))
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// shellCommandLine joins arguments into a line that can be pasted into a shell
+func shellCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// shellQuote single-quotes an argument unless it only holds characters a
+// shell takes literally
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+./:,@%") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// printHistory prints the runs recorded in the history file
+func printHistory(limit int) error {
+	path, err := historyPath()
+	if err != nil {
+		return err
+	}
+	entries, err := readHistory(path, limit)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No runs recorded yet")
+		return nil
+	}
+	fmt.Print(formatHistory(entries))
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHistoryRoundTrip tests appending runs to the history file and reading the last ones back
+func TestHistoryRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rufl", "history.jsonl")
+
+	if entries, err := readHistory(path, 10); err != nil || len(entries) != 0 {
+		t.Fatalf("readHistory() of a missing file = %v, %v, want an empty history", entries, err)
+	}
+
+	commands := []CommandInfo{{Command: "make", Tag: "build"}, {Command: "make test", Tag: "test", Index: 1}}
+	results := []CommandResult{{Tag: "build", Success: true}, {Tag: "test", ExitCode: 2}}
+	for i := 0; i < 3; i++ {
+		entry := newHistoryEntry([]string{"=", "+build:make", "+test:make test"}, i%2 == 0, commands, time.Now(), results[:i%2+1])
+		if err := appendHistory(path, entry); err != nil {
+			t.Fatalf("appendHistory() error = %v", err)
+		}
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.WriteString("not json\n")
+	_ = file.Close()
+
+	entries, err := readHistory(path, 2)
+	if err != nil {
+		t.Fatalf("readHistory() error = %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("readHistory() returned %d entries, want 2", len(entries))
+	}
+	if entries[0].Mode != "sequential" || entries[0].Success || entries[0].Failed != 1 {
+		t.Errorf("first entry = %+v, want a failed sequential run", entries[0])
+	}
+	if entries[1].Mode != "parallel" || !entries[1].Success || len(entries[1].Commands) != 2 {
+		t.Errorf("second entry = %+v, want a successful parallel run of 2 commands", entries[1])
+	}
+}
+
+// TestFormatHistory tests listing runs with a command line that can be pasted into a shell
+func TestFormatHistory(t *testing.T) {
+	entries := []HistoryEntry{
+		{Args: []string{"=", "+build:make", "echo it's done"}, Mode: "parallel", Success: true, Duration: 1.5},
+		{Args: []string{"+", "make test"}, Mode: "sequential", Failed: 1, Duration: 0.25},
+	}
+
+	output := formatHistory(entries)
+	for _, want := range []string{
+		`rufl = +build:make 'echo it'\''s done'`,
+		"rufl + 'make test'",
+		"1 failed",
+		"1.5s",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("formatHistory() = %q, want it to contain %q", output, want)
+		}
+	}
+}
+
+// TestHistoryCommands tests turning the last recorded run back into commands
+func TestHistoryCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if _, err := lastRun(path); err == nil {
+		t.Error("lastRun() of an empty history expected an error")
+	}
+
+	first := HistoryEntry{Args: []string{"+", "make"}, Mode: "sequential", Commands: []HistoryCommand{{Tag: "1", Command: "make"}}}
+	last := HistoryEntry{Args: []string{"=", "+a:echo a", "echo b"}, Mode: "parallel", Commands: []HistoryCommand{{Tag: "a", Command: "echo a"}, {Tag: "1", Command: "echo b"}}}
+	for _, entry := range []HistoryEntry{first, last} {
+		if err := appendHistory(path, entry); err != nil {
+			t.Fatalf("appendHistory() error = %v", err)
+		}
+	}
+
+	entry, err := lastRun(path)
+	if err != nil {
+		t.Fatalf("lastRun() error = %v", err)
+	}
+	commands, parallel := historyCommands(entry)
+	want := []CommandInfo{{Command: "echo a", Tag: "a", Index: 0}, {Command: "echo b", Tag: "1", Index: 1}}
+	if !parallel || !reflect.DeepEqual(commands, want) {
+		t.Errorf("historyCommands() = %v, %v, want %v, true", commands, parallel, want)
+	}
+}
+
+// TestHistoryCommandsKeepSettings tests that a rerun keeps what was parsed from the tags, such as the host
+func TestHistoryCommandsKeepSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	oldWorkDir := workDir
+	workDir = "project"
+	defer func() { workDir = oldWorkDir }()
+
+	commands := []CommandInfo{
+		{Command: "pg_isready", Tag: "db", Host: "db1"},
+		{Command: "make", Tag: "build", Index: 1, Priority: 2, Color: colorGreen, Nice: 5, Detach: true, Image: "golang:1.24", Timeout: time.Minute, Dir: "web"},
+	}
+	entry := newHistoryEntry([]string{"=", "-C", "project", "+db@ssh://db1:pg_isready", "+build!2#green~5&@timeout=1m@dir=web:make"}, true, commands, time.Now(), nil)
+	if err := appendHistory(path, entry); err != nil {
+		t.Fatalf("appendHistory() error = %v", err)
+	}
+
+	last, err := lastRun(path)
+	if err != nil {
+		t.Fatalf("lastRun() error = %v", err)
+	}
+	// Commands run where they ran before, wherever rufl is run now
+	want := slices.Clone(commands)
+	want[0].Dir = filepath.Join(last.Dir, "project")
+	want[1].Dir = filepath.Join(last.Dir, "project", "web")
+	if got, _ := historyCommands(last); !reflect.DeepEqual(got, want) {
+		t.Errorf("historyCommands() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anmitsu/go-shlex"
+)
+
+const (
+	// hookTimeout is how long a hook may run before it is killed
+	hookTimeout = 30 * time.Second
+	// hookExitTimeout is how long rufl waits for pending hooks when it is
+	// stopped by a signal
+	hookExitTimeout = 2 * time.Second
+	// maxQueuedLineHooks is how many online hook runs may wait at once.
+	// Lines printed while that many are waiting do not run the hooks.
+	maxQueuedLineHooks = 100
+)
+
+// hookEvents are the lifecycle events hooks can be attached to
+var hookEvents = []string{"onstart", "online", "onexit", "onsuccess", "onfailure"}
+
+var (
+	// Hooks as EVENT=PROGRAM (--hook)
+	hookFlags []string
+	// Programs to run for each hook event, parsed from --hook
+	hooks map[string][]string
+	// Hook runs waiting to be run, in the order of their events
+	hookQueue []hookRun
+	// Number of hook runs that have not finished yet
+	hookPending int
+	// Number of online hook runs in hookQueue
+	queuedLineHooks int
+	// Number of online hook runs skipped since the queue was last empty
+	skippedLineHooks int
+	// Set once rufl is exiting on a signal, after which no hooks are queued
+	hooksStopped bool
+	// Mutex guarding the hook queue and counters
+	hookMutex sync.Mutex
+	// Broadcast whenever hookPending drops to zero
+	hooksIdle = sync.NewCond(&hookMutex)
+	// Signals the hook runner that hookQueue is not empty
+	hookWake = make(chan struct{}, 1)
+	// Starts the hook runner with the first hook run
+	hookRunnerOnce sync.Once
+)
+
+// hookRun is a hook program to run for an event
+type hookRun struct {
+	name    string
+	program string
+	event   Event
+}
+
+// parseHooks parses EVENT=PROGRAM values into a map of events to programs
+func parseHooks(values []string) (map[string][]string, error) {
+	parsed := make(map[string][]string)
+	for _, value := range values {
+		name, program, ok := strings.Cut(value, "=")
+		if !ok || strings.TrimSpace(program) == "" {
+			return nil, fmt.Errorf("invalid hook '%s', expected 'EVENT=PROGRAM'", value)
+		}
+		if !slices.Contains(hookEvents, name) {
+			return nil, fmt.Errorf("unknown hook event '%s', expected one of %s", name, strings.Join(hookEvents, ", "))
+		}
+		parsed[name] = append(parsed[name], program)
+	}
+	return parsed, nil
+}
+
+// hookNames returns the hook events a lifecycle event triggers
+func hookNames(event Event) []string {
+	switch {
+	case event.Event == "started":
+		return []string{"onstart"}
+	case event.Event == "line":
+		return []string{"online"}
+	case event.Event == "exited" && event.ExitCode != nil && *event.ExitCode == 0:
+		return []string{"onexit", "onsuccess"}
+	case event.Event == "exited":
+		return []string{"onexit", "onfailure"}
+	default:
+		return nil
+	}
+}
+
+// dispatchHooks queues the hooks of a lifecycle event. Hooks run one at a
+// time in the background, in the order of their events, so they never hold
+// up the commands. Lines printed faster than their online hooks can run are
+// skipped once maxQueuedLineHooks runs are waiting.
+func dispatchHooks(event Event) {
+	if len(hooks) == 0 {
+		return
+	}
+
+	var runs []hookRun
+	for _, name := range hookNames(event) {
+		for _, program := range hooks[name] {
+			runs = append(runs, hookRun{name: name, program: program, event: event})
+		}
+	}
+	if len(runs) == 0 {
+		return
+	}
+
+	hookMutex.Lock()
+	if hooksStopped {
+		hookMutex.Unlock()
+		return
+	}
+	if event.Event == "line" {
+		if queuedLineHooks >= maxQueuedLineHooks {
+			skippedLineHooks += len(runs)
+			hookMutex.Unlock()
+			return
+		}
+		queuedLineHooks += len(runs)
+	}
+	hookPending += len(runs)
+	hookQueue = append(hookQueue, runs...)
+	hookMutex.Unlock()
+
+	hookRunnerOnce.Do(func() { go runHooks() })
+
+	select {
+	case hookWake <- struct{}{}:
+	default:
+	}
+}
+
+// runHooks runs queued hooks for as long as rufl runs
+func runHooks() {
+	for range hookWake {
+		for {
+			hookMutex.Lock()
+			if len(hookQueue) == 0 {
+				skipped := skippedLineHooks
+				skippedLineHooks = 0
+				hookMutex.Unlock()
+				if skipped > 0 {
+					printColoredMessage(fmt.Sprintf("Skipped %d online hooks, lines were printed faster than the hooks ran", skipped), colorYellow)
+				}
+				break
+			}
+			run := hookQueue[0]
+			hookQueue = hookQueue[1:]
+			if run.name == "online" {
+				queuedLineHooks--
+			}
+			hookMutex.Unlock()
+
+			runHook(run)
+
+			hookMutex.Lock()
+			hookPending--
+			if hookPending == 0 {
+				hooksIdle.Broadcast()
+			}
+			hookMutex.Unlock()
+		}
+	}
+}
+
+// runHook runs a single hook program with the event in its environment.
+// The output of a hook is only shown if it fails.
+func runHook(run hookRun) {
+	args, err := shlex.Split(run.program, true)
+	if err != nil || len(args) == 0 {
+		printCommandMessage(run.event.Tag, fmt.Sprintf("Invalid %s hook '%s'", run.name, run.program), colorRed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(inheritedEnv(), hookEnv(run.name, run.event)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		message := fmt.Sprintf("%s hook '%s' failed: %v", run.name, run.program, err)
+		if text := strings.TrimSpace(string(output)); text != "" {
+			message += "\n" + text
+		}
+		printCommandMessage(run.event.Tag, message, colorRed)
+	}
+}
+
+// hookEnv returns the environment variables describing an event to a hook
+func hookEnv(name string, event Event) []string {
+	env := []string{"RUFL_HOOK=" + name, "RUFL_TAG=" + event.Tag}
+	if event.Command != "" {
+		env = append(env, "RUFL_COMMAND="+event.Command)
+	}
+	if event.PID != 0 {
+		env = append(env, "RUFL_PID="+strconv.Itoa(event.PID))
+	}
+	if event.Event == "line" {
+		env = append(env, "RUFL_STREAM="+event.Stream, "RUFL_LINE="+event.Line)
+	}
+	if event.ExitCode != nil {
+		env = append(env, "RUFL_EXIT_CODE="+strconv.Itoa(*event.ExitCode))
+	}
+	if event.Event == "exited" {
+		env = append(env, "RUFL_DURATION="+strconv.FormatFloat(event.Duration, 'f', 3, 64))
+	}
+	if event.Error != "" {
+		env = append(env, "RUFL_ERROR="+event.Error)
+	}
+	return env
+}
+
+// waitForHooks waits until the hooks of all events so far have run. Hooks
+// queued while it waits are waited for as well.
+func waitForHooks() {
+	hookMutex.Lock()
+	defer hookMutex.Unlock()
+	for hookPending > 0 {
+		hooksIdle.Wait()
+	}
+}
+
+// stopHooks stops queueing hooks and waits up to hookExitTimeout for the
+// pending ones, for exits on a signal that should not be held up by hooks
+func stopHooks() {
+	hookMutex.Lock()
+	hooksStopped = true
+	hookMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		waitForHooks()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(hookExitTimeout):
+		printColoredMessage("Not waiting for the remaining hooks", colorYellow)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestParseHooks tests parsing --hook values
+func TestParseHooks(t *testing.T) {
+	got, err := parseHooks([]string{"onstart=./a.sh", "onexit=notify --urgent", "onstart=./b.sh"})
+	if err != nil {
+		t.Fatalf("parseHooks() error = %v", err)
+	}
+	want := map[string][]string{"onstart": {"./a.sh", "./b.sh"}, "onexit": {"notify --urgent"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHooks() = %v, want %v", got, want)
+	}
+
+	for _, invalid := range []string{"onstart", "onstart=", "onboot=./a.sh"} {
+		if _, err := parseHooks([]string{invalid}); err == nil {
+			t.Errorf("parseHooks(%q) expected an error", invalid)
+		}
+	}
+}
+
+// TestHookNames tests which hooks each lifecycle event triggers
+func TestHookNames(t *testing.T) {
+	zero, one := 0, 1
+	tests := []struct {
+		event Event
+		want  []string
+	}{
+		{Event{Event: "started"}, []string{"onstart"}},
+		{Event{Event: "line"}, []string{"online"}},
+		{Event{Event: "exited", ExitCode: &zero}, []string{"onexit", "onsuccess"}},
+		{Event{Event: "exited", ExitCode: &one}, []string{"onexit", "onfailure"}},
+		{Event{Event: "exited", Error: "not found"}, []string{"onexit", "onfailure"}},
+	}
+
+	for _, tt := range tests {
+		if got := hookNames(tt.event); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("hookNames(%+v) = %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
+
+// TestHooks tests that hooks run in order with the event in their environment
+func TestHooks(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "hooks.log")
+	oldHooks, oldNoColor := hooks, noColor
+	hooks = map[string][]string{
+		"onstart":   {`sh -c 'echo "$RUFL_HOOK $RUFL_TAG" >> ` + path + `'`},
+		"online":    {`sh -c 'echo "$RUFL_HOOK $RUFL_STREAM $RUFL_LINE" >> ` + path + `'`},
+		"onfailure": {`sh -c 'echo "$RUFL_HOOK $RUFL_EXIT_CODE" >> ` + path + `'`},
+	}
+	noColor = true
+	defer func() { hooks, noColor = oldHooks, oldNoColor }()
+
+	captureStdout(func() {
+		executeCommand(CommandInfo{Command: "echo hello; exit 3", Tag: "greet"})
+		waitForHooks()
+	})
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading hook log: %v", err)
+	}
+	want := "onstart greet\nonline out hello\nonfailure 3\n"
+	if got := string(data); got != want {
+		t.Errorf("hook log = %q, want %q", got, want)
+	}
+}
+
+// TestHookFailure tests that a failing hook is reported with its output
+func TestHookFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	output := captureStdout(func() {
+		runHook(hookRun{name: "onexit", program: `sh -c 'echo broken; exit 2'`, event: Event{Event: "exited", Tag: "build"}})
+	})
+
+	if !strings.Contains(output, "[build] onexit hook 'sh -c 'echo broken; exit 2'' failed: exit status 2") || !strings.Contains(output, "broken") {
+		t.Errorf("runHook() output = %q, want the failure and the hook's output", output)
+	}
+}
+
+// TestLineHookLimit tests that lines are skipped while too many online hooks
+// are waiting, and that no hooks are queued once they are stopped
+func TestLineHookLimit(t *testing.T) {
+	oldHooks := hooks
+	hooks = map[string][]string{"online": {"true"}}
+	hookMutex.Lock()
+	queuedLineHooks, skippedLineHooks = maxQueuedLineHooks, 0
+	hookMutex.Unlock()
+	defer func() {
+		hooks = oldHooks
+		hookMutex.Lock()
+		queuedLineHooks, skippedLineHooks, hooksStopped = 0, 0, false
+		hookMutex.Unlock()
+	}()
+
+	dispatchHooks(Event{Event: "line", Tag: "chatty", Line: "spam"})
+	hookMutex.Lock()
+	queued, skipped := len(hookQueue), skippedLineHooks
+	hookMutex.Unlock()
+	if queued != 0 || skipped != 1 {
+		t.Errorf("dispatchHooks() queued %d and skipped %d runs, want 0 and 1", queued, skipped)
+	}
+
+	hookMutex.Lock()
+	queuedLineHooks, hooksStopped = 0, true
+	hookMutex.Unlock()
+	dispatchHooks(Event{Event: "line", Tag: "chatty", Line: "spam"})
+	hookMutex.Lock()
+	queued = len(hookQueue)
+	hookMutex.Unlock()
+	if queued != 0 {
+		t.Errorf("dispatchHooks() queued %d runs after the hooks were stopped, want 0", queued)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+var (
+	// Forward rufl's stdin to the running commands
+	interactive bool
+	// Forward rufl's stdin to every running command instead of just one
+	broadcastStdin bool
+	// Raw value of the --abort-key flag
+	abortKeyFlag string
+	// Key that stops rufl when pressed in interactive mode, 0 if disabled
+	abortKey byte
+	// Stdin of the commands currently receiving rufl's input, at most one
+	// unless --broadcast-stdin is set
+	stdinTargets []io.WriteCloser
+	// Set once rufl's own stdin reached end of file
+	stdinClosed bool
+	// Mutex to protect stdinTargets and stdinClosed
+	stdinMutex sync.Mutex
+	// Restores the terminal state changed for reading single keys, nil if unchanged
+	restoreTerminal func()
+)
+
+// parseKey parses a key description such as "q" or "ctrl-]" into the byte
+// the terminal sends for it
+func parseKey(value string) (byte, error) {
+	lower := strings.ToLower(value)
+	for _, prefix := range []string{"ctrl-", "ctrl+", "^"} {
+		if strings.HasPrefix(lower, prefix) && len(value) == len(prefix)+1 {
+			key := value[len(prefix)]
+			if key >= 'a' && key <= 'z' {
+				key -= 'a' - 'A'
+			}
+			if key < '@' || key > '_' {
+				return 0, fmt.Errorf("invalid control key '%s'", value)
+			}
+			return key & 0x1f, nil
+		}
+	}
+
+	if len(value) != 1 {
+		return 0, fmt.Errorf("invalid key '%s', expected a single character or ctrl-X", value)
+	}
+	return value[0], nil
+}
+
+// receivesStdin reports whether the command should get rufl's stdin. In
+// sequential mode that is whichever command is running, in parallel mode
+// the first command, or every command with --broadcast-stdin.
+func receivesStdin(cmdInfo CommandInfo) bool {
+	return interactive && (!parallelMode || cmdInfo.Index == 0 || broadcastStdin)
+}
+
+// setStdinTarget makes the given command stdin receive rufl's input, in
+// addition to the other targets with --broadcast-stdin and instead of them
+// otherwise. It returns false if rufl's stdin is already exhausted.
+func setStdinTarget(target io.WriteCloser) bool {
+	stdinMutex.Lock()
+	defer stdinMutex.Unlock()
+
+	if stdinClosed {
+		return false
+	}
+	if broadcastStdin {
+		stdinTargets = append(stdinTargets, target)
+	} else {
+		stdinTargets = []io.WriteCloser{target}
+	}
+	return true
+}
+
+// clearStdinTarget stops forwarding input to the given command stdin
+func clearStdinTarget(target io.WriteCloser) {
+	stdinMutex.Lock()
+	defer stdinMutex.Unlock()
+
+	for i, t := range stdinTargets {
+		if t == target {
+			stdinTargets = append(stdinTargets[:i:i], stdinTargets[i+1:]...)
+			return
+		}
+	}
+}
+
+// stdinWriter returns a writer copying input to all current stdin targets.
+// A command that stopped reading its input must not stop forwarding to it
+// or the others, so write errors are ignored. Must be called with
+// stdinMutex held.
+func stdinWriter() io.Writer {
+	writers := make([]io.Writer, len(stdinTargets))
+	for i, target := range stdinTargets {
+		writers[i] = ignoreErrors{target}
+	}
+	return io.MultiWriter(writers...)
+}
+
+// ignoreErrors is a writer that reports every write as successful
+type ignoreErrors struct {
+	w io.Writer
+}
+
+func (w ignoreErrors) Write(p []byte) (int, error) {
+	_, _ = w.w.Write(p)
+	return len(p), nil
+}
+
+// startStdinForwarding reads rufl's stdin and forwards it to the commands
+// selected by receivesStdin. When an abort key is configured and stdin is
+// a terminal, the terminal is switched to key mode so the key can be
+// intercepted as soon as it is pressed.
+func startStdinForwarding() {
+	if abortKey != 0 {
+		restore, err := enableKeyMode(os.Stdin.Fd())
+		if err != nil {
+			printColoredMessage(fmt.Sprintf("Warning: abort key disabled, stdin is not a terminal: %v", err), colorYellow)
+		} else {
+			restoreTerminal = restore
+		}
+	}
+
+	go forwardStdin(os.Stdin)
+}
+
+// forwardStdin copies input to the current stdin targets until input ends
+func forwardStdin(input io.Reader) {
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := input.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			if restoreTerminal != nil && bytes.IndexByte(chunk, abortKey) >= 0 {
+				printColoredMessage("Abort key pressed. Stopping all commands and exiting...", colorYellow)
+				terminateActiveCommands()
+				shutdownRufl(130)
+			}
+
+			stdinMutex.Lock()
+			_, _ = stdinWriter().Write(chunk)
+			stdinMutex.Unlock()
+		}
+
+		if err != nil {
+			// Let the receiving commands see the end of their input
+			stdinMutex.Lock()
+			stdinClosed = true
+			for _, target := range stdinTargets {
+				_ = target.Close()
+			}
+			stdinTargets = nil
+			stdinMutex.Unlock()
+			return
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseKey tests parsing of key descriptions
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    byte
+		wantErr bool
+	}{
+		{value: "q", want: 'q'},
+		{value: "ctrl-]", want: 0x1d},
+		{value: "ctrl-c", want: 0x03},
+		{value: "Ctrl+Q", want: 0x11},
+		{value: "^x", want: 0x18},
+		{value: "ctrl-1", wantErr: true},
+		{value: "quit", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseKey(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKey(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseKey(%q) = %#x, want %#x", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// nopWriteCloser records writes and whether it was closed
+type nopWriteCloser struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (w *nopWriteCloser) Close() error {
+	w.closed = true
+	return nil
+}
+
+// TestForwardStdin tests that input is forwarded to the target and its end is propagated
+func TestForwardStdin(t *testing.T) {
+	defer func() {
+		stdinTargets = nil
+		stdinClosed = false
+	}()
+
+	target := &nopWriteCloser{}
+	if !setStdinTarget(target) {
+		t.Fatal("setStdinTarget() = false, want true")
+	}
+
+	forwardStdin(strings.NewReader("hello\nworld\n"))
+
+	if target.String() != "hello\nworld\n" {
+		t.Errorf("forwarded input = %q, want %q", target.String(), "hello\nworld\n")
+	}
+	if !target.closed {
+		t.Error("forwardStdin() did not close the target at end of input")
+	}
+	if setStdinTarget(&nopWriteCloser{}) {
+		t.Error("setStdinTarget() = true after stdin was closed, want false")
+	}
+}
+
+// steppedReader returns one chunk per read and calls between before the
+// second chunk
+type steppedReader struct {
+	chunks  []string
+	between func()
+	reads   int
+}
+
+func (r *steppedReader) Read(p []byte) (int, error) {
+	if r.reads == len(r.chunks) {
+		return 0, io.EOF
+	}
+	if r.reads == 1 {
+		r.between()
+	}
+	n := copy(p, r.chunks[r.reads])
+	r.reads++
+	return n, nil
+}
+
+// TestBroadcastStdin tests that input goes to every target while it is registered
+func TestBroadcastStdin(t *testing.T) {
+	oldBroadcastStdin := broadcastStdin
+	broadcastStdin = true
+	defer func() {
+		broadcastStdin = oldBroadcastStdin
+		stdinTargets = nil
+		stdinClosed = false
+	}()
+
+	first, second, late := &nopWriteCloser{}, &nopWriteCloser{}, &nopWriteCloser{}
+	setStdinTarget(first)
+	setStdinTarget(second)
+
+	// The first command stops and another one starts between two reads
+	forwardStdin(&steppedReader{
+		chunks: []string{"one\n", "two\n"},
+		between: func() {
+			clearStdinTarget(first)
+			setStdinTarget(late)
+		},
+	})
+
+	if first.String() != "one\n" || first.closed {
+		t.Errorf("first target got %q (closed %v), want only the input before it was cleared", first.String(), first.closed)
+	}
+	if second.String() != "one\ntwo\n" || !second.closed {
+		t.Errorf("second target got %q (closed %v), want all input and the end of input", second.String(), second.closed)
+	}
+	if late.String() != "two\n" || !late.closed {
+		t.Errorf("late target got %q (closed %v), want the input after it was added", late.String(), late.closed)
+	}
+}
+
+// TestInteractiveCommand tests that a command receives rufl's stdin in interactive mode
+func TestInteractiveCommand(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldInteractive := interactive
+	oldNoColor := noColor
+	interactive = true
+	noColor = true
+	defer func() {
+		interactive = oldInteractive
+		noColor = oldNoColor
+		stdinTargets = nil
+		stdinClosed = false
+	}()
+
+	output := captureStdout(func() {
+		done := make(chan struct{})
+		go func() {
+			executeCommand(CommandInfo{Command: "cat", Tag: "cat"})
+			close(done)
+		}()
+
+		// Only start forwarding once the command is ready to receive input
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			stdinMutex.Lock()
+			ready := len(stdinTargets) > 0
+			stdinMutex.Unlock()
+			if ready || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		forwardStdin(strings.NewReader("from stdin\n"))
+		<-done
+	})
+
+	if !strings.Contains(output, "[cat:out] from stdin") {
+		t.Errorf("executeCommand() output = %q, want forwarded input", output)
+	}
+}
@@ -0,0 +1,12 @@
+//go:build linux
+// +build linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// ioctl requests to read and write terminal attributes
+const (
+	ioctlReadTermios  = unix.TCGETS
+	ioctlWriteTermios = unix.TCSETS
+)
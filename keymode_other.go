@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !windows
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!windows
+
+package main
+
+import "errors"
+
+// enableKeyMode is not supported on this platform
+func enableKeyMode(fd uintptr) (func(), error) {
+	return nil, errors.New("reading single key presses is not supported on this platform")
+}
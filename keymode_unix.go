@@ -0,0 +1,32 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// enableKeyMode switches the terminal to non-canonical mode so that single
+// key presses can be read without waiting for Enter. Echo, signal keys and
+// output processing are left untouched. It returns a function restoring the
+// previous terminal state.
+func enableKeyMode(fd uintptr) (func(), error) {
+	oldState, err := unix.IoctlGetTermios(int(fd), ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	newState := *oldState
+	newState.Lflag &^= unix.ICANON
+	newState.Cc[unix.VMIN] = 1
+	newState.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(int(fd), ioctlWriteTermios, &newState); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		_ = unix.IoctlSetTermios(int(fd), ioctlWriteTermios, oldState)
+	}, nil
+}
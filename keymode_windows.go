@@ -0,0 +1,28 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"golang.org/x/sys/windows"
+)
+
+// enableKeyMode switches the console to read single key presses without
+// waiting for Enter. Ctrl+C handling is left to the system. It returns a
+// function restoring the previous console mode.
+func enableKeyMode(fd uintptr) (func(), error) {
+	handle := windows.Handle(fd)
+	var oldMode uint32
+	if err := windows.GetConsoleMode(handle, &oldMode); err != nil {
+		return nil, err
+	}
+
+	newMode := oldMode &^ (windows.ENABLE_LINE_INPUT | windows.ENABLE_ECHO_INPUT)
+	if err := windows.SetConsoleMode(handle, newMode); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		_ = windows.SetConsoleMode(handle, oldMode)
+	}, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var (
+	// Make commands line-buffer their stdout and stderr with stdbuf
+	// (--line-buffer-child)
+	lineBufferChild bool
+	// Path of stdbuf, or of gstdbuf on macOS, empty if it was not found
+	stdbufPath string
+)
+
+// findStdbuf looks for stdbuf in PATH, and for gstdbuf, the name GNU
+// coreutils installs it under on macOS
+func findStdbuf() (string, error) {
+	for _, name := range []string{"stdbuf", "gstdbuf"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("stdbuf was not found in PATH")
+}
+
+// lineBuffered makes a command run through stdbuf -oL -eL, so programs that
+// buffer their output when it is not a terminal print it line by line. It
+// works for programs using the C library's stdio, and the shell passes it
+// on to the programs it runs. Commands whose program was not found are left
+// as they are, so the error still names the program.
+func lineBuffered(cmd *exec.Cmd) {
+	if !lineBufferChild || stdbufPath == "" || cmd.Err != nil {
+		return
+	}
+	args := append([]string{"stdbuf", "-oL", "-eL", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path, cmd.Args = stdbufPath, args
+}
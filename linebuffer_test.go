@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestLineBuffered tests that commands are wrapped in stdbuf only when it can run them
+func TestLineBuffered(t *testing.T) {
+	oldLineBufferChild, oldStdbufPath := lineBufferChild, stdbufPath
+	defer func() { lineBufferChild, stdbufPath = oldLineBufferChild, oldStdbufPath }()
+
+	lineBufferChild, stdbufPath = true, "/usr/bin/stdbuf"
+	cmd := &exec.Cmd{Path: "/bin/sh", Args: []string{"sh", "-c", "make"}}
+	lineBuffered(cmd)
+	if want := []string{"stdbuf", "-oL", "-eL", "/bin/sh", "-c", "make"}; cmd.Path != "/usr/bin/stdbuf" || !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("lineBuffered() = %s %q, want /usr/bin/stdbuf %q", cmd.Path, cmd.Args, want)
+	}
+
+	// A program that was not found keeps its own error
+	cmd = exec.Command("surely-not-a-program-rufl")
+	lineBuffered(cmd)
+	if cmd.Args[0] != "surely-not-a-program-rufl" {
+		t.Errorf("lineBuffered() wrapped a missing program: %q", cmd.Args)
+	}
+
+	stdbufPath = ""
+	cmd = &exec.Cmd{Path: "/bin/sh", Args: []string{"sh"}}
+	lineBuffered(cmd)
+	if cmd.Path != "/bin/sh" {
+		t.Errorf("lineBuffered() without stdbuf changed the command to %s", cmd.Path)
+	}
+}
+
+// TestRunCommandLineBuffered tests that commands run line-buffered with --line-buffer-child
+func TestRunCommandLineBuffered(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+	path, err := findStdbuf()
+	if err != nil {
+		t.Skip("stdbuf is not installed")
+	}
+
+	oldLineBufferChild, oldStdbufPath, oldNoColor := lineBufferChild, stdbufPath, noColor
+	lineBufferChild, stdbufPath, noColor = true, path, true
+	defer func() { lineBufferChild, stdbufPath, noColor = oldLineBufferChild, oldStdbufPath, oldNoColor }()
+
+	// stdbuf tells the C library of the command how to buffer through the environment
+	output := captureStdout(func() {
+		runCommand(CommandInfo{Command: "env | grep _STDBUF_", Tag: "env"}, nil)
+	})
+	for _, want := range []string{"_STDBUF_O=L", "_STDBUF_E=L"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("runCommand() output = %q, want %s", output, want)
+		}
+	}
+}
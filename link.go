@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	// Raw --tag-link values (TAG:URL)
+	tagLinkFlags []string
+	// URLs the prefixes of tags link to
+	tagLinks = map[string]string{}
+	// Whether the terminal is expected to understand OSC 8 hyperlinks
+	hyperlinksSupported bool
+)
+
+// parseTagLinks parses TAG:URL values into a map of tag names to URLs. Only
+// the first colon separates the tag, so URLs keep their scheme.
+func parseTagLinks(values []string) (map[string]string, error) {
+	links := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid tag link '%s', expected 'TAG:URL'", value)
+		}
+		links[finalTag(parts[0])] = parts[1]
+	}
+	return links, nil
+}
+
+// detectHyperlinks reports whether output goes to a terminal that can show
+// OSC 8 hyperlinks. Terminals without support ignore the sequence, but files
+// and pipes would keep it, as would the "dumb" terminal of editors.
+func detectHyperlinks() bool {
+	return !noColor && isTerminal(os.Stdout.Fd()) && os.Getenv("TERM") != "dumb"
+}
+
+// linkPrefix wraps the prefix of a tag with a --tag-link in an OSC 8
+// hyperlink, leaving the separating space outside of the link
+func linkPrefix(tag string, prefix string) string {
+	url, ok := tagLinks[tag]
+	if !ok || !hyperlinksSupported {
+		return prefix
+	}
+	text := strings.TrimSuffix(prefix, " ")
+	return "\x1b]8;;" + url + "\x1b\\" + text + "\x1b]8;;\x1b\\" + prefix[len(text):]
+}
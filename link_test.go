@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseTagLinks tests parsing of --tag-link values
+func TestParseTagLinks(t *testing.T) {
+	got, err := parseTagLinks([]string{"build:file:///tmp/build.log", "docs:https://example.com/docs"})
+	if err != nil {
+		t.Fatalf("parseTagLinks() error = %v", err)
+	}
+	want := map[string]string{"build": "file:///tmp/build.log", "docs": "https://example.com/docs"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTagLinks() = %q, want %q", got, want)
+	}
+
+	for _, invalid := range []string{"build", ":https://example.com", "build:"} {
+		if _, err := parseTagLinks([]string{invalid}); err == nil {
+			t.Errorf("parseTagLinks(%q) expected an error", invalid)
+		}
+	}
+}
+
+// TestLinkPrefix tests wrapping prefixes in OSC 8 hyperlinks only when supported
+func TestLinkPrefix(t *testing.T) {
+	oldLinks := tagLinks
+	oldSupported := hyperlinksSupported
+	tagLinks = map[string]string{"build": "file:///tmp/build.log"}
+	defer func() {
+		tagLinks = oldLinks
+		hyperlinksSupported = oldSupported
+	}()
+
+	hyperlinksSupported = true
+	want := "\x1b]8;;file:///tmp/build.log\x1b\\[build]\x1b]8;;\x1b\\ "
+	if got := linkPrefix("build", "[build] "); got != want {
+		t.Errorf("linkPrefix() = %q, want %q", got, want)
+	}
+	if got := linkPrefix("test", "[test] "); got != "[test] " {
+		t.Errorf("linkPrefix() of a tag without a link = %q", got)
+	}
+	if got := visibleWidth(linkPrefix("build", colorGreen+"[build] "+colorReset)); got != 8 {
+		t.Errorf("visibleWidth() of a linked prefix = %d, want 8", got)
+	}
+
+	hyperlinksSupported = false
+	if got := linkPrefix("build", "[build] "); got != "[build] " {
+		t.Errorf("linkPrefix() without hyperlink support = %q, want the plain prefix", got)
+	}
+}
+
+// TestProcessOutputTagLink tests that output lines of a linked tag carry the hyperlink
+func TestProcessOutputTagLink(t *testing.T) {
+	oldNoColor := noColor
+	oldLinks := tagLinks
+	oldSupported := hyperlinksSupported
+	noColor = true
+	tagLinks = map[string]string{"build": "https://ci.example.com/build"}
+	hyperlinksSupported = true
+	defer func() {
+		noColor = oldNoColor
+		tagLinks = oldLinks
+		hyperlinksSupported = oldSupported
+	}()
+
+	output := captureStdout(func() {
+		processOutput(strings.NewReader("compiling\n"), "build", "out", colorGreen)
+	})
+
+	want := "\x1b]8;;https://ci.example.com/build\x1b\\[build:out]\x1b]8;;\x1b\\ compiling\n"
+	if output != want {
+		t.Errorf("processOutput() = %q, want %q", output, want)
+	}
+}
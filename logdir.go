@@ -0,0 +1,153 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	// Directory to write the output of each command to as TAG.log (--log-dir)
+	logDir string
+	// Keep escape sequences such as colors in the files rufl writes output to
+	keepANSIInFiles bool
+	// Write the files in --log-dir gzip-compressed, as TAG.log.gz
+	compressLogs bool
+	// Log file of each tag, opened with the tag's first line
+	logFiles = make(map[string]io.Writer)
+	// Compressors and files to close once the run is over, in order
+	logClosers []io.Closer
+	// Set once rufl is exiting, after which output is no longer logged
+	logsClosed bool
+	// Mutex guarding logFiles, logClosers and logsClosed and serializing
+	// writes to the log files
+	logMutex sync.Mutex
+)
+
+// ansiStripWriter removes escape sequences from everything written to it,
+// so files stay readable in editors and pagers. Each write must contain
+// whole escape sequences, as lines of output do.
+type ansiStripWriter struct {
+	w io.Writer
+}
+
+func (s ansiStripWriter) Write(p []byte) (int, error) {
+	if _, err := s.w.Write(ansiPattern.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// fileWriter returns the writer to use for output going to a file, which
+// strips escape sequences unless --keep-ansi-in-files is given
+func fileWriter(w io.Writer) io.Writer {
+	if keepANSIInFiles {
+		return w
+	}
+	return ansiStripWriter{w: w}
+}
+
+// setupLogDir creates the directory selected with --log-dir
+func setupLogDir() error {
+	if logDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return fmt.Errorf("creating log directory: %w", err)
+	}
+	return nil
+}
+
+// logFileName returns the name of the log file of a tag, with characters
+// that cannot be used in file names replaced
+func logFileName(tag string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, tag)
+	return name + ".log"
+}
+
+// openLogFile opens the log file of a tag for appending. With
+// --compress-logs, the output is compressed into TAG.log.gz; every run
+// appends a gzip member of its own, which gzip -d reads as one file.
+// Must be called with logMutex held.
+func openLogFile(tag string) (io.Writer, error) {
+	path := filepath.Join(logDir, logFileName(tag))
+	if compressLogs {
+		path += ".gz"
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if !compressLogs {
+		logClosers = append(logClosers, file)
+		return file, nil
+	}
+
+	compressor := gzip.NewWriter(file)
+	logClosers = append(logClosers, compressor, file)
+	return compressor, nil
+}
+
+// closeLogFiles flushes and closes the log files. Output logged after it,
+// such as that of the exit trap, opens them again.
+func closeLogFiles() {
+	logMutex.Lock()
+	defer logMutex.Unlock()
+
+	for _, closer := range logClosers {
+		if err := closer.Close(); err != nil {
+			printColoredMessage(fmt.Sprintf("Error closing log file: %v", err), colorRed)
+		}
+	}
+	logClosers = nil
+	logFiles = make(map[string]io.Writer)
+}
+
+// closeLogFilesAtExit closes the log files for good when rufl exits. Output
+// of commands that is still being read is no longer logged, as files opened
+// for it again would never be closed, leaving compressed logs truncated.
+func closeLogFilesAtExit() {
+	logMutex.Lock()
+	logsClosed = true
+	logMutex.Unlock()
+
+	closeLogFiles()
+}
+
+// logOutputLine appends a line of a command's output to the command's file
+// in --log-dir. Lines are logged whether or not they are printed.
+func logOutputLine(tag string, line string) {
+	if logDir == "" {
+		return
+	}
+
+	logMutex.Lock()
+	defer logMutex.Unlock()
+	if logsClosed {
+		return
+	}
+
+	w, ok := logFiles[tag]
+	if !ok {
+		file, err := openLogFile(tag)
+		if err != nil {
+			// Reported once, the command's output is still printed
+			printCommandMessage(tag, fmt.Sprintf("Error opening log file: %v", err), colorRed)
+			w = io.Discard
+		} else {
+			w = fileWriter(file)
+		}
+		logFiles[tag] = w
+	}
+	_, _ = io.WriteString(w, line+"\n")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFileWriter tests that escape sequences are stripped from file output unless kept
+func TestFileWriter(t *testing.T) {
+	oldKeep := keepANSIInFiles
+	defer func() { keepANSIInFiles = oldKeep }()
+
+	input := "\x1b[1;31merror\x1b[0m: \x1b]8;;http://x\x07link\x1b]8;;\x07\n"
+	for _, tt := range []struct {
+		keep bool
+		want string
+	}{
+		{false, "error: link\n"},
+		{true, input},
+	} {
+		keepANSIInFiles = tt.keep
+		var buf bytes.Buffer
+		n, err := io.WriteString(fileWriter(&buf), input)
+		if err != nil || n != len(input) {
+			t.Errorf("Write() = (%d, %v), want (%d, nil)", n, err, len(input))
+		}
+		if buf.String() != tt.want {
+			t.Errorf("fileWriter() with keep=%v wrote %q, want %q", tt.keep, buf.String(), tt.want)
+		}
+	}
+}
+
+// TestLogFileName tests that tags are turned into safe file names
+func TestLogFileName(t *testing.T) {
+	for tag, want := range map[string]string{
+		"build":        "build.log",
+		"ci/test":      "ci_test.log",
+		`win:c\dir`:    "win_c_dir.log",
+		"web server 1": "web server 1.log",
+	} {
+		if got := logFileName(tag); got != want {
+			t.Errorf("logFileName(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+// TestLogDir tests that every line of a command's output ends up in its log file without colors
+func TestLogDir(t *testing.T) {
+	oldDir, oldFiles, oldNoColor, oldGrep := logDir, logFiles, noColor, grepPatterns
+	logDir = t.TempDir()
+	logFiles = make(map[string]io.Writer)
+	noColor = true
+	grepPatterns = []string{"kept"}
+	defer func() {
+		logDir, logFiles, noColor, grepPatterns = oldDir, oldFiles, oldNoColor, oldGrep
+		setupFilters()
+	}()
+	if err := setupFilters(); err != nil {
+		t.Fatalf("setupFilters() error = %v", err)
+	}
+
+	output := captureStdout(func() {
+		processCommandOutput(strings.NewReader("\x1b[32mkept\x1b[0m\nfiltered\n"), "build", "out", colorGreen, time.Now(), nil)
+	})
+
+	data, err := os.ReadFile(filepath.Join(logDir, "build.log"))
+	if err != nil {
+		t.Fatalf("reading log file: %v", err)
+	}
+	if got, want := string(data), "kept\nfiltered\n"; got != want {
+		t.Errorf("log file = %q, want %q", got, want)
+	}
+	if !strings.Contains(output, "\x1b[32mkept") {
+		t.Errorf("output = %q, want colors kept on the terminal", output)
+	}
+}
+
+// TestLogDirCompressed tests that --compress-logs writes gzip files that are complete once closed
+func TestLogDirCompressed(t *testing.T) {
+	oldDir, oldFiles, oldClosers, oldCompress, oldNoColor := logDir, logFiles, logClosers, compressLogs, noColor
+	logDir, logFiles, logClosers, compressLogs, noColor = t.TempDir(), make(map[string]io.Writer), nil, true, true
+	defer func() {
+		logDir, logFiles, logClosers, compressLogs, noColor = oldDir, oldFiles, oldClosers, oldCompress, oldNoColor
+	}()
+
+	// A second run appends a gzip member of its own
+	for _, input := range []string{"one\ntwo\n", "three\n"} {
+		captureStdout(func() {
+			processCommandOutput(strings.NewReader(input), "ci/build", "out", colorGreen, time.Now(), nil)
+		})
+		closeLogFiles()
+	}
+
+	file, err := os.Open(filepath.Join(logDir, "ci_build.log.gz"))
+	if err != nil {
+		t.Fatalf("opening compressed log file: %v", err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading compressed log file: %v", err)
+	}
+	if got, want := string(data), "one\ntwo\nthree\n"; got != want {
+		t.Errorf("compressed log file = %q, want %q", got, want)
+	}
+}
+
+// TestLogDirClosedAtExit tests that output arriving after the log files were
+// closed for exit is not logged, so compressed files stay complete
+func TestLogDirClosedAtExit(t *testing.T) {
+	oldDir, oldFiles, oldClosers, oldCompress, oldNoColor := logDir, logFiles, logClosers, compressLogs, noColor
+	logDir, logFiles, logClosers, compressLogs, noColor = t.TempDir(), make(map[string]io.Writer), nil, true, true
+	defer func() {
+		logDir, logFiles, logClosers, compressLogs, noColor = oldDir, oldFiles, oldClosers, oldCompress, oldNoColor
+		logsClosed = false
+	}()
+
+	logOutputLine("build", "before")
+	closeLogFilesAtExit()
+	logOutputLine("build", "after")
+
+	if len(logClosers) != 0 {
+		t.Errorf("logOutputLine() opened %d files after exit, want none", len(logClosers))
+	}
+
+	file, err := os.Open(filepath.Join(logDir, "build.log.gz"))
+	if err != nil {
+		t.Fatalf("opening compressed log file: %v", err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("reading compressed log file: %v", err)
+	}
+	if got, want := string(data), "before\n"; got != want {
+		t.Errorf("compressed log file = %q, want %q", got, want)
+	}
+}
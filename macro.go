@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	// Macros as NAME=COMMAND;COMMAND (--macro)
+	macroFlags []string
+	// Commands of each macro, parsed from --macro
+	macros map[string][]string
+)
+
+// parseMacros parses NAME=COMMAND;COMMAND values into a map of macro names
+// to their commands. A literal semicolon is written as \;. Every macro is
+// expanded once, so cycles and unknown macros are found before anything runs.
+func parseMacros(values []string) (map[string][]string, error) {
+	parsed := make(map[string][]string)
+	for _, value := range values {
+		name, body, ok := strings.Cut(value, "=")
+		if !ok || name == "" || strings.ContainsAny(name, " \t@") {
+			return nil, fmt.Errorf("invalid macro '%s', expected 'NAME=COMMAND;COMMAND'", value)
+		}
+
+		commands := splitMacroBody(body)
+		if len(commands) == 0 {
+			return nil, fmt.Errorf("macro '%s' has no commands", name)
+		}
+		parsed[name] = commands
+	}
+
+	for name := range parsed {
+		if _, err := expandMacro(parsed, name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return parsed, nil
+}
+
+// splitMacroBody splits the body of a macro into its commands at semicolons
+// that are not escaped, leaving out empty commands
+func splitMacroBody(body string) []string {
+	var commands []string
+	var current strings.Builder
+	add := func() {
+		if command := strings.TrimSpace(current.String()); command != "" {
+			commands = append(commands, command)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && i+1 < len(body) && body[i+1] == ';':
+			current.WriteByte(';')
+			i++
+		case body[i] == ';':
+			add()
+		default:
+			current.WriteByte(body[i])
+		}
+	}
+	add()
+	return commands
+}
+
+// expandMacro returns the commands of a macro, with references to other
+// macros replaced by their commands. stack holds the macros being expanded,
+// to report cycles.
+func expandMacro(defined map[string][]string, name string, stack []string) ([]string, error) {
+	for i, expanding := range stack {
+		if expanding == name {
+			cycle := append(slices.Clone(stack[i:]), name)
+			return nil, fmt.Errorf("macro cycle: @%s", strings.Join(cycle, " -> @"))
+		}
+	}
+
+	commands, ok := defined[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown macro '@%s'", name)
+	}
+
+	stack = append(stack, name)
+	var expanded []string
+	for _, command := range commands {
+		if !strings.HasPrefix(command, "@") {
+			expanded = append(expanded, command)
+			continue
+		}
+		nested, err := expandMacro(defined, command[1:], stack)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, nested...)
+	}
+	return expanded, nil
+}
+
+// expandMacroArgs replaces @NAME arguments with the commands of the macro.
+// Without any --macro, arguments are left as they are.
+func expandMacroArgs(args []string) ([]string, error) {
+	if len(macros) == 0 {
+		return args, nil
+	}
+
+	var expanded []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "@") {
+			expanded = append(expanded, arg)
+			continue
+		}
+		commands, err := expandMacro(macros, arg[1:], nil)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, commands...)
+	}
+	return expanded, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseMacros tests parsing --macro values, nested macros and cycles
+func TestParseMacros(t *testing.T) {
+	got, err := parseMacros([]string{
+		`lint=golangci-lint run; go vet ./...`,
+		`check=@lint;go test ./...`,
+		`loop=for i in 1 2\; do echo $i\; done`,
+	})
+	if err != nil {
+		t.Fatalf("parseMacros() error = %v", err)
+	}
+	want := map[string][]string{
+		"lint":  {"golangci-lint run", "go vet ./..."},
+		"check": {"@lint", "go test ./..."},
+		"loop":  {"for i in 1 2; do echo $i; done"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMacros() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{values: []string{"lint"}, want: "invalid macro"},
+		{values: []string{"=make"}, want: "invalid macro"},
+		{values: []string{"lint= ; "}, want: "has no commands"},
+		{values: []string{"all=@lint;make"}, want: "unknown macro '@lint'"},
+		{values: []string{"a=@b", "b=make;@c", "c=@a"}, want: "macro cycle: @"},
+		{values: []string{"self=@self"}, want: "macro cycle: @self -> @self"},
+	}
+	for _, tt := range tests {
+		if _, err := parseMacros(tt.values); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("parseMacros(%q) error = %v, want %q", tt.values, err, tt.want)
+		}
+	}
+}
+
+// TestProcessCommandsMacros tests that @NAME arguments expand into their commands
+func TestProcessCommandsMacros(t *testing.T) {
+	oldMacros, oldTags := macros, tags
+	defer func() { macros, tags = oldMacros, oldTags }()
+
+	var err error
+	macros, err = parseMacros([]string{"lint=golangci-lint run;go vet ./...", "ci=@lint;+test:go test ./..."})
+	if err != nil {
+		t.Fatalf("parseMacros() error = %v", err)
+	}
+	tags = []string{}
+
+	got := processCommands([]string{"@ci", "make build"})
+	want := []CommandInfo{
+		{Command: "golangci-lint run", Tag: "1", Index: 0},
+		{Command: "go vet ./...", Tag: "2", Index: 1},
+		{Command: "make build", Tag: "3", Index: 2},
+		{Command: "go test ./...", Tag: "test", Index: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with macros = %v, want %v", got, want)
+	}
+}
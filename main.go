@@ -2,18 +2,30 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
+	"regexp"
 	"runtime"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/anmitsu/go-shlex"
+	"github.com/mattn/go-runewidth"
 	"github.com/spf13/cobra"
 )
 
@@ -26,8 +38,29 @@ const (
 	colorBlue   = "\033[34m"
 	colorPurple = "\033[35m"
 	colorCyan   = "\033[36m"
+	colorDim    = "\033[2m"
 )
 
+// ruflMarker starts rufl's own status messages to tell them apart from command output
+const ruflMarker = "rufl: "
+
+// colorNames maps the color names accepted on the command line to ANSI codes
+var colorNames = map[string]string{
+	"red":     colorRed,
+	"green":   colorGreen,
+	"yellow":  colorYellow,
+	"blue":    colorBlue,
+	"purple":  colorPurple,
+	"magenta": colorPurple,
+	"cyan":    colorCyan,
+}
+
+// Default size of the buffer used to read command output
+const defaultBufferSize = 64 * 1024
+
+// How often batched output is written out
+const batchInterval = 100 * time.Millisecond
+
 var (
 	// Flag to disable colored output
 	noColor bool
@@ -47,8 +80,104 @@ var (
 	lastSigIntTime time.Time
 	// Currently running command in sequential mode
 	currentSequentialCmd *exec.Cmd
-	// Mutex to protect currentSequentialCmd
+	// Set when the user interrupted the current sequential command
+	currentCmdInterrupted bool
+	// Mutex to protect currentSequentialCmd and currentCmdInterrupted
 	currentCmdMutex sync.Mutex
+	// Raw value of the --buffer-size flag
+	bufferSizeFlag string
+	// Size of the buffer used to read command output
+	bufferSize = defaultBufferSize
+	// rufl variables expanded in command strings (format: NAME=VALUE)
+	vars []string
+	// Ask for confirmation before running the commands
+	confirm bool
+	// List the commands without running them
+	dryRun bool
+	// Skip empty commands instead of failing
+	skipEmpty bool
+	// Run each command string only once
+	dedupeCommands bool
+	// Interval for "still running" messages, 0 disables them
+	keepalive time.Duration
+	// Run commands attached to a pseudo-terminal
+	usePTY bool
+	// Line printed between output blocks of different commands
+	prefixSeparator string
+	// Mutex serializing writes to stdout
+	outputMutex sync.Mutex
+	// Tag of the command that printed the last output line
+	lastOutputSource string
+	// Print the prefix only when the output source changes
+	prefixOnce bool
+	// Command and stream of the last output line, for --prefix-once
+	lastPrefixSource string
+	// Write each output line immediately instead of batching
+	flushLines bool
+	// Buffer collecting output when it is batched, nil otherwise
+	batchWriter *bufio.Writer
+	// Set once writing to stdout failed because its reader went away
+	stdoutBroken bool
+	// Keep running and discard output when stdout is closed by its reader
+	ignoreBrokenPipe bool
+	// Raw values of the --tag-color flag (format: TAG:COLOR)
+	tagColorFlags []string
+	// Prefix colors pinned to specific tags
+	tagColors = map[string]string{}
+	// Raw values of the --tag-icon flag (format: TAG:ICON)
+	tagIconFlags []string
+	// Icons shown before the prefix of specific tags
+	tagIcons = map[string]string{}
+	// Terminal width of the widest icon, used to keep prefixes aligned
+	tagIconWidth int
+	// Timestamp mode for output lines: none, wall or relative
+	timestampMode string
+	// Show how long the command has been running in the prefix of its lines
+	commandElapsed bool
+	// Include the stream type in the prefix even when color is enabled
+	alwaysShowStream bool
+	// When rufl started, used for relative timestamps (monotonic)
+	ruflStartTime = time.Now()
+	// Do not print the final one-line summary
+	noBanner bool
+	// Read stdout and stderr through a single pipe to keep their order
+	mergeStreams bool
+	// Print the arguments each command is executed with
+	printArgv bool
+	// Color the content of output lines like their prefix
+	colorWholeLine bool
+	// Lowercase tags and replace whitespace and slashes with dashes
+	normalizeTags bool
+	// Namespace put in front of every tag, e.g. "ci/"
+	tagPrefix string
+	// Write prefixed output and status messages to stderr, keeping stdout raw
+	prefixToStderr bool
+	// Do not start rufl's own status messages with the rufl marker
+	noRuflMarker bool
+	// How command output is split into records: line, word or null
+	splitMode string
+	// Base64-encoded commands (--cmd-b64)
+	base64Commands []string
+	// Positional commands are percent-encoded (--cmd-enc)
+	percentEncoded bool
+	// Multi-line scripts, inline or as @FILE (--script)
+	scripts []string
+	// When to restart commands that exit: no, always, on-failure or on-success
+	restartPolicy string
+	// Delay before restarting a command
+	restartDelay time.Duration
+	// Maximum number of restarts per command, 0 means unlimited
+	maxRestarts int
+	// Maximum number of commands running at once in parallel mode, 0 means unlimited
+	maxParallel int
+	// Stop launching new commands once this many have failed, 0 disables it
+	haltAfter int
+	// How long to wait for commands to exit after asking them to stop
+	haltTimeout time.Duration
+	// Set when rufl is exiting, so no new commands are launched
+	shuttingDown atomic.Bool
+	// Commands of the current parallel run that are done, nil outside of one
+	runProgress *doneCounter
 )
 
 // CommandInfo holds information about a command to be executed
@@ -56,6 +185,71 @@ type CommandInfo struct {
 	Command string
 	Tag     string
 	Index   int
+	// Host to run the command on over ssh, empty to run it locally
+	Host string
+	// Commands with a higher priority are launched first in parallel mode
+	Priority int
+	// Prefix color of the command's output, empty for the default colors
+	Color string
+	// Scheduling niceness of the command, 0 to inherit rufl's
+	Nice int
+	// Working directory of the command, set with @dir=, empty for --chdir
+	// or rufl's own
+	Dir string
+	// Start the command in the background without waiting for it
+	Detach bool
+	// In sequential mode, only run the command if an earlier one had this
+	// outcome: "success" or "failure", empty to always run it
+	RunIf string
+	// Tag of the command RunIf refers to, empty for the previous one
+	RunIfTag string
+	// In parallel mode, wait this long before launching the command
+	Delay time.Duration
+	// File descriptors above stderr sent to files, as in +trace{3>trace.log}:cmd
+	Redirects []fdRedirect
+	// Container image to run the command in, empty to run it directly
+	Image string
+	// Number of --max-parallel slots the command takes, 0 for one
+	Weight int
+	// Extra environment variables set by rufl, such as RUFL_PREV_EXIT
+	Env []string
+	// Character encoding of the command's output, empty for --input-encoding
+	Encoding string
+	// How long the command may run before it is stopped, 0 for --timeout
+	Timeout time.Duration
+}
+
+// CommandResult holds the outcome of an executed command
+type CommandResult struct {
+	Tag      string
+	Command  string
+	ExitCode int
+	Success  bool
+	TimedOut bool
+	// Skipped is set for commands that were never started
+	Skipped  bool
+	Duration time.Duration
+	Restarts int
+	// Niceness the command ran with, 0 if it was not changed
+	Nice int
+	// CPU time the command and its waited-for children used
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// Detached is set for commands left running in the background
+	Detached bool
+	// Unmet is set for skipped commands whose ?success or ?failure
+	// condition was not met
+	Unmet bool
+	// MissingOutput is set for commands that did not print what --expect
+	// requires
+	MissingOutput bool
+}
+
+// outputStream is a source of command output along with how to label it
+type outputStream struct {
+	reader     io.Reader
+	streamType string
+	color      string
 }
 
 // shellSpecialChars contains characters that typically require a shell to interpret
@@ -69,7 +263,20 @@ func main() {
 
 	// Set up signal handling
 	setupSignalHandling()
+	catchBrokenPipe()
 
+	err := newRootCmd().Execute()
+	closeRecording()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// newRootCmd builds the rufl command with its flags and the parallel and
+// sequential subcommands. Flags may be mixed with commands; everything after
+// "--" is taken as a command, even when it starts with a dash.
+func newRootCmd() *cobra.Command {
 	var rootCmd = &cobra.Command{
 		Use:   "rufl",
 		Short: "RunFlow - Run commands in parallel or sequentially",
@@ -84,14 +291,139 @@ Examples:
   rufl p -t "greeting:echo hello" -t "hosts:cat /etc/hosts" -t "loop:while true; do echo hello; sleep 1; done"
   
   # Tag commands with names using + syntax
-  rufl p "+greeting:echo hello" "+hosts:cat /etc/hosts" "+loop:while true; do echo hello; sleep 1; done"`,
+  rufl p "+greeting:echo hello" "+hosts:cat /etc/hosts" "+loop:while true; do echo hello; sleep 1; done"
+
+  # Pass commands that look like flags after --
+  rufl p --no-color -- "-weird-tool --flag" "echo hello"`,
 	}
 
 	// Global flags
 	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output")
+	rootCmd.PersistentFlags().BoolVar(&autoDefaults, "auto", false, "Pick defaults from the terminal: color and --pty when interactive, no color and --merge-streams when piped")
 	rootCmd.PersistentFlags().StringArrayVarP(&envVars, "env", "e", []string{}, "Set additional environment variables (format: KEY=VALUE)")
+	rootCmd.PersistentFlags().StringVarP(&workDir, "chdir", "C", "", "Run all commands in this directory")
+	rootCmd.PersistentFlags().BoolVar(&noInheritEnv, "no-inherit-env", false, "Start commands with an empty environment instead of rufl's own")
+	rootCmd.PersistentFlags().StringArrayVar(&requiredPrograms, "require", []string{}, "Abort before running anything unless these comma-separated programs are found in PATH (e.g. \"go,npm,docker\")")
+	rootCmd.PersistentFlags().StringArrayVar(&inheritPatterns, "inherit", []string{}, "Only pass on environment variables whose names match these comma-separated globs (e.g. \"GO*,HOME,PATH\")")
+	rootCmd.PersistentFlags().IntVar(&commandCount, "count", 0, "Run this many copies of each command, replacing {i} with the copy's index and {n} with the count")
 	rootCmd.PersistentFlags().StringArrayVarP(&tags, "tag", "t", []string{}, "Tag a command with a name (format: NAME:COMMAND)")
 	rootCmd.PersistentFlags().BoolVar(&forceShell, "shell", false, "Force the use of a shell for all commands")
+	rootCmd.PersistentFlags().StringArrayVar(&vars, "var", []string{}, "Define a variable expanded as $NAME or ${NAME} in commands (format: NAME=VALUE)")
+	rootCmd.PersistentFlags().StringArrayVar(&waitForFlags, "wait-for", []string{}, "In sequential mode, wait before each step until this probe succeeds: tcp://HOST:PORT or http(s)://URL")
+	rootCmd.PersistentFlags().DurationVar(&waitTimeout, "wait-timeout", 30*time.Second, "How long to wait for --wait-for probes before skipping the remaining steps")
+	rootCmd.PersistentFlags().DurationVar(&waitInterval, "wait-interval", 500*time.Millisecond, "How often to try the --wait-for probes")
+	rootCmd.PersistentFlags().StringArrayVar(&detachTags, "detach", []string{}, "Run the command with this tag in the background without waiting for it (like +TAG&:COMMAND)")
+	rootCmd.PersistentFlags().BoolVar(&waitDetached, "wait-detached", false, "Wait for detached commands at the end of the run instead of stopping them")
+	rootCmd.PersistentFlags().BoolVar(&strict, "strict", false, "Treat warnings about the commands, such as invalid tag modifiers, as errors")
+	rootCmd.PersistentFlags().BoolVar(&skipEmpty, "skip-empty", false, "Skip empty or whitespace-only commands with a warning instead of failing")
+	rootCmd.PersistentFlags().BoolVar(&dedupeCommands, "dedupe-commands", false, "Run identical commands only once, keeping the first or the one with an explicit tag")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "List the commands that would run without running them")
+	rootCmd.PersistentFlags().BoolVar(&confirm, "confirm", false, "List the commands and ask for confirmation before running them")
+	rootCmd.PersistentFlags().DurationVar(&keepalive, "keepalive", 0, "Print a status line at this interval while commands are running (e.g. 30s)")
+	rootCmd.PersistentFlags().BoolVar(&usePTY, "pty", false, "Run each command in a pseudo-terminal so it produces interactive/colored output (Unix only)")
+	rootCmd.PersistentFlags().StringVar(&prefixSeparator, "prefix-separator", "", "Print this line between output blocks of different commands")
+	rootCmd.PersistentFlags().StringVar(&restartPolicy, "restart", "no", "Restart commands when they exit: no, always, on-failure or on-success")
+	rootCmd.PersistentFlags().DurationVar(&restartDelay, "restart-delay", time.Second, "Delay before restarting a command")
+	rootCmd.PersistentFlags().IntVar(&maxRestarts, "max-restarts", 0, "Maximum number of restarts per command (0 means unlimited)")
+	rootCmd.PersistentFlags().BoolVar(&barrier, "barrier", false, "In parallel mode, pass commands a barrier on fd 3 (RUFL_BARRIER_FD) that reaches EOF once all of them have started")
+	rootCmd.PersistentFlags().StringArrayVar(&delayTagFlags, "delay-tag", []string{}, "In parallel mode, launch the command with this tag later (format: TAG=DURATION, e.g. web=3s, like +TAG@delay=3s:COMMAND)")
+	rootCmd.PersistentFlags().StringArrayVar(&weightTagFlags, "weight-tag", []string{}, "Make the command with this tag take N --max-parallel slots (format: TAG=N, e.g. compile=4, like +TAG@weight=4:COMMAND)")
+	rootCmd.PersistentFlags().IntVarP(&maxParallel, "max-parallel", "j", 0, "Maximum number of commands running at once in parallel mode (0 means unlimited)")
+	rootCmd.PersistentFlags().DurationVar(&commandTimeout, "timeout", 0, "Stop a command that runs longer than this (e.g. 10m), sending SIGTERM first")
+	rootCmd.PersistentFlags().DurationVar(&idleTimeout, "idle-timeout", 0, "Stop a command that prints no output for this long (e.g. 30s), sending SIGTERM first")
+	rootCmd.PersistentFlags().DurationVar(&timeoutKillGrace, "timeout-kill-grace", 5*time.Second, "How long a timed out command has to exit after SIGTERM before it is killed")
+	rootCmd.PersistentFlags().DurationVar(&haltTimeout, "halt-timeout", 5*time.Second, "On a signal, how long to wait for commands to exit before killing them")
+	rootCmd.PersistentFlags().IntVar(&haltAfter, "halt-after", 0, "Stop launching new commands once this many have failed; running commands finish")
+	rootCmd.PersistentFlags().IntVar(&eventsFD, "events-fd", 0, "Write lifecycle events as NDJSON to this file descriptor")
+	rootCmd.PersistentFlags().StringVar(&eventsSocket, "events-socket", "", "Write lifecycle events as NDJSON to this Unix socket")
+	rootCmd.PersistentFlags().IntVar(&progressFD, "progress-fd", 0, "Write STARTED/DONE progress lines to this file descriptor")
+	rootCmd.PersistentFlags().BoolVar(&bufferUntilExit, "buffer-until-exit", false, "Hold back all command output and print it grouped and sorted by tag once every command has finished")
+	rootCmd.PersistentFlags().BoolVar(&flushLines, "flush", true, "Write every output line immediately; use --flush=false to batch output for throughput")
+	rootCmd.PersistentFlags().StringVar(&tagFromRegex, "tag-from-regex", "", "Tag untagged commands with the first capture group of this regular expression in the command (e.g. \"services/(\\w+)\")")
+	rootCmd.PersistentFlags().StringVar(&tagPrefix, "tag-prefix", "", "Put a namespace in front of every tag (e.g. \"ci/\" shows [ci/build]); options refer to tags without it")
+	rootCmd.PersistentFlags().BoolVar(&normalizeTags, "normalize-tags", false, "Lowercase tags and replace spaces and slashes with dashes; options refer to tags as written or normalized")
+	rootCmd.PersistentFlags().StringArrayVar(&tagColorFlags, "tag-color", []string{}, "Use a fixed prefix color for a tag (format: TAG:COLOR, e.g. build:green)")
+	rootCmd.PersistentFlags().StringArrayVar(&tagLinkFlags, "tag-link", []string{}, "Make the prefix of a tag a clickable link in terminals with OSC 8 support (format: TAG:URL)")
+	rootCmd.PersistentFlags().StringArrayVar(&tagIconFlags, "tag-icon", []string{}, "Show an icon before the prefix of a tag (format: TAG:ICON, e.g. build:🔨)")
+	rootCmd.PersistentFlags().BoolVarP(&interactive, "interactive", "i", false, "Forward stdin to the running command (sequential) or the first command (parallel)")
+	rootCmd.PersistentFlags().BoolVar(&broadcastStdin, "broadcast-stdin", false, "Forward stdin to every running command (implies --interactive)")
+	rootCmd.PersistentFlags().StringVar(&abortKeyFlag, "abort-key", "", "In interactive mode, key that stops rufl (e.g. q or ctrl-])")
+	rootCmd.PersistentFlags().BoolVar(&controlStdin, "control", false, "Read control lines from stdin: 'k TAG' stops the commands tagged TAG, 'l' lists the running commands")
+	rootCmd.PersistentFlags().BoolVar(&pauseKeys, "pause-keys", false, "Press p to pause and r to resume all running commands (Unix only, stdin must be a terminal)")
+	rootCmd.PersistentFlags().IntVar(&prefixWidth, "prefix-width", 0, "Pad the prefix of output lines to at least this many columns")
+	rootCmd.PersistentFlags().StringVar(&prefixAlign, "prefix-align", "left", "Where the prefix sits within --prefix-width: left or right")
+	rootCmd.PersistentFlags().StringVar(&bracketStyle, "bracket-style", "[]", "Brackets around the prefix of output lines: [], <>, () or none")
+	rootCmd.PersistentFlags().StringVar(&timestampMode, "timestamps", "none", "Prefix output lines with a timestamp: none, wall or relative (time since rufl started)")
+	rootCmd.PersistentFlags().Lookup("timestamps").NoOptDefVal = "wall"
+	rootCmd.PersistentFlags().StringVar(&sanitizeMode, "sanitize-output", "pass-through", "Remove control characters from command output: pass-through, keep-color (keep color codes) or strip-all")
+	rootCmd.PersistentFlags().Lookup("sanitize-output").NoOptDefVal = "keep-color"
+	rootCmd.PersistentFlags().StringVar(&inputEncoding, "input-encoding", "utf-8", "Decode command output from this encoding to UTF-8, e.g. cp1252 or shift_jis (like +TAG@encoding=NAME:COMMAND)")
+	rootCmd.PersistentFlags().BoolVar(&trimTrailing, "trim-trailing", false, "Remove trailing whitespace from each line of command output")
+	rootCmd.PersistentFlags().IntVar(&dedupThreshold, "dedup", 0, "Collapse consecutive identical output lines after printing this many of them (1 with no value)")
+	rootCmd.PersistentFlags().Lookup("dedup").NoOptDefVal = "1"
+	rootCmd.PersistentFlags().BoolVar(&commandElapsed, "command-elapsed", false, "Show how long each command has been running in the prefix of its lines (e.g. [build +3.2s])")
+	rootCmd.PersistentFlags().BoolVar(&mergeStreams, "merge-streams", false, "Read stdout and stderr as one stream to keep their order (output is labeled 'out')")
+	rootCmd.PersistentFlags().BoolVar(&showSummary, "summary", false, "Print a table with each command's status, duration, niceness and CPU time at the end")
+	rootCmd.PersistentFlags().StringVar(&summaryFormat, "summary-format", "table", "Format of the --summary: table, json or markdown")
+	rootCmd.PersistentFlags().BoolVar(&noBanner, "no-banner", false, "Do not print the final summary line with success/failure counts")
+	rootCmd.PersistentFlags().BoolVar(&printArgv, "print-argv", false, "Print the exact arguments each command is executed with, including any shell wrapping")
+	rootCmd.PersistentFlags().BoolVar(&highlightCommands, "highlight-commands", false, "Show program names in bold and flags dimmed when echoing commands")
+	rootCmd.PersistentFlags().BoolVar(&noRuflMarker, "no-rufl-marker", false, "Do not start rufl's own status messages with a 'rufl:' marker")
+	rootCmd.PersistentFlags().StringArrayVar(&grepPatterns, "grep", []string{}, "Only print output lines matching this regex")
+	rootCmd.PersistentFlags().StringArrayVar(&highlightFlags, "highlight", []string{}, "Show matches of this regex in output lines in bold color, optionally as COLOR:REGEX")
+	rootCmd.PersistentFlags().StringArrayVar(&grepOutPatterns, "grep-out", []string{}, "Do not print output lines matching this regex")
+	rootCmd.PersistentFlags().StringArrayVar(&tagGrepPatterns, "tag-grep", []string{}, "Only print output lines of a tag matching a regex (format: TAG:REGEX)")
+	rootCmd.PersistentFlags().StringArrayVar(&tagGrepOutPatterns, "tag-grep-out", []string{}, "Do not print output lines of a tag matching a regex (format: TAG:REGEX)")
+	rootCmd.PersistentFlags().StringVar(&cpuSetFlag, "cpuset", "", "Pin commands to these CPUs, e.g. 0-3,6 (Linux only)")
+	rootCmd.PersistentFlags().StringVar(&umaskFlag, "umask", "", "File creation mask for commands, in octal (e.g. 022); ignored on Windows")
+	rootCmd.PersistentFlags().StringVar(&maxMemoryFlag, "max-memory", "", "Kill a command when it and its children use more memory than this, e.g. 512MB (Linux only)")
+	rootCmd.PersistentFlags().BoolVar(&stripNestedPrefix, "strip-nested-prefix", false, "Merge prefixes printed by nested rufl runs into the outer prefix ([outer/inner])")
+	rootCmd.PersistentFlags().StringVar(&splitMode, "split", "line", "How command output is split into prefixed records: line, word or null (NUL-delimited)")
+	rootCmd.PersistentFlags().BoolVar(&prefixToStderr, "prefix-to-stderr", false, "Write commands' stdout to stdout as is and send prefixed stderr and status messages to stderr")
+	rootCmd.PersistentFlags().BoolVar(&colorWholeLine, "color-whole-line", false, "Color the whole output line in the prefix color, not just the prefix")
+	rootCmd.PersistentFlags().BoolVar(&alwaysShowStream, "always-show-stream", false, "Include the stream type (:out/:err) in the prefix even when color is enabled")
+	rootCmd.PersistentFlags().BoolVar(&prefixOnce, "prefix-once", false, "Only print the prefix when the output switches to another command or stream")
+	rootCmd.PersistentFlags().BoolVar(&lineBufferChild, "line-buffer-child", false, "Run commands through stdbuf -oL -eL, so programs that buffer output when it is piped print it line by line")
+	rootCmd.PersistentFlags().BoolVar(&noPathCache, "no-path-cache", false, "Look up programs in PATH for every run instead of reusing earlier lookups")
+	rootCmd.PersistentFlags().BoolVar(&expandGlobs, "expand-globs", false, "Expand glob patterns in arguments without a shell, the same way on every platform")
+	rootCmd.PersistentFlags().StringVar(&globNoMatch, "glob-no-match", "keep", "With --expand-globs, what to do with patterns matching no files: keep or error")
+	rootCmd.PersistentFlags().StringArrayVar(&scripts, "script", []string{}, "Add a multi-line script run by the shell, inline or read from @FILE")
+	rootCmd.PersistentFlags().StringArrayVar(&expectFlags, "expect", []string{}, "Fail the command with this tag unless a line of its output matches the regular expression, and exit with 1 if any expected output is missing (format: TAG=REGEX)")
+	rootCmd.PersistentFlags().StringArrayVar(&macroFlags, "macro", []string{}, "Define a macro that @NAME expands to (format: NAME=COMMAND;COMMAND, e.g. lint=\"golangci-lint run;go vet ./...\")")
+	rootCmd.PersistentFlags().StringArrayVar(&base64Commands, "cmd-b64", []string{}, "Add a base64-encoded command, decoded before processing")
+	rootCmd.PersistentFlags().BoolVar(&percentEncoded, "cmd-enc", false, "Positional commands are percent-encoded (e.g. echo%20%22hi%22)")
+	rootCmd.PersistentFlags().StringVar(&containerImage, "container", "", "Run each local command in a throwaway container of this image (e.g. alpine:3.20)")
+	rootCmd.PersistentFlags().StringVar(&containerRuntime, "container-runtime", "auto", "Container runtime for --container: auto (docker, else podman) or a program name")
+	rootCmd.PersistentFlags().BoolVar(&containerMountDir, "container-mount-dir", true, "Mount each command's working directory into its container; use --container-mount-dir=false to not")
+	rootCmd.PersistentFlags().StringVar(&remoteHost, "host", "", "Run commands on this host over ssh (e.g. user@server)")
+	rootCmd.PersistentFlags().IntVar(&benchRuns, "bench", 0, "Run all commands this many times and print duration statistics per tag")
+	rootCmd.PersistentFlags().IntVar(&warmupRuns, "warmup-runs", 0, "With --bench, run all commands this many times first, left out of the statistics")
+	rootCmd.PersistentFlags().StringVar(&warmupCommand, "warmup", "", "With --bench, run this command once before the benchmark, e.g. to prime caches")
+	rootCmd.PersistentFlags().StringVar(&benchFormat, "bench-format", "table", "Format of the benchmark statistics: table or json")
+	rootCmd.PersistentFlags().StringVar(&trapExit, "trap-exit", "", "Run this cleanup command when rufl exits, even on failure or a signal")
+	rootCmd.PersistentFlags().BoolVar(&serverStdin, "server-stdin", false, "Read commands as JSON lines from stdin and run each as it arrives")
+	rootCmd.PersistentFlags().StringVar(&logDir, "log-dir", "", "Also write the output of each command to TAG.log in this directory")
+	rootCmd.PersistentFlags().BoolVar(&compressLogs, "compress-logs", false, "Compress the files in --log-dir with gzip, as TAG.log.gz")
+	rootCmd.PersistentFlags().StringVar(&fifoDir, "fifo-dir", "", "Also write the output of each command to a FIFO TAG.fifo in this directory, for other programs to read (Unix only)")
+	rootCmd.PersistentFlags().BoolVar(&keepANSIInFiles, "keep-ansi-in-files", false, "Keep escape sequences such as colors in output written to files, which are stripped by default")
+	rootCmd.PersistentFlags().StringVar(&recordFile, "record", "", "Record all output with timing to this file in asciinema cast format")
+	rootCmd.PersistentFlags().BoolVar(&noHistory, "no-history", false, "Do not record the run in ~/.rufl/history.jsonl")
+	rootCmd.PersistentFlags().StringArrayVar(&hookFlags, "hook", []string{}, "Run a program on a lifecycle event: onstart, online, onexit, onsuccess or onfailure (format: EVENT=PROGRAM)")
+	rootCmd.PersistentFlags().StringVar(&metricsFile, "metrics-file", "", "Keep Prometheus metrics of the commands (up, restarts, last exit code, duration) in this file")
+	rootCmd.PersistentFlags().StringVar(&reportFile, "report", "", "Write the results of the run to this file as JSON")
+	rootCmd.PersistentFlags().StringVar(&resumeFrom, "resume-from", "", "Skip commands that succeeded in the run recorded in this report")
+	rootCmd.PersistentFlags().BoolVar(&ignoreBrokenPipe, "ignore-broken-pipe", false, "Keep commands running and discard output when stdout is closed by its reader")
+	rootCmd.PersistentFlags().StringVar(&maxTotalOutputFlag, "max-total-output", "", "Stop printing command output once this much has been printed in total (e.g. 50MB), letting the commands finish")
+	rootCmd.PersistentFlags().BoolVar(&abortOnOutputLimit, "max-total-output-abort", false, "Stop all commands when --max-total-output is reached instead of only their output")
+	rootCmd.PersistentFlags().StringVar(&bufferSizeFlag, "buffer-size", "64KB", "Size of the buffer used to read command output (e.g. 256KB, 1MB)")
+
+	// Validate global options before any subcommand runs
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if autoDefaults {
+			applyAutoDefaults(isTerminal(os.Stdout.Fd()), cmd.Flags().Changed)
+		}
+		validateOptions()
+	}
 
 	var parallelCmd = &cobra.Command{
 		Use:     "=",
@@ -100,8 +432,15 @@ Examples:
 		Long:    `Run multiple commands in parallel and output the results as they come in.`,
 		Args:    cobra.MinimumNArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
+			if serverStdin {
+				exitOnFailedExpectations(runServer(os.Stdin, true))
+				return
+			}
 			commands := processCommands(args)
-			runCommands(commands, true)
+			started := time.Now()
+			results := runCommands(commands, true)
+			recordHistory(os.Args[1:], true, commands, started, results)
+			exitOnFailedExpectations(results)
 		},
 	}
 
@@ -112,17 +451,495 @@ Examples:
 		Long:    `Run multiple commands one after another and output the results.`,
 		Args:    cobra.MinimumNArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
+			if serverStdin {
+				exitOnFailedExpectations(runServer(os.Stdin, false))
+				return
+			}
 			commands := processCommands(args)
-			runCommands(commands, false)
+			started := time.Now()
+			results := runCommands(commands, false)
+			recordHistory(os.Args[1:], false, commands, started, results)
+			exitOnFailedExpectations(results)
 		},
 	}
 
-	rootCmd.AddCommand(parallelCmd, sequentialCmd)
+	var historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "List recent runs",
+		Long:  `List the most recent runs recorded in ~/.rufl/history.jsonl, with the command line to rerun each one.`,
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := printHistory(historyLimit); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "Number of runs to list, 0 for all")
+
+	var rerunCmd = &cobra.Command{
+		Use:     "rerun",
+		Aliases: []string{"!!"},
+		Short:   "Run the commands of the last run again",
+		Long:    `Run the commands of the most recent run recorded in the history again, in the same mode and the same directory, with the options given now.`,
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := rerunLast(); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
 
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	var runCmd = &cobra.Command{
+		Use:   "run FILE",
+		Short: "Run the tasks of a task file",
+		Long:  `Run the commands defined in a JSON task file, in parallel or sequentially as the file's mode says.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runTaskFile(args[0], os.Args[1:]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	var compareCmd = &cobra.Command{
+		Use:   "compare",
+		Short: "Run commands sequentially and in parallel and compare the timings",
+		Long:  `Run the commands sequentially, then run them again in parallel, and report how long each command and each mode took.`,
+		Args:  cobra.MinimumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnFailedExpectations(runCompare(processCommands(args)))
+		},
+	}
+
+	rootCmd.AddCommand(parallelCmd, sequentialCmd, historyCmd, rerunCmd, runCmd, compareCmd)
+
+	return rootCmd
+}
+
+// validateOptions parses and validates global flag values, exiting on error
+func validateOptions() {
+	size, err := parseByteSize(bufferSizeFlag)
+	if err != nil || size <= 0 {
+		fmt.Printf("Error: Invalid buffer size '%s'\n", bufferSizeFlag)
+		os.Exit(1)
+	}
+	bufferSize = int(size)
+
+	switch restartPolicy {
+	case "no", "always", "on-failure", "on-success":
+	default:
+		fmt.Printf("Error: Invalid restart policy '%s', expected no, always, on-failure or on-success\n", restartPolicy)
+		os.Exit(1)
+	}
+
+	if usePTY && !ptySupported {
+		fmt.Println("Error: --pty is not supported on this platform")
+		os.Exit(1)
+	}
+
+	if containerImage != "" {
+		found, err := findContainerRuntime(containerRuntime)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		containerRuntime = found
+	}
+
+	pattern, err := parseTagRegex(tagFromRegex)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tagPattern = pattern
+
+	expectations, err := parseExpectations(expectFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	outputExpectations = expectations
+
+	parsedMacros, err := parseMacros(macroFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	macros = parsedMacros
+
+	parsedHooks, err := parseHooks(hookFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	hooks = parsedHooks
+
+	weights, err := parseTagWeights(weightTagFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tagWeights = weights
+
+	delays, err := parseTagDelays(delayTagFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tagDelays = delays
+
+	colors, err := parseTagColors(tagColorFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tagColors = colors
+
+	icons, err := parseTagIcons(tagIconFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tagIcons = icons
+
+	links, err := parseTagLinks(tagLinkFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	tagLinks = links
+	hyperlinksSupported = detectHyperlinks()
+	tagIconWidth = 0
+	for _, icon := range tagIcons {
+		tagIconWidth = max(tagIconWidth, runewidth.StringWidth(icon))
+	}
+
+	if globNoMatch != "keep" && globNoMatch != "error" {
+		fmt.Printf("Error: Invalid --glob-no-match value '%s', expected keep or error\n", globNoMatch)
+		os.Exit(1)
+	}
+
+	probes, err := parseProbes(waitForFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	readinessProbes = probes
+	if barrier && runtime.GOOS == "windows" {
+		fmt.Println("Error: --barrier is not supported on Windows")
+		os.Exit(1)
+	}
+	if barrier && maxParallel > 0 {
+		fmt.Println("Error: --barrier needs every command to start at once and cannot be used with --max-parallel")
+		os.Exit(1)
+	}
+
+	if commandTimeout < 0 || idleTimeout < 0 || timeoutKillGrace < 0 {
+		fmt.Println("Error: --timeout, --idle-timeout and --timeout-kill-grace must not be negative")
+		os.Exit(1)
+	}
+
+	if waitInterval <= 0 || waitTimeout <= 0 {
+		fmt.Println("Error: --wait-timeout and --wait-interval must be positive")
+		os.Exit(1)
+	}
+
+	if workDir != "" {
+		if err := checkWorkDir(workDir); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if err := checkPrefixOptions(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := checkRequiredPrograms(requiredPrograms); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if commandCount < 0 {
+		fmt.Printf("Error: Invalid command count %d\n", commandCount)
+		os.Exit(1)
+	}
+
+	if benchRuns < 0 {
+		fmt.Printf("Error: Invalid number of benchmark runs %d\n", benchRuns)
+		os.Exit(1)
+	}
+	if warmupRuns < 0 {
+		fmt.Printf("Error: Invalid number of warmup runs %d\n", warmupRuns)
+		os.Exit(1)
+	}
+	if (warmupRuns > 0 || warmupCommand != "") && benchRuns == 0 {
+		fmt.Println("Error: --warmup and --warmup-runs need --bench")
+		os.Exit(1)
+	}
+	switch summaryFormat {
+	case "table", "json", "markdown":
+	default:
+		fmt.Printf("Error: Invalid summary format '%s', expected table, json or markdown\n", summaryFormat)
+		os.Exit(1)
+	}
+
+	if benchFormat != "table" && benchFormat != "json" {
+		fmt.Printf("Error: Invalid benchmark format '%s', expected table or json\n", benchFormat)
 		os.Exit(1)
 	}
+
+	switch splitMode {
+	case "line", "word", "null":
+	default:
+		fmt.Printf("Error: Invalid split mode '%s', expected line, word or null\n", splitMode)
+		os.Exit(1)
+	}
+
+	if dedupThreshold < 0 {
+		fmt.Println("Error: --dedup must not be negative")
+		os.Exit(1)
+	}
+
+	if _, err := lookupEncoding(inputEncoding); err != nil {
+		fmt.Printf("Error: Invalid --input-encoding, %v\n", err)
+		os.Exit(1)
+	}
+
+	switch sanitizeMode {
+	case "pass-through", "keep-color", "strip-all":
+	default:
+		fmt.Printf("Error: Invalid --sanitize-output policy '%s', expected pass-through, keep-color or strip-all\n", sanitizeMode)
+		os.Exit(1)
+	}
+
+	switch timestampMode {
+	case "none", "wall", "relative":
+	default:
+		fmt.Printf("Error: Invalid timestamps mode '%s', expected none, wall or relative\n", timestampMode)
+		os.Exit(1)
+	}
+
+	// Broadcasting is a mode of forwarding stdin
+	if broadcastStdin {
+		interactive = true
+	}
+
+	if serverStdin && (interactive || confirm) {
+		fmt.Println("Error: --server-stdin reads commands from stdin and cannot be combined with --interactive or --confirm")
+		os.Exit(1)
+	}
+
+	if pauseKeys {
+		if !pauseSupported {
+			fmt.Println("Error: --pause-keys is not supported on Windows")
+			os.Exit(1)
+		}
+		if interactive || serverStdin {
+			fmt.Println("Error: --pause-keys reads stdin and cannot be combined with --interactive or --server-stdin")
+			os.Exit(1)
+		}
+	}
+
+	if controlStdin && (interactive || pauseKeys || serverStdin) {
+		fmt.Println("Error: --control reads stdin and cannot be combined with --interactive, --pause-keys or --server-stdin")
+		os.Exit(1)
+	}
+
+	if interactive && usePTY {
+		fmt.Println("Error: --interactive cannot be combined with --pty")
+		os.Exit(1)
+	}
+
+	if abortKeyFlag != "" {
+		if !interactive {
+			fmt.Println("Error: --abort-key requires --interactive")
+			os.Exit(1)
+		}
+		key, err := parseKey(abortKeyFlag)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		abortKey = key
+	}
+
+	if cpuSetFlag != "" {
+		if !cpuSetSupported {
+			fmt.Println("Error: --cpuset is only supported on Linux")
+			os.Exit(1)
+		}
+		cpus, err := parseCPUList(cpuSetFlag)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		cpuSet = cpus
+	}
+
+	if umaskFlag != "" {
+		mask, err := parseUmask(umaskFlag)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		setUmask(mask)
+	}
+
+	if maxMemoryFlag != "" {
+		if !memoryLimitSupported {
+			fmt.Println("Error: --max-memory is only supported on Linux")
+			os.Exit(1)
+		}
+		limit, err := parseByteSize(maxMemoryFlag)
+		if err != nil || limit <= 0 {
+			fmt.Printf("Error: Invalid memory limit '%s'\n", maxMemoryFlag)
+			os.Exit(1)
+		}
+		maxMemory = limit
+	}
+
+	if maxTotalOutputFlag != "" {
+		limit, err := parseByteSize(maxTotalOutputFlag)
+		if err != nil || limit <= 0 {
+			fmt.Printf("Error: Invalid output limit '%s'\n", maxTotalOutputFlag)
+			os.Exit(1)
+		}
+		maxTotalOutput = limit
+	}
+
+	if err := setupRecording(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if lineBufferChild {
+		found, err := findStdbuf()
+		if err != nil {
+			printColoredMessage(fmt.Sprintf("Warning: --line-buffer-child has no effect, %v", err), colorYellow)
+		}
+		stdbufPath = found
+	}
+
+	if compressLogs && logDir == "" {
+		fmt.Println("Error: --compress-logs needs --log-dir")
+		os.Exit(1)
+	}
+	if err := setupLogDir(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if fifoDir != "" && runtime.GOOS == "windows" {
+		fmt.Println("Error: --fifo-dir is not supported on Windows")
+		os.Exit(1)
+	}
+	if err := setupFifoDir(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	highlights, err := parseHighlights(highlightFlags)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	outputHighlights = highlights
+
+	if err := setupFilters(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := setupEvents(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := setupProgress(); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseTagColors parses TAG:COLOR pairs into a map of tag to ANSI color code
+func parseTagColors(values []string) (map[string]string, error) {
+	colors := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid tag color '%s', expected 'TAG:COLOR'", value)
+		}
+
+		color, ok := colorNames[strings.ToLower(parts[1])]
+		if !ok {
+			return nil, fmt.Errorf("unknown color '%s' for tag '%s'", parts[1], parts[0])
+		}
+		colors[finalTag(parts[0])] = color
+	}
+	return colors, nil
+}
+
+// parseTagIcons parses TAG:ICON values into a map of tag names to icons
+func parseTagIcons(values []string) (map[string]string, error) {
+	icons := make(map[string]string)
+	for _, value := range values {
+		parts := strings.SplitN(value, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid tag icon '%s', expected 'TAG:ICON'", value)
+		}
+		icons[finalTag(parts[0])] = parts[1]
+	}
+	return icons, nil
+}
+
+// tagIcon returns the icon to print before the prefix of a tag, padded to
+// the width of the widest icon so prefixes stay aligned. Tags without an
+// icon get blank padding, and nothing is added when no icons are set.
+func tagIcon(tag string) string {
+	if tagIconWidth == 0 {
+		return ""
+	}
+	icon := tagIcons[tag]
+	return icon + strings.Repeat(" ", tagIconWidth-runewidth.StringWidth(icon)+1)
+}
+
+// parseByteSize parses a human-readable size like "64KB", "1MB" or "512"
+// into a number of bytes. Units are powers of 1024.
+func parseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30}, {"G", 1 << 30},
+		{"MB", 1 << 20}, {"M", 1 << 20},
+		{"KB", 1 << 10}, {"K", 1 << 10},
+		{"B", 1},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size must not be negative: '%s'", value)
+	}
+
+	return n * multiplier, nil
 }
 
 // setupSignalHandling sets up handlers for various signals
@@ -140,9 +957,12 @@ func setupSignalHandling() {
 
 				// Check if this is a double Ctrl+C (within 1 second)
 				if !lastSigIntTime.IsZero() && now.Sub(lastSigIntTime) < time.Second {
-					// Double Ctrl+C detected, exit rufl
+					// Double Ctrl+C detected, kill the current command and exit
+					// right away rather than waiting for --halt-timeout
 					printColoredMessage("Double Ctrl+C detected. Exiting...", colorYellow)
-					os.Exit(130) // 128 + SIGINT (2)
+					shuttingDown.Store(true)
+					killActiveCommands()
+					exitRufl(130) // 128 + SIGINT (2)
 				}
 
 				// Single Ctrl+C, just interrupt the current command
@@ -152,7 +972,8 @@ func setupSignalHandling() {
 				// Forward the signal to the current command only
 				currentCmdMutex.Lock()
 				if currentSequentialCmd != nil && currentSequentialCmd.Process != nil {
-					_ = currentSequentialCmd.Process.Signal(sig)
+					currentCmdInterrupted = true
+					_ = signalCommand(currentSequentialCmd.Process, sig)
 				}
 				currentCmdMutex.Unlock()
 
@@ -172,7 +993,7 @@ func setupSignalHandling() {
 						// For unsupported signals on Windows, just kill the process
 						_ = cmd.Process.Kill()
 					} else {
-						_ = cmd.Process.Signal(sig)
+						_ = signalCommand(cmd.Process, sig)
 					}
 				}
 				return true
@@ -180,43 +1001,150 @@ func setupSignalHandling() {
 
 			// For SIGINT and SIGTERM, exit after forwarding
 			if (sig == syscall.SIGINT || sig == syscall.SIGTERM) && parallelMode {
-				os.Exit(128 + int(sig.(syscall.Signal)))
+				shutdownRufl(128 + int(sig.(syscall.Signal)))
 			}
 
 			// For SIGTERM in sequential mode, also exit
 			if sig == syscall.SIGTERM && !parallelMode {
-				os.Exit(128 + int(sig.(syscall.Signal)))
+				shutdownRufl(128 + int(sig.(syscall.Signal)))
 			}
 		}
 	}()
 }
 
-// processCommands combines regular command arguments and tagged commands
-func processCommands(args []string) []CommandInfo {
-	var commands []CommandInfo
-	var regularArgs []string
-	var taggedCommands []struct {
-		Tag     string
-		Command string
+// terminateActiveCommands asks all running commands to terminate
+func terminateActiveCommands() {
+	activeCommands.Range(func(key, value interface{}) bool {
+		terminateCommand(value.(*exec.Cmd))
+		return true
+	})
+}
+
+// terminateCommand asks a running command to terminate
+func terminateCommand(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	// On Windows, SIGTERM is not supported, so kill the process instead
+	if runtime.GOOS == "windows" {
+		_ = cmd.Process.Kill()
+		return
 	}
+	_ = signalCommand(cmd.Process, syscall.SIGTERM)
+	// A paused command only handles the signal once continued
+	if paused.Load() {
+		_ = continueProcess(cmd.Process)
+	}
+}
 
-	// First, separate regular args from +tag:command args
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "+") && strings.Contains(arg, ":") {
-			// This is a +tag:command format
-			tagParts := strings.SplitN(arg[1:], ":", 2) // Remove the + prefix
-			if len(tagParts) != 2 {
-				fmt.Printf("Warning: Invalid tag format '%s', expected '+NAME:COMMAND'\n", arg)
-				continue
-			}
+// shutdownRufl waits up to --halt-timeout for commands that were asked to
+// stop to exit, kills the ones still running and then exits. No new
+// commands are launched while shutting down.
+func shutdownRufl(code int) {
+	shuttingDown.Store(true)
 
-			taggedCommands = append(taggedCommands, struct {
-				Tag     string
-				Command string
-			}{
-				Tag:     tagParts[0],
-				Command: tagParts[1],
-			})
+	if !waitForCommands(haltTimeout) {
+		printColoredMessage(fmt.Sprintf("Commands still running after %v, killing them", haltTimeout), colorRed)
+		killActiveCommands()
+	}
+	exitRufl(code)
+}
+
+// waitForCommands waits until no command is active anymore, or the timeout
+// has passed, and reports whether all commands have exited
+func waitForCommands(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for countActiveCommands() > 0 {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return true
+}
+
+// killActiveCommands kills all running commands immediately
+func killActiveCommands() {
+	activeCommands.Range(func(key, value interface{}) bool {
+		cmd := value.(*exec.Cmd)
+		if cmd.Process != nil {
+			_ = signalCommand(cmd.Process, os.Kill)
+		}
+		return true
+	})
+}
+
+// exitRufl restores the terminal, runs the exit trap, writes out any pending
+// output and exits
+func exitRufl(code int) {
+	if restoreTerminal != nil {
+		restoreTerminal()
+	}
+	// Exits on a signal only give hooks a moment to finish
+	if shuttingDown.Load() {
+		stopHooks()
+	} else {
+		waitForHooks()
+	}
+	runTrapExit()
+	closeFifos()
+	closeLogFilesAtExit()
+	flushBufferedOutput()
+	flushOutput()
+	closeRecording()
+	os.Exit(code)
+}
+
+// processCommands combines regular command arguments and tagged commands
+func processCommands(args []string) []CommandInfo {
+	var commands []CommandInfo
+	var regularArgs []string
+	// A command tagged with +tag:command or -t, optionally on a remote host
+	type taggedCommand struct {
+		Tag     string
+		Host    string
+		Command string
+	}
+	var taggedCommands []taggedCommand
+
+	// Decode encoded commands before looking at their contents
+	args, err := decodeCommandArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	scriptArgs, err := readScripts(scripts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	args = append(args, scriptArgs...)
+
+	// Replace @NAME with the commands of the macro
+	args, err = expandMacroArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// First, separate regular args from +tag:command args
+	for _, arg := range args {
+		if tag, host, command, ok := parseRemoteTag(strings.TrimPrefix(arg, "+")); ok && strings.HasPrefix(arg, "+") {
+			// This is a +tag@ssh://host:command format
+			taggedCommands = append(taggedCommands, taggedCommand{Tag: tag, Host: host, Command: command})
+		} else if strings.HasPrefix(arg, "+") && strings.Contains(arg, ":") {
+			// This is a +tag:command format
+			tagParts := strings.SplitN(arg[1:], ":", 2) // Remove the + prefix
+			if len(tagParts) != 2 {
+				warn("Invalid tag format '%s', expected '+NAME:COMMAND'", arg)
+				continue
+			}
+
+			taggedCommands = append(taggedCommands, taggedCommand{
+				Tag:     tagParts[0],
+				Command: tagParts[1],
+			})
 		} else {
 			// This is a regular command
 			regularArgs = append(regularArgs, arg)
@@ -225,16 +1153,18 @@ func processCommands(args []string) []CommandInfo {
 
 	// Add any tagged commands from the -t flag
 	for _, tag := range tags {
+		if tag, host, command, ok := parseRemoteTag(tag); ok {
+			taggedCommands = append(taggedCommands, taggedCommand{Tag: tag, Host: host, Command: command})
+			continue
+		}
+
 		tagParts := strings.SplitN(tag, ":", 2)
 		if len(tagParts) != 2 {
-			fmt.Printf("Warning: Invalid tag format '%s', expected 'NAME:COMMAND'\n", tag)
+			warn("Invalid tag format '%s', expected 'NAME:COMMAND'", tag)
 			continue
 		}
 
-		taggedCommands = append(taggedCommands, struct {
-			Tag     string
-			Command string
-		}{
+		taggedCommands = append(taggedCommands, taggedCommand{
 			Tag:     tagParts[0],
 			Command: tagParts[1],
 		})
@@ -244,11 +1174,17 @@ func processCommands(args []string) []CommandInfo {
 	for i, cmd := range regularArgs {
 		// Check if this command has a tag
 		tag := fmt.Sprintf("%d", i+1) // Default tag is the index
+		if derived, ok := tagFromCommand(cmd); ok {
+			tag = derived
+		}
+
+		host := ""
 
 		// Look for a matching tagged command
 		for j, taggedCmd := range taggedCommands {
 			if taggedCmd.Command == cmd {
 				tag = taggedCmd.Tag
+				host = taggedCmd.Host
 				// Remove the tagged command to avoid processing it again
 				taggedCommands = append(taggedCommands[:j], taggedCommands[j+1:]...)
 				break
@@ -259,6 +1195,7 @@ func processCommands(args []string) []CommandInfo {
 			Command: cmd,
 			Tag:     tag,
 			Index:   i,
+			Host:    host,
 		})
 	}
 
@@ -269,53 +1206,867 @@ func processCommands(args []string) []CommandInfo {
 			Command: taggedCmd.Command,
 			Tag:     taggedCmd.Tag,
 			Index:   remainingIndex,
+			Host:    taggedCmd.Host,
 		})
 		remainingIndex++
 	}
 
-	if len(commands) == 0 {
-		fmt.Println("Error: No commands specified. Use positional arguments, +tag:command syntax, or -t/--tag flags.")
-		os.Exit(1)
+	if dedupeCommands {
+		var removed int
+		commands, removed = removeDuplicateCommands(commands)
+		if removed > 0 {
+			printColoredMessage(fmt.Sprintf("Removed %d duplicate commands", removed), colorYellow)
+		}
+	}
+
+	commands, err = dropEmptyCommands(commands)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Split modifiers such as !PRIORITY off the tags
+	for i := range commands {
+		commands[i] = applyTagSpec(commands[i])
+	}
+
+	// Per-tag options are keyed by the final tags, which are set further down
+	for i := range commands {
+		tag := finalTag(commands[i].Tag)
+		if slices.ContainsFunc(detachTags, func(detached string) bool { return finalTag(detached) == tag }) {
+			commands[i].Detach = true
+		}
+		if delay, ok := tagDelays[tag]; ok {
+			commands[i].Delay = delay
+		}
+		if weight, ok := tagWeights[tag]; ok {
+			commands[i].Weight = weight
+		}
+	}
+
+	if commandCount > 0 {
+		commands = expandCount(commands, commandCount)
+	}
+
+	// Commands without a host of their own run on --host, if given
+	if remoteHost != "" {
+		for i := range commands {
+			if commands[i].Host == "" {
+				commands[i].Host = remoteHost
+			}
+		}
+	}
+
+	// Local commands run in a container of --container, if given
+	if containerImage != "" {
+		for i := range commands {
+			if commands[i].Host == "" {
+				commands[i].Image = containerImage
+			}
+		}
+	}
+
+	if normalizeTags {
+		commands = normalizeCommandTags(commands)
+	}
+
+	// The namespace is added last, so it is kept as given
+	for i := range commands {
+		commands[i].Tag = tagPrefix + commands[i].Tag
+		// Conditions name tags as they were written
+		if commands[i].RunIfTag != "" {
+			commands[i].RunIfTag = finalTag(commands[i].RunIfTag)
+		}
+	}
+
+	// Expand rufl variables before anything decides how to run the commands
+	commands = expandVariables(commands)
+
+	reportWarnings()
+
+	if len(commands) == 0 {
+		fmt.Println("Error: No commands specified. Use positional arguments, +tag:command syntax, or -t/--tag flags.")
+		os.Exit(1)
+	}
+
+	return commands
+}
+
+// dropEmptyCommands rejects commands that are empty or only whitespace, which
+// a shell would silently run as a no-op. With --skip-empty they are left out
+// with a warning instead.
+func dropEmptyCommands(commands []CommandInfo) ([]CommandInfo, error) {
+	var kept []CommandInfo
+	for _, cmdInfo := range commands {
+		if strings.TrimSpace(cmdInfo.Command) != "" {
+			cmdInfo.Index = len(kept)
+			kept = append(kept, cmdInfo)
+			continue
+		}
+		if !skipEmpty {
+			return nil, fmt.Errorf("empty command for tag '%s' (use --skip-empty to skip it)", cmdInfo.Tag)
+		}
+		warn("Skipping empty command for tag '%s'", cmdInfo.Tag)
+	}
+	return kept, nil
+}
+
+// removeDuplicateCommands keeps only the first of the commands with the same
+// command string and host. Tags are given to the first of the matching
+// commands, so if any of the duplicates has a tag of its own, the first one
+// does. It returns the remaining commands and how many were removed.
+func removeDuplicateCommands(commands []CommandInfo) ([]CommandInfo, int) {
+	var kept []CommandInfo
+	seen := make(map[[2]string]bool)
+	for _, cmdInfo := range commands {
+		// Empty commands are left to dropEmptyCommands
+		if strings.TrimSpace(cmdInfo.Command) == "" {
+			kept = append(kept, cmdInfo)
+			continue
+		}
+
+		key := [2]string{cmdInfo.Host, cmdInfo.Command}
+		if !seen[key] {
+			seen[key] = true
+			kept = append(kept, cmdInfo)
+		}
+	}
+	return kept, len(commands) - len(kept)
+}
+
+// normalizeTag lowercases a tag and replaces whitespace and slashes with
+// dashes, so it can be used as a file name or map key
+func normalizeTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || unicode.IsSpace(r) {
+			return '-'
+		}
+		return unicode.ToLower(r)
+	}, tag)
+}
+
+// finalTag returns the tag a command written with tag ends up with, after
+// --normalize-tags and --tag-prefix. Options that refer to tags are given
+// the tags as written and keyed by their final tags.
+func finalTag(tag string) string {
+	if normalizeTags {
+		tag = normalizeTag(tag)
+	}
+	return tagPrefix + tag
+}
+
+// normalizeCommandTags normalizes the tags of all commands and warns when
+// different tags end up the same
+func normalizeCommandTags(commands []CommandInfo) []CommandInfo {
+	original := make(map[string]string)
+	for i := range commands {
+		tag := normalizeTag(commands[i].Tag)
+		if previous, ok := original[tag]; ok && previous != commands[i].Tag {
+			warn("Tags '%s' and '%s' are both normalized to '%s'", previous, commands[i].Tag, tag)
+		} else if !ok {
+			original[tag] = commands[i].Tag
+		}
+		commands[i].Tag = tag
+	}
+	return commands
+}
+
+// decodeCommandArgs percent-decodes the positional arguments when --cmd-enc
+// is set and appends the commands passed with --cmd-b64. Decoded commands
+// may use the +tag:command syntax like any other argument.
+func decodeCommandArgs(args []string) ([]string, error) {
+	decoded := make([]string, 0, len(args)+len(base64Commands))
+
+	for _, arg := range args {
+		if percentEncoded {
+			value, err := url.PathUnescape(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid percent-encoded command '%s': %w", arg, err)
+			}
+			arg = value
+		}
+		decoded = append(decoded, arg)
+	}
+
+	for _, encoded := range base64Commands {
+		value, err := decodeBase64(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 command '%s': %w", encoded, err)
+		}
+		decoded = append(decoded, value)
+	}
+
+	return decoded, nil
+}
+
+// readScripts returns the scripts given with --script. Values starting with
+// @ name a file to read the script from.
+func readScripts(values []string) ([]string, error) {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if !strings.HasPrefix(value, "@") {
+			result = append(result, value)
+			continue
+		}
+
+		data, err := os.ReadFile(value[1:])
+		if err != nil {
+			return nil, fmt.Errorf("reading script: %w", err)
+		}
+		result = append(result, string(data))
+	}
+	return result, nil
+}
+
+// commandSummary shortens a multi-line script to its first line that is
+// not blank or a comment, followed by the number of lines, for status messages
+func commandSummary(command string) string {
+	lines := strings.Split(strings.TrimSpace(command), "\n")
+	if len(lines) == 1 {
+		return command
+	}
+
+	first := strings.TrimSpace(lines[0])
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			first = line
+			break
+		}
+	}
+	return fmt.Sprintf("%s ... (%d lines)", first, len(lines))
+}
+
+// decodeBase64 decodes standard or URL-safe base64, with or without padding
+func decodeBase64(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	var err error
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		var data []byte
+		if data, err = encoding.DecodeString(value); err == nil {
+			return string(data), nil
+		}
+	}
+	return "", err
+}
+
+// expandVariables substitutes $NAME and ${NAME} references to variables
+// defined with --var. Unknown names are left untouched so the shell can
+// still expand its own variables.
+func expandVariables(commands []CommandInfo) []CommandInfo {
+	if len(vars) == 0 {
+		return commands
+	}
+
+	values := make(map[string]string)
+	for _, v := range vars {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			warn("Invalid variable format '%s', expected 'NAME=VALUE'", v)
+			continue
+		}
+		values[parts[0]] = parts[1]
+	}
+
+	for i := range commands {
+		commands[i].Command = expandString(commands[i].Command, values)
+	}
+
+	return commands
+}
+
+// expandString replaces $NAME and ${NAME} in s with values from the map
+func expandString(s string, values map[string]string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		// ${NAME} form
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i+2:], '}')
+			if end >= 0 {
+				name := s[i+2 : i+2+end]
+				if value, ok := values[name]; ok {
+					b.WriteString(value)
+					i += end + 2
+					continue
+				}
+			}
+			b.WriteByte(s[i])
+			continue
+		}
+
+		// $NAME form, taking the longest identifier
+		end := i + 1
+		for end < len(s) && isVariableChar(s[end]) {
+			end++
+		}
+		if value, ok := values[s[i+1:end]]; ok && end > i+1 {
+			b.WriteString(value)
+			i = end - 1
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+
+	return b.String()
+}
+
+// isVariableChar reports whether c can be part of a variable name
+func isVariableChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// runCommands executes the given commands either in parallel or sequentially
+// and returns their results in the order of the commands
+func runCommands(commands []CommandInfo, parallel bool) []CommandResult {
+	commands, skipped, ok := prepareCommands(commands, parallel)
+	if !ok {
+		return nil
+	}
+
+	var results []CommandResult
+	var startTime time.Time
+	withRunSetup(commands, func() {
+		results, startTime = runPass(commands, parallel, skipped)
+	})
+
+	if reportFile != "" {
+		if err := writeReport(reportFile, runModeName(parallel), startTime, results, skipped); err != nil {
+			printColoredMessage(fmt.Sprintf("Error writing report: %v", err), colorRed)
+		}
+	}
+	return results
+}
+
+// prepareCommands leaves out the commands that already succeeded according
+// to --resume-from and asks for --confirm, showing the plan of each of the
+// modes the commands will run in. It returns the commands to run, the
+// results of the skipped ones, and false if nothing should run.
+func prepareCommands(commands []CommandInfo, modes ...bool) ([]CommandInfo, []CommandResult, bool) {
+	var skipped []CommandResult
+	if resumeFrom != "" {
+		report, err := readReport(resumeFrom)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		commands, skipped = skipSucceeded(commands, report)
+		for _, result := range skipped {
+			printCommandMessage(result.Tag, "Skipping, succeeded in the previous run", colorCyan)
+		}
+	}
+
+	if dryRun {
+		for _, parallel := range modes {
+			printCommandPlan(commands, parallel)
+		}
+		return nil, nil, false
+	}
+
+	if confirm {
+		// All plans are shown, and the question is asked once after the last
+		last := len(modes) - 1
+		for _, parallel := range modes[:last] {
+			printCommandPlan(commands, parallel)
+		}
+		if !confirmCommands(commands, modes[last], os.Stdin) {
+			printColoredMessage("Aborted.", colorYellow)
+			os.Exit(1)
+		}
+	}
+	return commands, skipped, true
+}
+
+// withRunSetup sets up everything that lasts for the whole of rufl's run,
+// such as the exit trap, output batching and the stdin readers, calls run
+// and tears it all down again
+func withRunSetup(commands []CommandInfo, run func()) {
+	// Closed last, after the exit trap has printed its output
+	createFifos(commands)
+	defer closeFifos()
+	defer closeLogFiles()
+
+	// Registered first so it runs after output batching has stopped
+	armTrapExit()
+	defer runTrapExit()
+	defer waitForHooks()
+
+	if keepalive > 0 {
+		stopKeepalive := startKeepalive(keepalive)
+		defer stopKeepalive()
+	}
+
+	if !flushLines {
+		stopBatching := startBatching(batchInterval)
+		defer stopBatching()
+	}
+
+	if interactive {
+		startStdinForwarding()
+		if restoreTerminal != nil {
+			defer restoreTerminal()
+		}
+	}
+
+	if pauseKeys {
+		startPauseKeys()
+		if restoreTerminal != nil {
+			defer restoreTerminal()
+		}
+	}
+
+	if controlStdin {
+		startControl()
+	}
+
+	run()
+}
+
+// runPass runs the commands once in the given mode, including any warmup
+// and benchmark runs, and prints the summary, the banner and the benchmark
+// statistics. It returns the results and when the measured runs started.
+func runPass(commands []CommandInfo, parallel bool, skipped []CommandResult) ([]CommandResult, time.Time) {
+	parallelMode = parallel
+
+	if parallel && slices.ContainsFunc(commands, func(cmdInfo CommandInfo) bool { return cmdInfo.RunIf != "" }) {
+		printColoredMessage("Warning: conditions such as ?success only apply in sequential mode, running every command", colorYellow)
+	}
+	if !parallel && slices.ContainsFunc(commands, func(cmdInfo CommandInfo) bool { return cmdInfo.Delay > 0 }) {
+		printColoredMessage("Warning: start delays only apply in parallel mode, running every command right away", colorYellow)
+	}
+	if !parallel && barrier {
+		printColoredMessage("Warning: --barrier only applies in parallel mode", colorYellow)
+	}
+
+	if bufferUntilExit {
+		startBuffering()
+	}
+
+	runAll := func() []CommandResult {
+		defer finishDetached()
+		resetStoppedCommands()
+		if parallel {
+			return runParallel(commands)
+		}
+		return runSequential(commands)
+	}
+
+	// Warmup runs prime caches before timing begins and are left out of
+	// the results
+	if warmupCommand != "" {
+		runWarmupCommand()
+	}
+	var warmups []CommandResult
+	for run := 1; run <= warmupRuns; run++ {
+		printColoredMessage(fmt.Sprintf("Benchmark warmup run %d/%d", run, warmupRuns), colorBlue)
+		warmups = append(warmups, runAll()...)
+	}
+
+	startTime := time.Now()
+
+	// Benchmarks run the whole set of commands several times
+	runs := max(benchRuns, 1)
+
+	var results []CommandResult
+	for run := 1; run <= runs; run++ {
+		if benchRuns > 0 {
+			printColoredMessage(fmt.Sprintf("Benchmark run %d/%d", run, runs), colorBlue)
+		}
+		results = append(results, runAll()...)
+	}
+
+	if bufferUntilExit {
+		flushBufferedOutput()
+	}
+
+	if showSummary {
+		var summary []CommandResult
+		for _, result := range skipped {
+			result.Skipped = true
+			summary = append(summary, result)
+		}
+		printText(formatSummary(append(summary, results...), summaryFormat))
+	}
+
+	if !noBanner {
+		printBanner(results, time.Since(startTime))
+	}
+
+	if benchRuns > 0 {
+		stats := computeBenchStats(results)
+		countWarmups(stats, warmups)
+		printText(formatBenchStats(stats, benchFormat))
+	}
+
+	return results, startTime
+}
+
+// runModeName names the mode commands run in, as used in reports
+func runModeName(parallel bool) string {
+	if parallel {
+		return "parallel"
+	}
+	return "sequential"
+}
+
+// printBanner prints a one-line summary of the run, in green if every
+// command succeeded and in red otherwise
+func printBanner(results []CommandResult, elapsed time.Duration) {
+	succeeded, failed, timedOut, skipped, unmet, detached := 0, 0, 0, 0, 0, 0
+	for _, result := range results {
+		switch {
+		case result.Detached:
+			detached++
+		case result.Unmet:
+			unmet++
+		case result.Success:
+			succeeded++
+		case result.TimedOut:
+			timedOut++
+		case result.Skipped:
+			skipped++
+		default:
+			failed++
+		}
+	}
+
+	message := fmt.Sprintf("rufl: %d succeeded, %d failed", succeeded, failed)
+	if timedOut > 0 {
+		message += fmt.Sprintf(", %d timed out", timedOut)
+	}
+	if skipped > 0 {
+		message += fmt.Sprintf(", %d skipped", skipped)
+	}
+	if unmet > 0 {
+		message += fmt.Sprintf(", %d not run by condition", unmet)
+	}
+	if detached > 0 {
+		message += fmt.Sprintf(", %d detached", detached)
+	}
+	message += fmt.Sprintf(" (elapsed %.1fs)", elapsed.Seconds())
+
+	color := colorGreen
+	if failed > 0 || timedOut > 0 {
+		color = colorRed
+	}
+	printColoredMessage(message, color)
+}
+
+// startKeepalive periodically prints a status line while any command is
+// active, so CI systems that kill silent jobs see some output. The returned
+// function stops the ticker.
+func startKeepalive(interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if active := countActiveCommands(); active > 0 {
+					printColoredMessage(keepaliveMessage(active), colorBlue)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// keepaliveMessage formats the keepalive status line
+func keepaliveMessage(active int) string {
+	noun := "commands"
+	if active == 1 {
+		noun = "command"
+	}
+	return fmt.Sprintf("rufl: still running (%d %s active)", active, noun)
+}
+
+// countActiveCommands returns the number of currently running commands
+func countActiveCommands() int {
+	count := 0
+	activeCommands.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// printCommandPlan prints the commands that would be run and how
+func printCommandPlan(commands []CommandInfo, parallel bool) {
+	mode := "sequentially"
+	if parallel {
+		mode = "in parallel"
+	}
+	fmt.Printf("Commands to run %s:\n", mode)
+
+	for _, cmdInfo := range commands {
+		how := "direct"
+		if needsShell(cmdInfo.Command) {
+			how = "shell"
+		}
+		fmt.Printf("  [%s] %s (%s)\n", cmdInfo.Tag, commandSummary(cmdInfo.Command), how)
+	}
+}
+
+// confirmCommands prints the command plan and asks the user to confirm it.
+// Only an explicit "y" or "yes" answer counts as confirmation.
+func confirmCommands(commands []CommandInfo, parallel bool, in io.Reader) bool {
+	printCommandPlan(commands, parallel)
+	fmt.Printf("Run these %d commands? [y/N] ", len(commands))
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
+// runParallel executes commands in parallel. Commands are launched in order
+// of priority, then in the order given, each one only once the previous one
+// has been launched, after which they all run concurrently. With
+// --max-parallel, queued commands wait for a free slot, and with
+// --halt-after, they are skipped once enough commands have failed. Every
+// finished command reports how many of all commands are done.
+func runParallel(commands []CommandInfo) []CommandResult {
+	results := make([]CommandResult, len(commands))
+	var wg sync.WaitGroup
+	wg.Add(len(commands))
+
+	// Slots for running commands, nil when the number is not limited
+	var slots *weightedSlots
+	if maxParallel > 0 {
+		slots = newWeightedSlots(maxParallel)
+	}
+	halt := &haltCounter{}
+	runProgress = newDoneCounter(commands)
+	defer func() { runProgress = nil }()
+	progress := runProgress
+
+	if barrier {
+		gate, err := newStartBarrier()
+		if err != nil {
+			printColoredMessage(fmt.Sprintf("Error creating start barrier: %v", err), colorRed)
+		} else {
+			startGate = gate
+			defer func() {
+				startGate = nil
+				gate.close()
+			}()
+		}
+	}
+
+	// Launch commands with a higher priority first, keeping the given order
+	// among commands with the same priority
+	order := make([]int, len(commands))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return commands[order[a]].Priority > commands[order[b]].Priority
+	})
+
+	// Each command waits for the previous command's launched channel
+	previous := make(chan struct{})
+	close(previous)
+
+	// Done once each command has been started or skipped, which a delayed
+	// command only is after its delay, unlike its launched channel
+	var started sync.WaitGroup
+	started.Add(len(commands))
+
+	for _, i := range order {
+		cmd := commands[i]
+		launched := make(chan struct{})
+
+		go func(cmdInfo CommandInfo, index int, previous <-chan struct{}, launched chan<- struct{}) {
+			defer wg.Done()
+			<-previous
+
+			// A delayed command lets the following commands launch while it waits
+			if cmdInfo.Delay > 0 {
+				close(launched)
+				launched = nil
+				printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Starting in %v", cmdInfo.Delay), colorCyan)
+				time.Sleep(cmdInfo.Delay)
+			}
+			notify := func() {
+				if launched != nil {
+					close(launched)
+				}
+				started.Done()
+			}
+
+			if slots != nil {
+				taken := slots.acquire(commandWeight(cmdInfo))
+				defer slots.release(taken)
+			}
+
+			if shuttingDown.Load() || halt.halted() {
+				notify()
+				results[index] = skippedResult(cmdInfo)
+				progress.finish(cmdInfo)
+				return
+			}
+
+			results[index] = startCommand(cmdInfo, notify)
+			halt.record(results[index])
+			// Commands that could not be started are done as well
+			progress.finish(cmdInfo)
+		}(cmd, i, previous, launched)
+
+		previous = launched
+	}
+
+	// The barrier opens once every command has been started
+	if gate := startGate; gate != nil {
+		go func() {
+			started.Wait()
+			printColoredMessage(fmt.Sprintf("All %d commands started, releasing the barrier", len(commands)), colorCyan)
+			gate.open()
+		}()
+	}
+
+	wg.Wait()
+	halt.report()
+	return results
+}
+
+// runSequential executes commands one after another
+func runSequential(commands []CommandInfo) []CommandResult {
+	results := make([]CommandResult, 0, len(commands))
+	halt := &haltCounter{}
+	notReady := false
+	// Environment describing the last command that ran, for the next one
+	var prevEnv []string
+	for i, cmd := range commands {
+		if shuttingDown.Load() || halt.halted() || notReady {
+			results = append(results, skippedResult(cmd))
+			continue
+		}
+
+		// Steps after the first wait for the --wait-for probes
+		if i > 0 && len(readinessProbes) > 0 {
+			if err := waitUntilReady(readinessProbes, waitTimeout, waitInterval); err != nil {
+				printCommandMessage(cmd.Tag, fmt.Sprintf("Not starting: %v", err), colorRed)
+				notReady = true
+				results = append(results, skippedResult(cmd))
+				continue
+			}
+		}
+
+		if met, reason := conditionMet(cmd, results); !met {
+			printCommandMessage(cmd.Tag, fmt.Sprintf("Skipping, condition ?%s not met: %s", cmd.RunIf, reason), colorCyan)
+			result := skippedResult(cmd)
+			result.Unmet = true
+			results = append(results, result)
+			continue
+		}
+
+		cmd.Env = append(cmd.Env, prevEnv...)
+		result := startCommand(cmd, nil)
+		halt.record(result)
+		results = append(results, result)
+		if !result.Detached {
+			prevEnv = previousCommandEnv(result)
+		}
+	}
+	halt.report()
+	return results
+}
+
+// previousCommandEnv returns the environment variables telling the next
+// sequential command how the previous one ended
+func previousCommandEnv(result CommandResult) []string {
+	return []string{"RUFL_PREV_EXIT=" + strconv.Itoa(result.ExitCode), "RUFL_PREV_TAG=" + result.Tag}
+}
+
+// haltCounter counts failed commands to stop launching new ones once
+// --halt-after failures have been reached
+type haltCounter struct {
+	mutex    sync.Mutex
+	failures int
+	skipped  int
+}
+
+// record counts the result of a finished command
+func (h *haltCounter) record(result CommandResult) {
+	if result.Success {
+		return
 	}
-
-	return commands
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.failures++
 }
 
-// runCommands executes the given commands either in parallel or sequentially
-func runCommands(commands []CommandInfo, parallel bool) {
-	parallelMode = parallel
-	if parallel {
-		runParallel(commands)
-	} else {
-		runSequential(commands)
+// halted reports whether the next command should be skipped, counting it if so
+func (h *haltCounter) halted() bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if haltAfter <= 0 || h.failures < haltAfter {
+		return false
 	}
+	h.skipped++
+	return true
 }
 
-// runParallel executes commands in parallel
-func runParallel(commands []CommandInfo) {
-	var wg sync.WaitGroup
-	wg.Add(len(commands))
+// report prints how many commands were skipped because of failures
+func (h *haltCounter) report() {
+	if h.skipped > 0 {
+		printColoredMessage(fmt.Sprintf("Halted after %d failures, skipped %d commands", h.failures, h.skipped), colorYellow)
+	}
+}
 
-	// Start commands in order, but let them run concurrently
-	for i, cmd := range commands {
-		go func(cmdInfo CommandInfo, index int) {
-			defer wg.Done()
-			executeCommand(cmdInfo)
-		}(cmd, i)
+// doneCounter counts the commands of a parallel run that have finished, to
+// show the overall progress in their completion messages
+type doneCounter struct {
+	finished sync.Map // Indexes of the commands that are done
+	done     atomic.Int32
+	total    int32
+}
 
-		// Wait a small amount of time to ensure commands start in order
-		// This is a simple approach that works well in practice
-		time.Sleep(10 * time.Millisecond)
+// newDoneCounter returns a counter for the given commands. Detached commands
+// are not waited for, so they are not counted.
+func newDoneCounter(commands []CommandInfo) *doneCounter {
+	counter := &doneCounter{}
+	for _, cmdInfo := range commands {
+		if !cmdInfo.Detach {
+			counter.total++
+		}
 	}
-
-	wg.Wait()
+	return counter
 }
 
-// runSequential executes commands one after another
-func runSequential(commands []CommandInfo) {
-	for _, cmd := range commands {
-		executeCommand(cmd)
+// finish counts a command as done, once however often it is restarted, and
+// returns the progress for its completion message, such as " (4/10 done)".
+// Outside of a parallel run, for a single command and for detached
+// commands it returns an empty string.
+func (c *doneCounter) finish(cmdInfo CommandInfo) string {
+	if c == nil || cmdInfo.Detach {
+		return ""
+	}
+	if _, seen := c.finished.LoadOrStore(cmdInfo.Index, true); !seen {
+		c.done.Add(1)
 	}
+	if c.total < 2 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d/%d done)", c.done.Load(), c.total)
+}
+
+// skippedResult returns the result of a command that was never started
+func skippedResult(cmdInfo CommandInfo) CommandResult {
+	return CommandResult{Tag: cmdInfo.Tag, Command: cmdInfo.Command, ExitCode: -1, Skipped: true}
 }
 
 // needsShell determines if a command needs a shell to be executed
@@ -330,8 +2081,16 @@ func needsShell(command string) bool {
 		return true
 	}
 
+	// Multi-line scripts are run by the shell as a whole
+	if strings.Contains(command, "\n") {
+		return true
+	}
+
 	// Check for shell special characters
 	for _, char := range shellSpecialChars {
+		if expandGlobs && isGlobChar(char) {
+			continue
+		}
 		if strings.Contains(command, char) {
 			return true
 		}
@@ -352,20 +2111,117 @@ func needsShell(command string) bool {
 		return true
 	}
 
-	// Check for glob patterns
-	if strings.Contains(command, "*") || strings.Contains(command, "?") || strings.Contains(command, "[") {
+	// Check for glob patterns, unless rufl expands them itself
+	if !expandGlobs && strings.ContainsAny(command, "*?[") {
 		return true
 	}
 
 	return false
 }
 
-// executeCommand executes a single command
-func executeCommand(cmdInfo CommandInfo) {
+// executeCommand executes a single command, restarting it when it exits if
+// the restart policy asks for it, and returns the result of its last run
+func executeCommand(cmdInfo CommandInfo) CommandResult {
+	return executeCommandNotify(cmdInfo, nil)
+}
+
+// executeCommandNotify is like executeCommand, but calls launched once the
+// command has been started for the first time, or has failed to start
+func executeCommandNotify(cmdInfo CommandInfo, launched func()) CommandResult {
+	restarts := 0
+	startTime := time.Now()
+
+	var result CommandResult
+	var userTime, systemTime time.Duration
+	for {
+		result = runCommand(cmdInfo, launched)
+		launched = nil
+		userTime += result.UserTime
+		systemTime += result.SystemTime
+
+		if !shouldRestart(result.Success, restarts) || wasInterrupted() || wasStopped(cmdInfo.Tag) || (cmdInfo.Detach && stoppingDetached.Load()) {
+			break
+		}
+
+		restarts++
+		recordRestart(cmdInfo.Tag)
+		limit := ""
+		if maxRestarts > 0 {
+			limit = fmt.Sprintf(" of %d", maxRestarts)
+		}
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Restarting in %v (restart %d%s)", restartDelay, restarts, limit), colorYellow)
+		time.Sleep(restartDelay)
+	}
+
+	if restarts > 0 {
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Command was restarted %d times", restarts), colorYellow)
+	}
+
+	result.Restarts = restarts
+	result.Duration = time.Since(startTime)
+	result.UserTime = userTime
+	result.SystemTime = systemTime
+	return result
+}
+
+// shouldRestart decides from the restart policy whether a command that just
+// exited should be started again
+func shouldRestart(success bool, restarts int) bool {
+	if maxRestarts > 0 && restarts >= maxRestarts {
+		return false
+	}
+
+	switch restartPolicy {
+	case "always":
+		return true
+	case "on-failure":
+		return !success
+	case "on-success":
+		return success
+	default:
+		return false
+	}
+}
+
+// wasInterrupted reports whether the user interrupted the current sequential
+// command, in which case it should not be restarted
+func wasInterrupted() bool {
+	currentCmdMutex.Lock()
+	defer currentCmdMutex.Unlock()
+	return currentCmdInterrupted
+}
+
+// runCommand runs a single command once and returns its result. If launched
+// is not nil, it is called as soon as the command has been started or has
+// failed to start.
+func runCommand(cmdInfo CommandInfo, launched func()) CommandResult {
 	var cmd *exec.Cmd
+	result := CommandResult{Tag: cmdInfo.Tag, Command: cmdInfo.Command, ExitCode: -1}
+	progress := runProgress
+
+	notifyLaunched := func() {
+		if launched != nil {
+			launched()
+			launched = nil
+		}
+	}
+	defer notifyLaunched()
 
-	// Check if the command needs a shell
-	if needsShell(cmdInfo.Command) {
+	// A shell or ssh would run an empty command as a no-op that succeeds
+	if strings.TrimSpace(cmdInfo.Command) == "" {
+		printCommandMessage(cmdInfo.Tag, "Empty command", colorRed)
+		return result
+	}
+
+	if cmdInfo.Host != "" {
+		// The remote login shell interprets the command
+		cmd = sshCommand(cmdInfo.Host, cmdInfo.Command)
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Executing on %s: %s", cmdInfo.Host, echoCommand(commandSummary(cmdInfo.Command))), colorCyan)
+	} else if cmdInfo.Image != "" {
+		// The shell in the container interprets the command
+		cmd = containerCommand(cmdInfo)
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Executing in %s: %s", cmdInfo.Image, echoCommand(commandSummary(cmdInfo.Command))), colorCyan)
+	} else if needsShell(cmdInfo.Command) {
 		// Determine the shell to use based on the OS
 		var shell, shellArg string
 		if runtime.GOOS == "windows" {
@@ -377,35 +2233,52 @@ func executeCommand(cmdInfo CommandInfo) {
 		}
 
 		// Create the command using the shell
-		cmd = exec.Command(shell, shellArg, cmdInfo.Command)
-		printColoredMessage(fmt.Sprintf("[%s] Executing with shell: %s", cmdInfo.Tag, cmdInfo.Command), colorCyan)
+		cmd = newCommand(shell, shellArg, cmdInfo.Command)
+		lineBuffered(cmd)
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Executing with shell: %s", echoCommand(commandSummary(cmdInfo.Command))), colorCyan)
 	} else {
 		// Parse the command using go-shlex
 		args, err := shlex.Split(cmdInfo.Command, true)
 		if err != nil {
-			printColoredMessage(fmt.Sprintf("[%s] Error parsing command: %v", cmdInfo.Tag, err), colorRed)
-			return
+			printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Error parsing command: %v", err), colorRed)
+			return result
 		}
 
 		if len(args) == 0 {
-			printColoredMessage(fmt.Sprintf("[%s] Empty command", cmdInfo.Tag), colorRed)
-			return
+			printCommandMessage(cmdInfo.Tag, "Empty command", colorRed)
+			return result
+		}
+
+		if expandGlobs {
+			args, err = expandGlobArgs(commandDir(cmdInfo), args)
+			if err != nil {
+				printCommandMessage(cmdInfo.Tag, err.Error(), colorRed)
+				return result
+			}
 		}
 
 		// Create the command directly without a shell
-		cmd = exec.Command(args[0], args[1:]...)
-		printColoredMessage(fmt.Sprintf("[%s] Executing directly: %s", cmdInfo.Tag, cmdInfo.Command), colorCyan)
+		cmd = newCommand(args[0], args[1:]...)
+		lineBuffered(cmd)
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Executing directly: %s", echoCommand(cmdInfo.Command)), colorCyan)
+	}
+
+	if printArgv {
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("argv: %s", formatArgv(cmd.Args)), colorPurple)
 	}
 
 	// If in sequential mode, set this as the current command
-	if !parallelMode {
+	if !parallelMode && !cmdInfo.Detach {
 		currentCmdMutex.Lock()
 		currentSequentialCmd = cmd
+		currentCmdInterrupted = false
 		currentCmdMutex.Unlock()
 	}
 
-	// Inherit environment variables from the parent process
-	env := os.Environ()
+	// Inherit environment variables from the parent process and tell
+	// nested rufl runs how deep they are
+	env := append(inheritedEnv(), depthEnv())
+	env = append(env, cmdInfo.Env...)
 
 	// Add any additional environment variables
 	if len(envVars) > 0 {
@@ -413,109 +2286,645 @@ func executeCommand(cmdInfo CommandInfo) {
 	}
 
 	cmd.Env = env
+	cmd.Dir = commandDir(cmdInfo)
 
-	// Set up pipes for stdout and stderr
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		fmt.Printf("Error creating stdout pipe for command %s: %v\n", cmdInfo.Tag, err)
-		return
+	if gate := startGate; gate != nil {
+		gate.attach(cmd)
 	}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		fmt.Printf("Error creating stderr pipe for command %s: %v\n", cmdInfo.Tag, err)
-		return
+	if len(cmdInfo.Redirects) > 0 {
+		closeRedirects, err := openRedirects(cmd, cmdInfo.Redirects)
+		if err != nil {
+			printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Error redirecting file descriptors: %v", err), colorRed)
+			return result
+		}
+		defer closeRedirects()
 	}
 
 	// Print environment variables if any were added
 	if len(envVars) > 0 {
-		printColoredMessage(fmt.Sprintf("[%s] With additional environment: %s", cmdInfo.Tag, strings.Join(envVars, ", ")), colorPurple)
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("With additional environment: %s", strings.Join(envVars, ", ")), colorPurple)
 	}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		printColoredMessage(fmt.Sprintf("[%s] Error starting command: %v", cmdInfo.Tag, err), colorRed)
-		return
+	var streams []outputStream
+	var releasePTY func()
+
+	if usePTY {
+		// A pseudo-terminal merges stdout and stderr into a single stream
+		output, release, err := startWithPTY(cmd)
+		if err != nil {
+			printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Error starting command: %v", err), colorRed)
+			emitEvent(Event{Event: "exited", Tag: cmdInfo.Tag, Command: cmdInfo.Command, Error: err.Error()})
+			return result
+		}
+		releasePTY = release
+		streams = []outputStream{{output, "out", colorGreen}}
+	} else {
+		// Forward rufl's stdin to this command if it is the receiver
+		if receivesStdin(cmdInfo) {
+			stdin, err := cmd.StdinPipe()
+			if err != nil {
+				fmt.Printf("Error creating stdin pipe for command %s: %v\n", cmdInfo.Tag, err)
+				return result
+			}
+			if setStdinTarget(stdin) {
+				defer clearStdinTarget(stdin)
+			} else {
+				_ = stdin.Close()
+			}
+		}
+
+		// Set up pipes for stdout and stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			fmt.Printf("Error creating stdout pipe for command %s: %v\n", cmdInfo.Tag, err)
+			return result
+		}
+
+		streams = []outputStream{{stdout, "out", colorGreen}}
+
+		if mergeStreams {
+			// Writing both streams to the same pipe keeps the order in
+			// which the command printed them
+			cmd.Stderr = cmd.Stdout
+		} else {
+			stderr, err := cmd.StderrPipe()
+			if err != nil {
+				fmt.Printf("Error creating stderr pipe for command %s: %v\n", cmdInfo.Tag, err)
+				return result
+			}
+			streams = append(streams, outputStream{stderr, "err", colorRed})
+		}
+
+		// Pausing has to reach every process of the command. A
+		// pseudo-terminal already gives it a session of its own.
+		if pauseKeys {
+			groupProcesses(cmd)
+		}
+
+		// Start the command
+		if err := cmd.Start(); err != nil {
+			printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Error starting command: %v", err), colorRed)
+			printSuggestion(cmdInfo.Tag, cmd, err)
+			emitEvent(Event{Event: "exited", Tag: cmdInfo.Tag, Command: cmdInfo.Command, Error: err.Error()})
+			return result
+		}
+	}
+
+	if len(cpuSet) > 0 {
+		if err := applyCPUSet(cmd.Process.Pid, cpuSet); err != nil {
+			printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Error setting CPU affinity: %v", err), colorRed)
+		}
+	}
+
+	if cmdInfo.Nice != 0 {
+		if err := setNiceness(cmd.Process.Pid, cmdInfo.Nice); err != nil {
+			printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Error setting niceness %d: %v", cmdInfo.Nice, err), colorRed)
+		} else {
+			result.Nice = cmdInfo.Nice
+		}
+	}
+
+	if maxMemory > 0 {
+		stopWatching := watchMemory(cmdInfo.Tag, cmd.Process.Pid)
+		defer stopWatching()
+	}
+
+	// Detached commands are not limited, as they are expected to keep running
+	var watchdogs []*watchdog
+	timeout := commandTimeout
+	if cmdInfo.Timeout > 0 {
+		timeout = cmdInfo.Timeout
 	}
+	if timeout > 0 && !cmdInfo.Detach {
+		watchdogs = append(watchdogs, startWatchdog(cmdInfo.Tag, cmd, timeout, fmt.Sprintf("Timed out after %v", timeout)))
+	}
+	if idleTimeout > 0 && !cmdInfo.Detach {
+		idle := startIdleWatchdog(cmdInfo.Tag, cmd, idleTimeout, fmt.Sprintf("No output for %v", idleTimeout))
+		watchdogs = append(watchdogs, idle)
+		for i := range streams {
+			streams[i].reader = activityReader{r: streams[i].reader, onRead: idle.reset}
+		}
+	}
+
+	startTime := time.Now()
+	emitEvent(Event{Event: "started", Tag: cmdInfo.Tag, Command: cmdInfo.Command, PID: cmd.Process.Pid})
+	notifyLaunched()
 
 	// Store the command in the active commands map
 	cmdID := fmt.Sprintf("%s-%d", cmdInfo.Tag, cmd.Process.Pid)
 	activeCommands.Store(cmdID, cmd)
 
-	// Create a wait group for the goroutines that read output
-	var outputWg sync.WaitGroup
-	outputWg.Add(2)
+	if cmdInfo.Detach {
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Detached (pid %d), not waiting for it to finish", cmd.Process.Pid), colorCyan)
+	}
 
-	// Process stdout
-	go func() {
-		defer outputWg.Done()
-		processOutput(stdout, cmdInfo.Tag, "out", colorGreen)
-	}()
+	// Commands launched while the run is paused wait for it to resume
+	if paused.Load() {
+		_ = stopProcess(cmd.Process)
+	}
 
-	// Process stderr
-	go func() {
-		defer outputWg.Done()
-		processOutput(stderr, cmdInfo.Tag, "err", colorRed)
-	}()
+	expectations := startExpectations(cmdInfo.Tag)
+
+	// Create a wait group for the goroutines that read output
+	var outputWg sync.WaitGroup
+	outputWg.Add(len(streams))
+
+	// Process each output stream
+	for _, stream := range streams {
+		go func(stream outputStream) {
+			defer outputWg.Done()
+			processCommandOutput(decodeOutput(stream.reader, cmdInfo), cmdInfo.Tag, stream.streamType, prefixColor(cmdInfo, stream.color), startTime, expectations)
+		}(stream)
+	}
 
-	// Wait for all output to be processed
+	// Wait for all output to be processed. Every line has been written once
+	// its stream is drained, so nothing the command printed can come after
+	// the messages about how it ended.
 	outputWg.Wait()
 
+	if releasePTY != nil {
+		releasePTY()
+	}
+
 	// Wait for the command to complete
-	err = cmd.Wait()
+	err := cmd.Wait()
+
+	// A command that has exited can no longer time out
+	for _, w := range watchdogs {
+		w.stop()
+	}
 
 	// Remove the command from the active commands map
 	activeCommands.Delete(cmdID)
 
 	// If in sequential mode, clear the current command
-	if !parallelMode {
+	if !parallelMode && !cmdInfo.Detach {
 		currentCmdMutex.Lock()
 		currentSequentialCmd = nil
 		currentCmdMutex.Unlock()
 	}
 
+	exitCode := exitCodeOf(err)
+	result.ExitCode = exitCode
+	for _, w := range watchdogs {
+		result.TimedOut = result.TimedOut || w.timedOut()
+	}
+	result.Duration = time.Since(startTime)
+	if cmd.ProcessState != nil {
+		result.UserTime = cmd.ProcessState.UserTime()
+		result.SystemTime = cmd.ProcessState.SystemTime()
+	}
+	exitedEvent := Event{Event: "exited", Tag: cmdInfo.Tag, ExitCode: &exitCode, Duration: result.Duration.Seconds()}
+	if err != nil {
+		exitedEvent.Error = err.Error()
+	}
+	emitEvent(exitedEvent)
+
+	done := progress.finish(cmdInfo)
+
+	// Expected output is checked once all of it has been seen
+	unmet := expectations.finish()
+	result.MissingOutput = len(unmet) > 0
+	for _, pattern := range unmet {
+		printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Expected output not found: %s", pattern), colorRed)
+	}
+
 	if err != nil {
 		// Check if it's an exit error
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			status := exitErr.Sys().(syscall.WaitStatus)
-			printColoredMessage(fmt.Sprintf("[%s] Command exited with status: %d", cmdInfo.Tag, status.ExitStatus()), colorYellow)
+			printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Command exited with status: %d%s", status.ExitStatus(), done), colorYellow)
+			if cmdInfo.Host != "" && status.ExitStatus() == sshConnectionFailed {
+				printCommandMessage(cmdInfo.Tag, fmt.Sprintf("ssh could not run the command on %s (connection or authentication failed)", cmdInfo.Host), colorRed)
+			}
+			if cmdInfo.Image != "" && status.ExitStatus() == containerRuntimeFailed {
+				printCommandMessage(cmdInfo.Tag, fmt.Sprintf("%s could not start a container of %s (image pull or runtime error)", containerRuntime, cmdInfo.Image), colorRed)
+			}
 		} else {
-			printColoredMessage(fmt.Sprintf("[%s] Error waiting for command: %v", cmdInfo.Tag, err), colorRed)
+			printCommandMessage(cmdInfo.Tag, fmt.Sprintf("Error waiting for command: %v%s", err, done), colorRed)
 		}
-	} else {
-		printColoredMessage(fmt.Sprintf("[%s] Command completed successfully", cmdInfo.Tag), colorGreen)
+		return result
+	}
+
+	// A command that exits cleanly when stopped still ran out of time
+	if result.TimedOut {
+		return result
+	}
+
+	// A command that did not print what was expected failed
+	if len(unmet) > 0 {
+		return result
+	}
+
+	printCommandMessage(cmdInfo.Tag, "Command completed successfully"+done, colorGreen)
+	result.Success = true
+	return result
+}
+
+// formatArgv renders the arguments a command is executed with as a JSON
+// array, which shows exactly where each argument starts and ends
+func formatArgv(args []string) string {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	// Encoding a string slice cannot fail
+	_ = encoder.Encode(args)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// printSuggestion suggests a similarly named program from PATH when a
+// command could not be started because its program was not found
+func printSuggestion(tag string, cmd *exec.Cmd, err error) {
+	if !errors.Is(err, exec.ErrNotFound) || len(cmd.Args) == 0 {
+		return
+	}
+
+	name := cmd.Args[0]
+	if suggestion := suggestCommand(name); suggestion != "" {
+		printCommandMessage(tag, fmt.Sprintf("'%s' not found — did you mean '%s'?", name, suggestion), colorYellow)
+	}
+}
+
+// exitCodeOf returns the exit code for the error returned by cmd.Wait,
+// or -1 if the command did not exit normally
+func exitCodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.Sys().(syscall.WaitStatus).ExitStatus()
 	}
+	return -1
 }
 
 // processOutput reads from a pipe and prints the output with a prefix
 func processOutput(pipe io.Reader, tag string, streamType string, color string) {
+	cmdInfo := CommandInfo{Tag: tag}
+	processCommandOutput(pipe, tag, streamType, prefixColor(cmdInfo, color), time.Now(), nil)
+}
+
+// prefixColor returns the color of a command's prefix: its own color from
+// the +tag#color syntax, else a color pinned to its tag with --tag-color,
+// else the color of the stream
+func prefixColor(cmdInfo CommandInfo, streamColor string) string {
+	if cmdInfo.Color != "" {
+		return cmdInfo.Color
+	}
+	if tagColor, ok := tagColors[cmdInfo.Tag]; ok {
+		return tagColor
+	}
+	return streamColor
+}
+
+// processCommandOutput is processOutput for a command started at the given
+// time, which --command-elapsed shows in the prefix of every line. Lines are
+// checked against the expectations of the command's run, if it has any.
+func processCommandOutput(pipe io.Reader, tag string, streamType string, color string, started time.Time, expectations *expectRun) {
 	scanner := bufio.NewScanner(pipe)
+	scanner.Buffer(make([]byte, bufferSize), bufferSize)
+	scanner.Split(splitFunc())
+	dedup := &lineDeduper{threshold: dedupThreshold}
 	for scanner.Scan() {
 		line := scanner.Text()
+		emitEvent(Event{Event: "line", Tag: tag, Stream: streamType, Line: line})
+		logOutputLine(tag, line)
+		fifoOutputLine(tag, line)
+		expectations.check(line)
 
-		// Format the prefix differently based on color settings
-		var prefix string
-		if noColor || !colorSupported {
-			// When color is disabled, include the stream type in the prefix
-			prefix = fmt.Sprintf("[%s:%s] ", tag, streamType)
-			fmt.Println(prefix + line)
-		} else {
-			// When color is enabled, omit the stream type as the color indicates it
-			prefix = fmt.Sprintf("[%s] ", tag)
-			fmt.Print(color + prefix + colorReset + line + "\n")
+		if !shouldPrintLine(tag, line) {
+			continue
+		}
+
+		for _, line := range dedup.add(line) {
+			printCommandLine(line, tag, streamType, color, started)
 		}
 	}
+	for _, line := range dedup.flush() {
+		printCommandLine(line, tag, streamType, color, started)
+	}
 
 	if err := scanner.Err(); err != nil {
-		printColoredMessage(fmt.Sprintf("[%s] Error reading %s: %v", tag, streamType, err), colorRed)
+		printCommandMessage(tag, fmt.Sprintf("Error reading %s: %v", streamType, err), colorRed)
 	}
 }
 
-// printColoredMessage prints a message with the specified color
-func printColoredMessage(message string, color string) {
+// printCommandLine formats a line of command output with its prefix and prints it
+func printCommandLine(line string, tag string, streamType string, color string, started time.Time) {
+	line = sanitizeLine(line)
+	if trimTrailing {
+		line = trimTrailingSpace(line)
+	}
+	displayTag := tag
+	if stripNestedPrefix {
+		displayTag, line = collapseNestedPrefix(tag, line)
+	}
+	line = highlightLine(line)
+	if colorWholeLine && !noColor && colorSupported {
+		line = colorLine(line, color)
+	}
+
+	now := time.Now()
+	timestamp := formatTimestamp(now)
+
+	elapsed := ""
+	if commandElapsed {
+		elapsed = fmt.Sprintf(" +%.1fs", now.Sub(started).Seconds())
+	}
+
+	// Format the prefix differently based on color settings
+	var prefix string
 	if noColor || !colorSupported {
-		fmt.Println(message)
+		// When color is disabled, include the stream type in the prefix
+		prefix = formatPrefix(fmt.Sprintf("%s:%s%s", displayTag, streamType, elapsed))
 	} else {
-		fmt.Println(color + message + colorReset)
+		// When color is enabled, omit the stream type as the color
+		// indicates it, unless it was asked for
+		stream := ""
+		if alwaysShowStream {
+			stream = ":" + streamType
+		}
+		prefix = color + formatPrefix(fmt.Sprintf("%s%s%s", displayTag, stream, elapsed)) + colorReset
+	}
+	prefix = tagIcon(tag) + linkPrefix(tag, prefix)
+
+	printOutputLine(outputLine{tag: tag, stream: streamType, timestamp: timestamp, prefix: prefix, text: line})
+}
+
+// formatTimestamp returns the timestamp to put in front of an output line,
+// including a trailing space, or an empty string if timestamps are off.
+// Relative timestamps use the monotonic clock, so they are not affected by
+// wall clock adjustments.
+func formatTimestamp(now time.Time) string {
+	switch timestampMode {
+	case "wall":
+		return now.Format("15:04:05.000") + " "
+	case "relative":
+		return fmt.Sprintf("+%.3fs ", now.Sub(ruflStartTime).Seconds())
+	default:
+		return ""
+	}
+}
+
+// splitFunc returns the scanner split function selected with --split. Any
+// token that does not fit into the buffer is returned in buffer-sized chunks
+// instead of failing with bufio.ErrTooLong.
+func splitFunc() bufio.SplitFunc {
+	switch splitMode {
+	case "null":
+		return chunkedSplit(scanNull, bufferSize)
+	case "word":
+		return chunkedSplit(bufio.ScanWords, bufferSize)
+	default:
+		return chunkedSplit(bufio.ScanLines, bufferSize)
+	}
+}
+
+// chunkedSplit wraps a split function so that when a token does not fit into
+// the buffer, the buffered part is returned as a token
+func chunkedSplit(split bufio.SplitFunc, limit int) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if advance == 0 && token == nil && err == nil && len(data) >= limit {
+			return len(data), data, nil
+		}
+		return advance, token, err
+	}
+}
+
+// scanNull is a split function returning NUL-terminated records, as
+// produced for example by find -print0
+func scanNull(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// outputLine is a line of command output ready to be printed
+type outputLine struct {
+	tag       string // Tag of the command the line came from
+	stream    string // Stream type, "out" or "err"
+	timestamp string // Rendered timestamp, may be empty
+	prefix    string // Rendered prefix, including any color codes
+	text      string // The line itself
+}
+
+// printOutputLine prints a line of command output. Writes are serialized so
+// lines from different commands never get glued together, and every line is
+// terminated with a newline even if the command's last line was not. When a
+// prefix separator is set, it is printed whenever the output switches from
+// one command to another. With --prefix-once, the prefix of a line coming
+// from the same command and stream as the previous line is replaced by
+// blank space. With --prefix-to-stderr, stdout lines are written to stdout
+// as they are and everything else goes to stderr. With --buffer-until-exit,
+// the line is held back until every command has finished.
+func printOutputLine(line outputLine) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+
+	if bufferLine(line) || exceedsOutputLimit(line.timestamp+line.prefix+line.text) {
+		return
+	}
+
+	if prefixToStderr && line.stream == "out" {
+		text := line.text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		writeStdout(text)
+		return
+	}
+
+	if prefixSeparator != "" && lastOutputSource != "" && lastOutputSource != line.tag {
+		writeDecoration(prefixSeparator + "\n")
+	}
+	lastOutputSource = line.tag
+
+	prefix := line.prefix
+	source := line.tag + ":" + line.stream
+	if prefixOnce && source == lastPrefixSource {
+		prefix = strings.Repeat(" ", visibleWidth(prefix))
+	}
+	lastPrefixSource = source
+
+	text := line.timestamp + prefix + line.text
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	writeDecoration(text)
+}
+
+// ansiPattern matches ANSI escape sequences, including OSC sequences such
+// as hyperlinks
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+
+// visibleWidth returns the number of terminal columns a string occupies,
+// ignoring ANSI escape sequences
+func visibleWidth(s string) int {
+	return runewidth.StringWidth(ansiPattern.ReplaceAllString(s, ""))
+}
+
+// printColoredMessage prints one of rufl's own status messages with the
+// specified color. Unless --no-rufl-marker is set, the message starts with a
+// dimmed "rufl:" marker so it cannot be mistaken for command output.
+func printColoredMessage(message string, color string) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	writeMessage(message, color)
+}
+
+// printCommandMessage prints a status message about the command with tag,
+// such as "[build] Command completed successfully". With
+// --buffer-until-exit, it is held back along with the command's output.
+func printCommandMessage(tag string, message string, color string) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+
+	message = fmt.Sprintf("[%s] %s", tag, message)
+	if bufferMessage(tag, formatMessage(message, color)) {
+		return
+	}
+	writeMessage(message, color)
+}
+
+// writeMessage is printColoredMessage for callers that hold outputMutex
+func writeMessage(message string, color string) {
+	// Output after a status message always shows its prefix again
+	lastPrefixSource = ""
+	writeDecoration(formatMessage(message, color))
+}
+
+// formatMessage renders a status message as a line with its marker and color
+func formatMessage(message string, color string) string {
+	marker := ""
+	if !noRuflMarker && !strings.HasPrefix(message, ruflMarker) {
+		marker = ruflMarker
+	}
+
+	if noColor || !colorSupported {
+		return marker + message + "\n"
+	}
+	if marker != "" {
+		marker = colorDim + marker + colorReset
+	}
+	return marker + color + message + colorReset + "\n"
+}
+
+// printText prints text as it is, without a marker or color
+func printText(text string) {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+
+	lastPrefixSource = ""
+	writeStdout(text)
+}
+
+// writeDecoration writes prefixed output and status messages, which go to
+// stderr with --prefix-to-stderr. Batched stdout is flushed first, so a
+// status message such as "Command completed" never overtakes the last raw
+// stdout lines of its command. Must be called with outputMutex held.
+func writeDecoration(text string) {
+	if prefixToStderr {
+		if batchWriter != nil && !stdoutBroken {
+			checkWriteError(batchWriter.Flush())
+		}
+		recordOutput(text)
+		_, _ = io.WriteString(os.Stderr, text)
+		return
+	}
+	writeStdout(text)
+}
+
+// writeStdout writes text to rufl's output and handles a broken stdout.
+// Must be called with outputMutex held.
+func writeStdout(text string) {
+	if stdoutBroken {
+		return
+	}
+	recordOutput(text)
+	_, err := io.WriteString(stdoutWriter(), text)
+	checkWriteError(err)
+}
+
+// checkWriteError detects that rufl's stdout was closed by its reader (for
+// example "rufl ... | head"). Further output is discarded, and unless
+// --ignore-broken-pipe is set, all commands are stopped and rufl exits.
+// Must be called with outputMutex held.
+func checkWriteError(err error) {
+	if err == nil || !isBrokenPipe(err) || stdoutBroken {
+		return
+	}
+	stdoutBroken = true
+
+	if ignoreBrokenPipe {
+		fmt.Fprintln(os.Stderr, "rufl: stdout closed (broken pipe), discarding further output")
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "rufl: stdout closed (broken pipe), stopping all commands")
+	// Exiting needs outputMutex, which the caller holds
+	go func() {
+		terminateActiveCommands()
+		shutdownRufl(141) // 128 + SIGPIPE (13)
+	}()
+}
+
+// stdoutWriter returns where rufl's output goes: the batching buffer when
+// output is batched, stdout otherwise. Must be called with outputMutex held.
+func stdoutWriter() io.Writer {
+	if batchWriter != nil {
+		return batchWriter
+	}
+	return os.Stdout
+}
+
+// startBatching buffers all output and writes it out at the given interval
+// instead of line by line. The returned function stops batching and flushes
+// whatever is still buffered.
+func startBatching(interval time.Duration) func() {
+	outputMutex.Lock()
+	batchWriter = bufio.NewWriterSize(os.Stdout, bufferSize)
+	outputMutex.Unlock()
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				flushOutput()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+
+		outputMutex.Lock()
+		defer outputMutex.Unlock()
+		if batchWriter != nil {
+			checkWriteError(batchWriter.Flush())
+			batchWriter = nil
+		}
+	}
+}
+
+// flushOutput writes out any batched output
+func flushOutput() {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if batchWriter != nil && !stdoutBroken {
+		checkWriteError(batchWriter.Flush())
 	}
 }
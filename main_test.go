@@ -6,10 +6,12 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestProcessCommands(t *testing.T) {
@@ -89,6 +91,24 @@ func TestProcessCommands(t *testing.T) {
 	}
 }
 
+// TestFormatArgv tests that arguments are shown as a JSON array without HTML escaping
+func TestFormatArgv(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"go", "build", "./..."}, want: `["go","build","./..."]`},
+		{args: []string{"sh", "-c", `echo "hi" > out.txt`}, want: `["sh","-c","echo \"hi\" > out.txt"]`},
+		{args: []string{"printf", "a b\n"}, want: `["printf","a b\n"]`},
+	}
+
+	for _, tt := range tests {
+		if got := formatArgv(tt.args); got != tt.want {
+			t.Errorf("formatArgv(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
 func TestNeedsShell(t *testing.T) {
 	// Reset global variables before each test
 	forceShell = false
@@ -220,6 +240,194 @@ func TestNeedsShell(t *testing.T) {
 	}
 }
 
+func TestExpandVariables(t *testing.T) {
+	oldVars := vars
+	defer func() { vars = oldVars }()
+
+	tests := []struct {
+		name    string
+		vars    []string
+		command string
+		want    string
+	}{
+		{
+			name:    "Simple variable",
+			vars:    []string{"GO=go run -race"},
+			command: "$GO ./cmd/server",
+			want:    "go run -race ./cmd/server",
+		},
+		{
+			name:    "Braced variable",
+			vars:    []string{"DIR=./cmd"},
+			command: "ls ${DIR}/server",
+			want:    "ls ./cmd/server",
+		},
+		{
+			name:    "Unknown variable is left for the shell",
+			vars:    []string{"GO=go"},
+			command: "echo $HOME ${PATH}",
+			want:    "echo $HOME ${PATH}",
+		},
+		{
+			name:    "Longest name wins",
+			vars:    []string{"GO=go"},
+			command: "echo $GOPATH",
+			want:    "echo $GOPATH",
+		},
+		{
+			name:    "Value containing equals",
+			vars:    []string{"FLAGS=-ldflags=-s"},
+			command: "go build $FLAGS",
+			want:    "go build -ldflags=-s",
+		},
+		{
+			name:    "Trailing dollar",
+			vars:    []string{"GO=go"},
+			command: "echo cost$",
+			want:    "echo cost$",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vars = tt.vars
+
+			got := expandVariables([]CommandInfo{{Command: tt.command, Tag: "1"}})
+			if got[0].Command != tt.want {
+				t.Errorf("expandVariables() = %q, want %q", got[0].Command, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmCommands(t *testing.T) {
+	commands := []CommandInfo{
+		{Command: "echo hello", Tag: "greeting", Index: 0},
+		{Command: "rm -rf build | tee log", Tag: "clean", Index: 1},
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  bool
+	}{
+		{name: "Yes", input: "y\n", want: true},
+		{name: "Full yes", input: "YES\n", want: true},
+		{name: "No", input: "n\n", want: false},
+		{name: "Empty answer", input: "\n", want: false},
+		{name: "No input", input: "", want: false},
+		{name: "Anything else", input: "sure\n", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			output := captureStdout(func() {
+				got = confirmCommands(commands, true, strings.NewReader(tt.input))
+			})
+
+			if got != tt.want {
+				t.Errorf("confirmCommands() = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(output, "[greeting] echo hello (direct)") || !strings.Contains(output, "[clean] rm -rf build | tee log (shell)") {
+				t.Errorf("confirmCommands() output = %q, want the command plan", output)
+			}
+			if !strings.Contains(output, "Run these 2 commands? [y/N]") {
+				t.Errorf("confirmCommands() output = %q, want the prompt", output)
+			}
+		})
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	oldDryRun := dryRun
+	dryRun = true
+	defer func() { dryRun = oldDryRun }()
+
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	commands := []CommandInfo{{Command: "touch " + marker, Tag: "touch", Index: 0}}
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runCommands(commands, false)
+	})
+
+	if results != nil {
+		t.Errorf("runCommands() with --dry-run = %v, want no results", results)
+	}
+	if !strings.Contains(output, "Commands to run sequentially:") || !strings.Contains(output, "[touch] touch ") {
+		t.Errorf("runCommands() with --dry-run output = %q, want the command plan", output)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("runCommands() with --dry-run ran the command")
+	}
+}
+
+func TestKeepaliveMessage(t *testing.T) {
+	if got := keepaliveMessage(1); got != "rufl: still running (1 command active)" {
+		t.Errorf("keepaliveMessage(1) = %q", got)
+	}
+	if got := keepaliveMessage(3); got != "rufl: still running (3 commands active)" {
+		t.Errorf("keepaliveMessage(3) = %q", got)
+	}
+}
+
+func TestPrintBanner(t *testing.T) {
+	oldNoColor := noColor
+	oldColorSupported := colorSupported
+	noColor = false
+	colorSupported = true
+	defer func() {
+		noColor = oldNoColor
+		colorSupported = oldColorSupported
+	}()
+
+	tests := []struct {
+		name      string
+		results   []CommandResult
+		want      string
+		wantColor string
+	}{
+		{
+			name:      "All succeeded",
+			results:   []CommandResult{{Success: true}, {Success: true}},
+			want:      "rufl: 2 succeeded, 0 failed (elapsed 12.3s)",
+			wantColor: colorGreen,
+		},
+		{
+			name:      "Some failed",
+			results:   []CommandResult{{Success: true}, {ExitCode: 1}},
+			want:      "rufl: 1 succeeded, 1 failed (elapsed 12.3s)",
+			wantColor: colorRed,
+		},
+		{
+			name:      "Timed out",
+			results:   []CommandResult{{Success: true}, {ExitCode: 1}, {TimedOut: true}},
+			want:      "rufl: 1 succeeded, 1 failed, 1 timed out (elapsed 12.3s)",
+			wantColor: colorRed,
+		},
+		{
+			name:      "Skipped",
+			results:   []CommandResult{{ExitCode: 1}, {ExitCode: -1, Skipped: true}},
+			want:      "rufl: 0 succeeded, 1 failed, 1 skipped (elapsed 12.3s)",
+			wantColor: colorRed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := captureStdout(func() {
+				printBanner(tt.results, 12300*time.Millisecond)
+			})
+
+			if output != tt.wantColor+tt.want+colorReset+"\n" {
+				t.Errorf("printBanner() output = %q, want %q in color %q", output, tt.want, tt.wantColor)
+			}
+		})
+	}
+}
+
 // TestExecuteCommand is an integration test that actually runs commands
 func TestExecuteCommand(t *testing.T) {
 	// Skip if running in CI environment
@@ -298,7 +506,7 @@ func TestRunCommands(t *testing.T) {
 	}
 
 	// Test sequential execution
-	runCommands(commands, false)
+	results := runCommands(commands, false)
 
 	// Restore stdout
 	w.Close()
@@ -317,6 +525,14 @@ func TestRunCommands(t *testing.T) {
 		t.Errorf("runCommands() output = %v, want to contain 'first' and 'second'", output)
 	}
 
+	// Check the results and the final banner
+	if len(results) != 2 || !results[0].Success || !results[1].Success || results[1].Tag != "2" {
+		t.Errorf("runCommands() results = %+v, want two successful results in order", results)
+	}
+	if !strings.Contains(output, "rufl: 2 succeeded, 0 failed") {
+		t.Errorf("runCommands() output = %v, want the final banner", output)
+	}
+
 	// Now test parallel execution
 	r, w, _ = os.Pipe()
 	os.Stdout = w
@@ -340,6 +556,94 @@ func TestRunCommands(t *testing.T) {
 	}
 }
 
+// TestRunParallelHaltAfter tests that queued commands are skipped once enough commands failed
+func TestRunParallelHaltAfter(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldMaxParallel, oldHaltAfter := maxParallel, haltAfter
+	maxParallel, haltAfter = 1, 1
+	defer func() {
+		maxParallel, haltAfter = oldMaxParallel, oldHaltAfter
+	}()
+
+	commands := []CommandInfo{
+		{Command: "echo first", Tag: "1", Index: 0},
+		{Command: "exit 3", Tag: "2", Index: 1},
+		{Command: "echo third", Tag: "3", Index: 2},
+		{Command: "echo fourth", Tag: "4", Index: 3},
+	}
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runParallel(commands)
+	})
+
+	if len(results) != 4 || !results[0].Success || results[1].Success || results[1].Skipped {
+		t.Fatalf("runParallel() results = %+v, want the first two commands to run", results)
+	}
+	if !results[2].Skipped || !results[3].Skipped {
+		t.Errorf("runParallel() results = %+v, want the last two commands skipped", results)
+	}
+	if strings.Contains(output, "third") || !strings.Contains(output, "skipped 2 commands") {
+		t.Errorf("runParallel() output = %q, want the skipped commands reported and not run", output)
+	}
+}
+
+// TestDoneCounter tests counting the commands of a parallel run that are done
+func TestDoneCounter(t *testing.T) {
+	commands := []CommandInfo{{Tag: "a"}, {Tag: "b", Index: 1}, {Tag: "c", Index: 2}, {Tag: "d", Index: 3, Detach: true}}
+	counter := newDoneCounter(commands)
+
+	for _, step := range []struct {
+		cmdInfo CommandInfo
+		want    string
+	}{
+		{commands[0], " (1/3 done)"},
+		{commands[3], ""},
+		{commands[0], " (1/3 done)"},
+		{commands[1], " (2/3 done)"},
+		{commands[2], " (3/3 done)"},
+	} {
+		if got := counter.finish(step.cmdInfo); got != step.want {
+			t.Errorf("finish(%s) = %q, want %q", step.cmdInfo.Tag, got, step.want)
+		}
+	}
+
+	var none *doneCounter
+	if got := none.finish(commands[0]); got != "" {
+		t.Errorf("finish() outside of a parallel run = %q, want nothing", got)
+	}
+}
+
+// TestCompletionProgress tests that the completion message of a parallel command shows the overall progress
+func TestCompletionProgress(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	output := captureStdout(func() {
+		runParallel([]CommandInfo{
+			{Command: "echo a", Tag: "a", Index: 0},
+			{Command: "sleep 0.2; exit 3", Tag: "b", Index: 1},
+		})
+	})
+
+	for _, want := range []string{"[a] Command completed successfully (1/2 done)", "[b] Command exited with status: 3 (2/2 done)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("runParallel() output = %q, want to contain %q", output, want)
+		}
+	}
+	if strings.Contains(output, "] completed (") || strings.Contains(output, "] failed (") {
+		t.Errorf("runParallel() output = %q, want no separate progress lines", output)
+	}
+}
+
 // TestColorSupport tests the color support functions
 func TestColorSupport(t *testing.T) {
 	// This is mostly a smoke test since we can't easily test the actual color output
@@ -420,3 +724,35 @@ func TestMain(m *testing.M) {
 	// Run the tests
 	os.Exit(m.Run())
 }
+
+// TestScripts tests multi-line scripts given inline or read from a file
+func TestScripts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "script.sh")
+	script := "#!/bin/sh\n\necho one\necho two\n"
+	if err := os.WriteFile(path, []byte(script), 0644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	got, err := readScripts([]string{"echo a\necho b", "@" + path})
+	if err != nil {
+		t.Fatalf("readScripts() failed: %v", err)
+	}
+	if len(got) != 2 || got[0] != "echo a\necho b" || got[1] != script {
+		t.Errorf("readScripts() = %q, want the inline script and the file contents", got)
+	}
+
+	if _, err := readScripts([]string{"@" + path + ".missing"}); err == nil {
+		t.Error("readScripts() with a missing file succeeded, want an error")
+	}
+
+	if !needsShell("echo a\necho b") {
+		t.Error("needsShell() = false for a multi-line script, want true")
+	}
+
+	if summary := commandSummary(script); summary != "echo one ... (4 lines)" {
+		t.Errorf("commandSummary() = %q, want %q", summary, "echo one ... (4 lines)")
+	}
+	if summary := commandSummary("echo one"); summary != "echo one" {
+		t.Errorf("commandSummary() = %q, want the command unchanged", summary)
+	}
+}
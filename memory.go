@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	// Raw value of the --max-memory flag
+	maxMemoryFlag string
+	// Memory limit for each command in bytes, 0 when unlimited
+	maxMemory int64
+)
+
+// memoryCheckInterval is how often the memory use of commands is checked
+const memoryCheckInterval = 250 * time.Millisecond
+
+// watchMemory kills a command and all of its child processes once their
+// combined resident memory exceeds maxMemory. The returned function stops
+// watching.
+func watchMemory(tag string, pid int) func() {
+	ticker := time.NewTicker(memoryCheckInterval)
+	done := make(chan struct{})
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pids := processTree(pid)
+				if processTreeRSS(pids) <= maxMemory {
+					continue
+				}
+				printCommandMessage(tag, fmt.Sprintf("killed: exceeded memory limit of %s", maxMemoryFlag), colorRed)
+				killProcesses(pids)
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
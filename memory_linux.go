@@ -0,0 +1,86 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// memoryLimitSupported indicates if the memory use of commands can be limited
+const memoryLimitSupported = true
+
+// processTree returns pid followed by all of its descendants
+func processTree(pid int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return []int{pid}
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if parent, ok := parentPID(child); ok {
+			children[parent] = append(children[parent], child)
+		}
+	}
+
+	pids := []int{pid}
+	for i := 0; i < len(pids); i++ {
+		pids = append(pids, children[pids[i]]...)
+	}
+	return pids
+}
+
+// parentPID reads the parent of a process from /proc/<pid>/stat
+func parentPID(pid int) (int, bool) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, false
+	}
+
+	// The command name may contain spaces and parentheses, so the fields
+	// are taken after its closing parenthesis: state, then the parent PID
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndexByte(stat, ')')+1:])
+	if len(fields) < 2 {
+		return 0, false
+	}
+	parent, err := strconv.Atoi(fields[1])
+	return parent, err == nil
+}
+
+// processTreeRSS returns the combined resident memory of the processes in bytes
+func processTreeRSS(pids []int) int64 {
+	pageSize := int64(os.Getpagesize())
+
+	var total int64
+	for _, pid := range pids {
+		data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/statm")
+		if err != nil {
+			continue
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) < 2 {
+			continue
+		}
+		if pages, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			total += pages * pageSize
+		}
+	}
+	return total
+}
+
+// killProcesses kills the processes immediately
+func killProcesses(pids []int) {
+	for _, pid := range pids {
+		_ = unix.Kill(pid, unix.SIGKILL)
+	}
+}
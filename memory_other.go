@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+// memoryLimitSupported indicates if the memory use of commands can be limited
+const memoryLimitSupported = false
+
+// processTree is only supported on Linux
+func processTree(pid int) []int {
+	return []int{pid}
+}
+
+// processTreeRSS is only supported on Linux
+func processTreeRSS(pids []int) int64 {
+	return 0
+}
+
+// killProcesses is only supported on Linux
+func killProcesses(pids []int) {}
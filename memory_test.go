@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestProcessTree tests that the children of a command are found and counted
+func TestProcessTree(t *testing.T) {
+	if !memoryLimitSupported {
+		t.Skip("Memory limits are only supported on Linux")
+	}
+
+	cmd := exec.Command("sh", "-c", "sleep 5 & wait")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start command: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	// Give the shell time to start its child
+	var pids []int
+	for i := 0; i < 50 && len(pids) < 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+		pids = processTree(cmd.Process.Pid)
+	}
+
+	if len(pids) < 2 || pids[0] != cmd.Process.Pid {
+		t.Fatalf("processTree() = %v, want the shell and its child", pids)
+	}
+	if rss := processTreeRSS(pids); rss <= 0 {
+		t.Errorf("processTreeRSS() = %d, want a positive size", rss)
+	}
+
+	killProcesses(pids)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// File to keep Prometheus metrics of the commands in, empty to disable them
+	metricsFile string
+	// Metrics of each command by tag, guarded by metricsMutex
+	commandMetrics = make(map[string]*commandMetric)
+	// Mutex serializing updates to commandMetrics and writes to metricsFile
+	metricsMutex sync.Mutex
+	// Set once writing the metrics failed, so the error is reported only once
+	metricsFailed bool
+)
+
+// commandMetric is the state of a command exported as metrics
+type commandMetric struct {
+	up           bool
+	starts       int
+	restarts     int
+	lastExitCode int
+	lastDuration float64
+}
+
+// recordMetrics updates the metrics of a command from a lifecycle event and
+// rewrites --metrics-file. Output lines do not change the metrics.
+func recordMetrics(event Event) {
+	if metricsFile == "" || (event.Event != "started" && event.Event != "exited") {
+		return
+	}
+
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	metric, ok := commandMetrics[event.Tag]
+	if !ok {
+		metric = &commandMetric{}
+		commandMetrics[event.Tag] = metric
+	}
+
+	if event.Event == "started" {
+		metric.up = true
+		metric.starts++
+	} else {
+		metric.up = false
+		metric.lastDuration = event.Duration
+		// A command that could not be started has no exit code
+		metric.lastExitCode = -1
+		if event.ExitCode != nil {
+			metric.lastExitCode = *event.ExitCode
+		}
+	}
+
+	updateMetrics()
+}
+
+// recordRestart counts a restart of a command by the restart policy. Runs
+// repeated by --bench, --warmup or --compare are starts, not restarts.
+func recordRestart(tag string) {
+	if metricsFile == "" {
+		return
+	}
+
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	metric, ok := commandMetrics[tag]
+	if !ok {
+		metric = &commandMetric{}
+		commandMetrics[tag] = metric
+	}
+	metric.restarts++
+
+	updateMetrics()
+}
+
+// updateMetrics rewrites --metrics-file, reporting only the first failure.
+// The caller must hold metricsMutex.
+func updateMetrics() {
+	if err := writeMetrics(metricsFile, formatMetrics(commandMetrics)); err != nil && !metricsFailed {
+		metricsFailed = true
+		printColoredMessage(fmt.Sprintf("Error writing metrics: %v", err), colorRed)
+	}
+}
+
+// formatMetrics renders the metrics of all commands in the Prometheus text format
+func formatMetrics(metrics map[string]*commandMetric) string {
+	tags := make([]string, 0, len(metrics))
+	for tag := range metrics {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	families := []struct {
+		name, kind, help string
+		value            func(m *commandMetric) float64
+	}{
+		{"rufl_command_up", "gauge", "Whether the command is running (1) or not (0).", func(m *commandMetric) float64 {
+			if m.up {
+				return 1
+			}
+			return 0
+		}},
+		{"rufl_command_starts_total", "counter", "Number of times the command was started.", func(m *commandMetric) float64 { return float64(m.starts) }},
+		{"rufl_command_restarts_total", "counter", "Number of times the command was restarted by --restart.", func(m *commandMetric) float64 { return float64(m.restarts) }},
+		{"rufl_command_last_exit_code", "gauge", "Exit code of the last run of the command, -1 if it could not be started.", func(m *commandMetric) float64 { return float64(m.lastExitCode) }},
+		{"rufl_command_last_duration_seconds", "gauge", "Duration of the last finished run of the command.", func(m *commandMetric) float64 { return m.lastDuration }},
+	}
+
+	var b strings.Builder
+	for _, family := range families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.kind)
+		for _, tag := range tags {
+			fmt.Fprintf(&b, "%s{tag=\"%s\"} %g\n", family.name, escapeLabel(tag), family.value(metrics[tag]))
+		}
+	}
+	return b.String()
+}
+
+// escapeLabel escapes a label value for the Prometheus text format
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// writeMetrics replaces the metrics file in one step, so a scraper never
+// reads a partially written file
+func writeMetrics(path string, content string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".rufl-metrics-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
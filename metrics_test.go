@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRecordMetrics tests that lifecycle events are written as Prometheus metrics
+func TestRecordMetrics(t *testing.T) {
+	oldFile, oldMetrics := metricsFile, commandMetrics
+	metricsFile = filepath.Join(t.TempDir(), "rufl.prom")
+	commandMetrics = make(map[string]*commandMetric)
+	defer func() { metricsFile, commandMetrics = oldFile, oldMetrics }()
+
+	code := 3
+	recordMetrics(Event{Event: "started", Tag: "web"})
+	recordMetrics(Event{Event: "line", Tag: "web", Line: "listening"})
+	recordMetrics(Event{Event: "exited", Tag: "web", ExitCode: &code, Duration: 1.5})
+	recordRestart("web")
+	recordMetrics(Event{Event: "started", Tag: "web"})
+	recordMetrics(Event{Event: "exited", Tag: "db", Error: "not found"})
+	recordMetrics(Event{Event: "started", Tag: "db"})
+
+	data, err := os.ReadFile(metricsFile)
+	if err != nil {
+		t.Fatalf("reading metrics: %v", err)
+	}
+	got := string(data)
+
+	for _, want := range []string{
+		"# TYPE rufl_command_up gauge\n",
+		`rufl_command_up{tag="web"} 1` + "\n",
+		`rufl_command_up{tag="db"} 1` + "\n",
+		`rufl_command_starts_total{tag="db"} 1` + "\n",
+		`rufl_command_starts_total{tag="web"} 2` + "\n",
+		`rufl_command_restarts_total{tag="web"} 1` + "\n",
+		`rufl_command_restarts_total{tag="db"} 0` + "\n",
+		`rufl_command_last_exit_code{tag="web"} 3` + "\n",
+		`rufl_command_last_exit_code{tag="db"} -1` + "\n",
+		`rufl_command_last_duration_seconds{tag="web"} 1.5` + "\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("metrics missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Index(got, `{tag="db"}`) > strings.Index(got, `{tag="web"}`) {
+		t.Errorf("metrics not sorted by tag:\n%s", got)
+	}
+}
+
+// TestEscapeLabel tests escaping of label values
+func TestEscapeLabel(t *testing.T) {
+	if got, want := escapeLabel("a\"b\\c\nd"), `a\"b\\c\nd`; got != want {
+		t.Errorf("escapeLabel() = %q, want %q", got, want)
+	}
+}
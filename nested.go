@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Environment variable holding how deeply rufl is nested in other rufl runs
+const depthEnvVar = "RUFL_DEPTH"
+
+var (
+	// Nesting depth of this rufl process, 0 when not started by rufl
+	ruflDepth = depthFromEnv()
+	// Merge prefixes printed by nested rufl runs into the outer prefix
+	stripNestedPrefix bool
+	// Matches a prefix printed by a nested rufl run, with or without color,
+	// including the marker starting its status messages
+	nestedPrefixPattern = regexp.MustCompile(`^(?:\x1b\[[0-9;]*m)*(?:rufl: (?:\x1b\[[0-9;]*m)*)?\[([^\[\]]+)\] (?:\x1b\[0m)?`)
+)
+
+// depthFromEnv reads the nesting depth set by a parent rufl
+func depthFromEnv() int {
+	depth, err := strconv.Atoi(os.Getenv(depthEnvVar))
+	if err != nil || depth < 0 {
+		return 0
+	}
+	return depth
+}
+
+// depthEnv returns the environment entry telling commands how deeply they are nested
+func depthEnv() string {
+	return depthEnvVar + "=" + strconv.Itoa(ruflDepth+1)
+}
+
+// collapseNestedPrefix detects a prefix printed by a nested rufl at the start
+// of the line and merges it into the tag, so "[outer] [inner] line" becomes
+// "[outer/inner] line". Lines without a nested prefix are returned unchanged.
+func collapseNestedPrefix(tag string, line string) (string, string) {
+	match := nestedPrefixPattern.FindStringSubmatchIndex(line)
+	if match == nil {
+		return tag, line
+	}
+
+	inner := line[match[2]:match[3]]
+	// The outer prefix carries the stream type already
+	inner = strings.TrimSuffix(strings.TrimSuffix(inner, ":out"), ":err")
+
+	return tag + "/" + inner, line[match[1]:]
+}
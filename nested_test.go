@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+// TestCollapseNestedPrefix tests merging of prefixes printed by nested rufl runs
+func TestCollapseNestedPrefix(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		wantTag  string
+		wantLine string
+	}{
+		{
+			name:     "Plain nested prefix",
+			line:     "[inner:out] hello",
+			wantTag:  "outer/inner",
+			wantLine: "hello",
+		},
+		{
+			name:     "Colored nested prefix",
+			line:     colorGreen + "[inner] " + colorReset + "hello",
+			wantTag:  "outer/inner",
+			wantLine: "hello",
+		},
+		{
+			name:     "Nested status message",
+			line:     "[2] Command completed successfully",
+			wantTag:  "outer/2",
+			wantLine: "Command completed successfully",
+		},
+		{
+			name:     "Nested status message with marker",
+			line:     colorDim + "rufl: " + colorReset + colorGreen + "[2] Command completed successfully" + colorReset,
+			wantTag:  "outer/2",
+			wantLine: "Command completed successfully" + colorReset,
+		},
+		{
+			name:     "Regular output",
+			line:     "hello [not a prefix] world",
+			wantTag:  "outer",
+			wantLine: "hello [not a prefix] world",
+		},
+		{
+			name:     "Bracket without space",
+			line:     "[INFO]starting",
+			wantTag:  "outer",
+			wantLine: "[INFO]starting",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, line := collapseNestedPrefix("outer", tt.line)
+			if tag != tt.wantTag || line != tt.wantLine {
+				t.Errorf("collapseNestedPrefix() = (%q, %q), want (%q, %q)", tag, line, tt.wantTag, tt.wantLine)
+			}
+		})
+	}
+}
+
+// TestDepthEnv tests the nesting depth passed to commands
+func TestDepthEnv(t *testing.T) {
+	oldDepth := ruflDepth
+	defer func() { ruflDepth = oldDepth }()
+
+	ruflDepth = 0
+	if got := depthEnv(); got != "RUFL_DEPTH=1" {
+		t.Errorf("depthEnv() = %q, want RUFL_DEPTH=1", got)
+	}
+
+	ruflDepth = 2
+	if got := depthEnv(); got != "RUFL_DEPTH=3" {
+		t.Errorf("depthEnv() = %q, want RUFL_DEPTH=3", got)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "syscall"
+
+// Whether the niceness of commands can be set on this platform
+const niceSupported = true
+
+// setNiceness sets the scheduling niceness of a process, from -20 (highest
+// priority) to 19 (lowest). Lowering it below rufl's own usually needs root.
+func setNiceness(pid int, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package main
+
+import "errors"
+
+// Whether the niceness of commands can be set on this platform
+const niceSupported = false
+
+// setNiceness is not supported on Windows
+func setNiceness(pid int, nice int) error {
+	return errors.New("setting the niceness of commands is not supported on Windows")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// TestParseByteSize tests parsing of human-readable sizes
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "Plain bytes", value: "512", want: 512},
+		{name: "Bytes suffix", value: "512B", want: 512},
+		{name: "Kilobytes", value: "64KB", want: 64 * 1024},
+		{name: "Short kilobytes", value: "64k", want: 64 * 1024},
+		{name: "Megabytes", value: "1MB", want: 1024 * 1024},
+		{name: "Gigabytes", value: "2G", want: 2 * 1024 * 1024 * 1024},
+		{name: "Whitespace", value: " 256 KB ", want: 256 * 1024},
+		{name: "Invalid number", value: "lots", wantErr: true},
+		{name: "Negative", value: "-1KB", wantErr: true},
+		{name: "Empty", value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseByteSize(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseByteSize(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseByteSize(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseTagColors tests parsing of --tag-color values
+func TestParseTagColors(t *testing.T) {
+	got, err := parseTagColors([]string{"error:red", "build:Green", "docs:magenta"})
+	if err != nil {
+		t.Fatalf("parseTagColors() error = %v", err)
+	}
+	want := map[string]string{"error": colorRed, "build": colorGreen, "docs": colorPurple}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTagColors() = %q, want %q", got, want)
+	}
+
+	for _, invalid := range []string{"build", ":red", "build:pink"} {
+		if _, err := parseTagColors([]string{invalid}); err == nil {
+			t.Errorf("parseTagColors(%q) expected an error", invalid)
+		}
+	}
+}
+
+// TestDoubleDashArgs tests that everything after "--" is taken as a command, never as a rufl flag
+func TestDoubleDashArgs(t *testing.T) {
+	oldNoColor := noColor
+	oldEnvVars := envVars
+	defer func() {
+		noColor = oldNoColor
+		envVars = oldEnvVars
+	}()
+
+	tests := []struct {
+		name        string
+		args        []string
+		wantArgs    []string
+		wantNoColor bool
+	}{
+		{name: "Parallel", args: []string{"p", "--", "--weird-looking command", "-e"}, wantArgs: []string{"--weird-looking command", "-e"}},
+		{name: "Sequential", args: []string{"+", "--", "--no-color"}, wantArgs: []string{"--no-color"}},
+		{name: "Flags before dash", args: []string{"=", "--no-color", "echo a", "--", "-x"}, wantArgs: []string{"echo a", "-x"}, wantNoColor: true},
+		{name: "Dash as command", args: []string{"p", "--", "--"}, wantArgs: []string{"--"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rootCmd := newRootCmd()
+			var got []string
+			for _, sub := range rootCmd.Commands() {
+				sub.Run = func(cmd *cobra.Command, args []string) { got = args }
+			}
+			rootCmd.SetArgs(tt.args)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("Execute(%q) error = %v", tt.args, err)
+			}
+			if !reflect.DeepEqual(got, tt.wantArgs) {
+				t.Errorf("Execute(%q) commands = %q, want %q", tt.args, got, tt.wantArgs)
+			}
+			if noColor != tt.wantNoColor {
+				t.Errorf("Execute(%q) noColor = %v, want %v", tt.args, noColor, tt.wantNoColor)
+			}
+			if len(envVars) != 0 {
+				t.Errorf("Execute(%q) parsed a command as -e: %q", tt.args, envVars)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// captureStdout runs fn and returns everything it wrote to os.Stdout
+func captureStdout(fn func()) string {
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+
+	fn()
+
+	w.Close()
+	os.Stdout = oldStdout
+	return <-done
+}
+
+// TestProcessOutputLongLines tests that lines longer than the buffer are split instead of failing
+func TestProcessOutputLongLines(t *testing.T) {
+	oldNoColor := noColor
+	oldBufferSize := bufferSize
+	noColor = true
+	bufferSize = 16
+	defer func() {
+		noColor = oldNoColor
+		bufferSize = oldBufferSize
+	}()
+
+	long := strings.Repeat("x", 40)
+	output := captureStdout(func() {
+		processOutput(strings.NewReader(long+"\nshort\n"), "test", "out", colorGreen)
+	})
+
+	if strings.Contains(output, "Error reading") {
+		t.Fatalf("processOutput() failed on long line, output = %q", output)
+	}
+	if got := strings.Count(output, "x"); got != len(long) {
+		t.Errorf("processOutput() printed %d of %d characters, output = %q", got, len(long), output)
+	}
+	if !strings.Contains(output, "[test:out] short\n") {
+		t.Errorf("processOutput() output = %q, want to contain the short line", output)
+	}
+}
+
+// TestProcessOutputMissingTrailingNewline tests that the last line is terminated even without a newline
+func TestProcessOutputMissingTrailingNewline(t *testing.T) {
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	output := captureStdout(func() {
+		processOutput(strings.NewReader("no newline"), "a", "out", colorGreen)
+		processOutput(strings.NewReader("next"), "b", "out", colorGreen)
+	})
+
+	want := "[a:out] no newline\n[b:out] next\n"
+	if output != want {
+		t.Errorf("processOutput() output = %q, want %q", output, want)
+	}
+}
+
+// TestPrefixSeparator tests that the separator is printed between output blocks of different commands
+func TestPrefixSeparator(t *testing.T) {
+	oldNoColor := noColor
+	oldSeparator := prefixSeparator
+	noColor = true
+	prefixSeparator = "---"
+	lastOutputSource = ""
+	defer func() {
+		noColor = oldNoColor
+		prefixSeparator = oldSeparator
+		lastOutputSource = ""
+	}()
+
+	output := captureStdout(func() {
+		processOutput(strings.NewReader("one\ntwo\n"), "a", "out", colorGreen)
+		processOutput(strings.NewReader("three\n"), "b", "out", colorGreen)
+		processOutput(strings.NewReader("four\n"), "b", "out", colorGreen)
+	})
+
+	want := "[a:out] one\n[a:out] two\n---\n[b:out] three\n[b:out] four\n"
+	if output != want {
+		t.Errorf("processOutput() output = %q, want %q", output, want)
+	}
+}
+
+// TestBatchedOutput tests that batched output is held back and written out when batching stops
+func TestBatchedOutput(t *testing.T) {
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	var buffered int
+	output := captureStdout(func() {
+		stop := startBatching(time.Hour)
+		processOutput(strings.NewReader("batched\n"), "test", "out", colorGreen)
+
+		outputMutex.Lock()
+		buffered = batchWriter.Buffered()
+		outputMutex.Unlock()
+
+		stop()
+	})
+
+	if buffered == 0 {
+		t.Errorf("startBatching() did not buffer output")
+	}
+	if output != "[test:out] batched\n" {
+		t.Errorf("batched output = %q, want the line after flushing", output)
+	}
+	if batchWriter != nil {
+		t.Errorf("stopping batching did not reset the batch writer")
+	}
+}
+
+// TestFormatTimestamp tests the timestamp modes
+func TestFormatTimestamp(t *testing.T) {
+	oldMode := timestampMode
+	oldStart := ruflStartTime
+	defer func() {
+		timestampMode = oldMode
+		ruflStartTime = oldStart
+	}()
+
+	ruflStartTime = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	now := ruflStartTime.Add(1234 * time.Millisecond)
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{mode: "none", want: ""},
+		{mode: "wall", want: "12:00:01.234 "},
+		{mode: "relative", want: "+1.234s "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			timestampMode = tt.mode
+			if got := formatTimestamp(now); got != tt.want {
+				t.Errorf("formatTimestamp() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestProcessOutputSplitModes tests the different ways of splitting output into records
+func TestProcessOutputSplitModes(t *testing.T) {
+	oldNoColor := noColor
+	oldSplitMode := splitMode
+	noColor = true
+	defer func() {
+		noColor = oldNoColor
+		splitMode = oldSplitMode
+	}()
+
+	tests := []struct {
+		mode  string
+		input string
+		want  string
+	}{
+		{mode: "line", input: "a b\nc\n", want: "[t:out] a b\n[t:out] c\n"},
+		{mode: "word", input: "a b\n  c\n", want: "[t:out] a\n[t:out] b\n[t:out] c\n"},
+		{mode: "null", input: "./a b\x00./c\x00", want: "[t:out] ./a b\n[t:out] ./c\n"},
+		{mode: "null", input: "./a\x00./no-terminator", want: "[t:out] ./a\n[t:out] ./no-terminator\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			splitMode = tt.mode
+			output := captureStdout(func() {
+				processOutput(strings.NewReader(tt.input), "t", "out", colorGreen)
+			})
+			if output != tt.want {
+				t.Errorf("processOutput() with split %s = %q, want %q", tt.mode, output, tt.want)
+			}
+		})
+	}
+}
+
+// TestPrefixOnce tests that the prefix is only printed when the output source changes
+func TestPrefixOnce(t *testing.T) {
+	oldNoColor := noColor
+	oldPrefixOnce := prefixOnce
+	noColor = true
+	prefixOnce = true
+	lastPrefixSource = ""
+	defer func() {
+		noColor = oldNoColor
+		prefixOnce = oldPrefixOnce
+		lastPrefixSource = ""
+	}()
+
+	output := captureStdout(func() {
+		processOutput(strings.NewReader("one\ntwo\n"), "a", "out", colorGreen)
+		processOutput(strings.NewReader("oops\n"), "a", "err", colorRed)
+		processOutput(strings.NewReader("three\nfour\n"), "b", "out", colorGreen)
+		printColoredMessage("[b] status", colorCyan)
+		processOutput(strings.NewReader("five\n"), "b", "out", colorGreen)
+	})
+
+	want := "[a:out] one\n" +
+		"        two\n" +
+		"[a:err] oops\n" +
+		"[b:out] three\n" +
+		"        four\n" +
+		"rufl: [b] status\n" +
+		"[b:out] five\n"
+	if output != want {
+		t.Errorf("processOutput() with prefix-once = %q, want %q", output, want)
+	}
+}
+
+// TestVisibleWidth tests that color codes do not count towards the width
+func TestVisibleWidth(t *testing.T) {
+	if got := visibleWidth(colorGreen + "[tag] " + colorReset); got != 6 {
+		t.Errorf("visibleWidth() = %d, want 6", got)
+	}
+	if got := visibleWidth("[tâg] "); got != 6 {
+		t.Errorf("visibleWidth() = %d, want 6", got)
+	}
+	if got := visibleWidth("🔨 [tag] "); got != 9 {
+		t.Errorf("visibleWidth() = %d, want 9", got)
+	}
+}
+
+// TestTagIcons tests that icons are printed before the prefix and keep prefixes aligned
+func TestTagIcons(t *testing.T) {
+	oldNoColor := noColor
+	oldIcons, oldWidth := tagIcons, tagIconWidth
+	noColor = true
+	defer func() {
+		noColor = oldNoColor
+		tagIcons, tagIconWidth = oldIcons, oldWidth
+	}()
+
+	icons, err := parseTagIcons([]string{"build:🔨", "lint:*"})
+	if err != nil {
+		t.Fatalf("parseTagIcons() failed: %v", err)
+	}
+	tagIcons, tagIconWidth = icons, 2
+
+	output := captureStdout(func() {
+		processOutput(strings.NewReader("a\n"), "build", "out", colorGreen)
+		processOutput(strings.NewReader("b\n"), "lint", "out", colorGreen)
+		processOutput(strings.NewReader("c\n"), "3", "out", colorGreen)
+	})
+
+	want := "🔨 [build:out] a\n" +
+		"*  [lint:out] b\n" +
+		"   [3:out] c\n"
+	if output != want {
+		t.Errorf("processOutput() with icons = %q, want %q", output, want)
+	}
+
+	if _, err := parseTagIcons([]string{"build"}); err == nil {
+		t.Error("parseTagIcons() with missing icon succeeded, want an error")
+	}
+}
+
+// TestBrokenPipe tests that output to a closed stdout is discarded instead of failing
+func TestBrokenPipe(t *testing.T) {
+	oldStdout := os.Stdout
+	oldIgnore := ignoreBrokenPipe
+	ignoreBrokenPipe = true
+	stdoutBroken = false
+	defer func() {
+		os.Stdout = oldStdout
+		ignoreBrokenPipe = oldIgnore
+		stdoutBroken = false
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() failed: %v", err)
+	}
+	r.Close()
+	defer w.Close()
+	os.Stdout = w
+
+	processOutput(strings.NewReader("one\ntwo\n"), "a", "out", colorGreen)
+
+	if !stdoutBroken {
+		t.Error("stdoutBroken = false after writing to a closed pipe, want true")
+	}
+}
+
+// TestMergeStreams tests that merged stdout and stderr keep the order the command printed them in
+func TestMergeStreams(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	oldMerge := mergeStreams
+	oldNoColor := noColor
+	mergeStreams = true
+	noColor = true
+	defer func() {
+		mergeStreams = oldMerge
+		noColor = oldNoColor
+	}()
+
+	output := captureStdout(func() {
+		executeCommand(CommandInfo{Command: "echo 1; echo 2 >&2; echo 3; echo 4 >&2", Tag: "m"})
+	})
+
+	want := "[m:out] 1\n[m:out] 2\n[m:out] 3\n[m:out] 4\n"
+	if !strings.Contains(output, want) {
+		t.Errorf("executeCommand() with merged streams output = %q, want to contain %q", output, want)
+	}
+}
+
+// TestPrefixToStderr tests that only raw stdout lines are written to stdout
+func TestPrefixToStderr(t *testing.T) {
+	oldPrefixToStderr := prefixToStderr
+	oldNoColor := noColor
+	oldStderr := os.Stderr
+	prefixToStderr = true
+	noColor = true
+	defer func() {
+		prefixToStderr = oldPrefixToStderr
+		noColor = oldNoColor
+		os.Stderr = oldStderr
+	}()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe() failed: %v", err)
+	}
+	os.Stderr = w
+
+	output := captureStdout(func() {
+		printColoredMessage("[a] Executing", colorCyan)
+		processOutput(strings.NewReader("data1\ndata2"), "a", "out", colorGreen)
+		processOutput(strings.NewReader("warning\n"), "a", "err", colorRed)
+	})
+
+	w.Close()
+	stderr, _ := io.ReadAll(r)
+
+	if output != "data1\ndata2\n" {
+		t.Errorf("stdout with --prefix-to-stderr = %q, want only the raw data", output)
+	}
+	if want := "rufl: [a] Executing\n[a:err] warning\n"; string(stderr) != want {
+		t.Errorf("stderr with --prefix-to-stderr = %q, want %q", stderr, want)
+	}
+}
+
+// TestCommandElapsed tests that the time since the command started is shown in the prefix
+func TestCommandElapsed(t *testing.T) {
+	oldNoColor := noColor
+	oldCommandElapsed := commandElapsed
+	noColor = true
+	commandElapsed = true
+	defer func() {
+		noColor = oldNoColor
+		commandElapsed = oldCommandElapsed
+	}()
+
+	output := captureStdout(func() {
+		started := time.Now().Add(-3200 * time.Millisecond)
+		processCommandOutput(strings.NewReader("compiling\n"), "build", "out", colorGreen, started, nil)
+	})
+
+	if output != "[build:out +3.2s] compiling\n" {
+		t.Errorf("processCommandOutput() with --command-elapsed = %q, want %q", output, "[build:out +3.2s] compiling\n")
+	}
+}
+
+// TestCompletionAfterOutput tests that a command's last line always comes before its completion message
+func TestCompletionAfterOutput(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix shell")
+	}
+
+	oldPrefixToStderr, oldNoColor, oldParallelMode := prefixToStderr, noColor, parallelMode
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	noColor, parallelMode = true, true
+	defer func() {
+		prefixToStderr, noColor, parallelMode = oldPrefixToStderr, oldNoColor, oldParallelMode
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+	}()
+
+	for _, toStderr := range []bool{false, true} {
+		prefixToStderr = toStderr
+
+		// stdout and stderr share a pipe, as they do on a terminal
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("os.Pipe() failed: %v", err)
+		}
+		os.Stdout, os.Stderr = w, w
+		done := make(chan string)
+		go func() {
+			data, _ := io.ReadAll(r)
+			done <- string(data)
+		}()
+
+		// Output is batched, so it is held back while the commands exit
+		stopBatching := startBatching(time.Hour)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(tag string) {
+				defer wg.Done()
+				runCommand(CommandInfo{Command: "seq 1 200; echo last-" + tag, Tag: tag}, nil)
+			}(strconv.Itoa(i))
+		}
+		wg.Wait()
+		stopBatching()
+
+		w.Close()
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		output := <-done
+
+		for i := 0; i < 4; i++ {
+			tag := strconv.Itoa(i)
+			last := strings.LastIndex(output, "last-"+tag+"\n")
+			completed := strings.Index(output, "["+tag+"] Command completed successfully")
+			if last < 0 || completed < 0 || completed < last {
+				t.Errorf("with --prefix-to-stderr=%v, command %s printed its last line at %d and its completion message at %d", toStderr, tag, last, completed)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	// Raw value of the --max-total-output flag
+	maxTotalOutputFlag string
+	// Limit on the command output printed over the whole run in bytes, 0 when unlimited
+	maxTotalOutput int64
+	// Stop all commands instead of only their output once the limit is reached
+	abortOnOutputLimit bool
+	// Bytes of command output printed so far
+	totalOutputBytes atomic.Int64
+	// Set once the output limit has been reached
+	outputLimitReached atomic.Bool
+)
+
+// exceedsOutputLimit counts a line of command output about to be printed
+// and reports whether it goes over --max-total-output, in which case the
+// line must be dropped. The first time, a notice is printed and with
+// --max-total-output-abort the run is stopped. Must be called with
+// outputMutex held.
+func exceedsOutputLimit(text string) bool {
+	if maxTotalOutput <= 0 {
+		return false
+	}
+	if outputLimitReached.Load() {
+		return true
+	}
+	if totalOutputBytes.Add(int64(len(text))) <= maxTotalOutput {
+		return false
+	}
+
+	outputLimitReached.Store(true)
+	if !abortOnOutputLimit {
+		writeMessage(fmt.Sprintf("Output limit of %s reached, discarding further output while commands finish", maxTotalOutputFlag), colorYellow)
+		return true
+	}
+
+	writeMessage(fmt.Sprintf("Output limit of %s reached, stopping all commands", maxTotalOutputFlag), colorRed)
+	// Exiting needs outputMutex, which the caller holds
+	go func() {
+		terminateActiveCommands()
+		shutdownRufl(1)
+	}()
+	return true
+}
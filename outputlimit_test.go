@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMaxTotalOutput tests that output past the limit is discarded with a single notice
+func TestMaxTotalOutput(t *testing.T) {
+	oldNoColor := noColor
+	oldMaxTotalOutput := maxTotalOutput
+	oldMaxTotalOutputFlag := maxTotalOutputFlag
+	noColor = true
+	maxTotalOutput = 20
+	maxTotalOutputFlag = "20B"
+	defer func() {
+		noColor = oldNoColor
+		maxTotalOutput = oldMaxTotalOutput
+		maxTotalOutputFlag = oldMaxTotalOutputFlag
+		totalOutputBytes.Store(0)
+		outputLimitReached.Store(false)
+	}()
+
+	output := captureStdout(func() {
+		for _, text := range []string{"first", "second", "third", "x"} {
+			printOutputLine(outputLine{tag: "t", stream: "out", prefix: "[t:out] ", text: text})
+		}
+		printColoredMessage("done", colorGreen)
+	})
+
+	want := "[t:out] first\nrufl: Output limit of 20B reached, discarding further output while commands finish\nrufl: done\n"
+	if output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+	if strings.Count(output, "Output limit") != 1 {
+		t.Errorf("output = %q, want a single notice", output)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pathCacheTTL is how long a resolved program path is reused
+const pathCacheTTL = 30 * time.Second
+
+var (
+	// Look up programs in PATH every time instead of reusing earlier lookups
+	noPathCache bool
+	// Resolved paths of programs by name, guarded by pathCacheMutex
+	pathCache = make(map[string]cachedPath)
+	// Mutex guarding pathCache
+	pathCacheMutex sync.Mutex
+)
+
+// cachedPath is a program path found in PATH
+type cachedPath struct {
+	path     string
+	pathEnv  string
+	resolved time.Time
+}
+
+// newCommand is exec.Command with program lookups in PATH cached, so
+// restarting or re-running the same commands does not scan PATH each time.
+// A cached path is used while PATH is unchanged, up to pathCacheTTL. The
+// command keeps the program name as given in its argv[0].
+func newCommand(name string, args ...string) *exec.Cmd {
+	if noPathCache || strings.ContainsAny(name, `/\`) {
+		return exec.Command(name, args...)
+	}
+
+	pathEnv := os.Getenv("PATH")
+	pathCacheMutex.Lock()
+	cached, ok := pathCache[name]
+	pathCacheMutex.Unlock()
+
+	if ok && cached.pathEnv == pathEnv && time.Since(cached.resolved) < pathCacheTTL {
+		cmd := exec.Command(cached.path, args...)
+		cmd.Args[0] = name
+		return cmd
+	}
+
+	cmd := exec.Command(name, args...)
+	if cmd.Err == nil {
+		pathCacheMutex.Lock()
+		pathCache[name] = cachedPath{path: cmd.Path, pathEnv: pathEnv, resolved: time.Now()}
+		pathCacheMutex.Unlock()
+	}
+	return cmd
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestNewCommandPathCache tests that program lookups are reused until PATH changes
+func TestNewCommandPathCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Test uses a Unix executable")
+	}
+
+	dir1, dir2 := t.TempDir(), t.TempDir()
+	for _, dir := range []string{dir1, dir2} {
+		if err := os.WriteFile(filepath.Join(dir, "rufl-tool"), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldCache, oldNoCache := pathCache, noPathCache
+	pathCache = make(map[string]cachedPath)
+	defer func() { pathCache, noPathCache = oldCache, oldNoCache }()
+
+	t.Setenv("PATH", dir1)
+	cmd := newCommand("rufl-tool", "-v")
+	if cmd.Path != filepath.Join(dir1, "rufl-tool") {
+		t.Fatalf("newCommand() path = %q, want the tool in %s", cmd.Path, dir1)
+	}
+
+	// The cached path is used even though the tool is gone from PATH
+	if err := os.Remove(filepath.Join(dir1, "rufl-tool")); err != nil {
+		t.Fatal(err)
+	}
+	cmd = newCommand("rufl-tool", "-v")
+	if cmd.Path != filepath.Join(dir1, "rufl-tool") || cmd.Args[0] != "rufl-tool" || cmd.Args[1] != "-v" {
+		t.Errorf("newCommand() = %q %q, want the cached path with argv as given", cmd.Path, cmd.Args)
+	}
+
+	noPathCache = true
+	if cmd = newCommand("rufl-tool"); cmd.Err == nil {
+		t.Errorf("newCommand() with --no-path-cache = %q, want a fresh lookup to fail", cmd.Path)
+	}
+	noPathCache = false
+
+	t.Setenv("PATH", dir2)
+	if cmd = newCommand("rufl-tool"); cmd.Path != filepath.Join(dir2, "rufl-tool") {
+		t.Errorf("newCommand() after PATH changed = %q, want the tool in %s", cmd.Path, dir2)
+	}
+}
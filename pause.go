@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync/atomic"
+)
+
+var (
+	// Read p and r key presses to pause and resume the running commands
+	pauseKeys bool
+	// Set while the running commands are paused
+	paused atomic.Bool
+)
+
+// startPauseKeys switches the terminal to key mode and reads key presses
+// from stdin to pause and resume the running commands
+func startPauseKeys() {
+	restore, err := enableKeyMode(os.Stdin.Fd())
+	if err != nil {
+		printColoredMessage(fmt.Sprintf("Warning: pause keys disabled, stdin is not a terminal: %v", err), colorYellow)
+		return
+	}
+	restoreTerminal = restore
+	printColoredMessage("Press p to pause and r to resume the running commands", colorBlue)
+
+	go readPauseKeys(os.Stdin)
+}
+
+// readPauseKeys pauses the commands when p is pressed and resumes them when
+// r is pressed, ignoring other keys, until input ends
+func readPauseKeys(input io.Reader) {
+	buf := make([]byte, 64)
+	for {
+		n, err := input.Read(buf)
+		for _, key := range buf[:n] {
+			switch key {
+			case 'p', 'P':
+				pauseCommands()
+			case 'r', 'R':
+				resumeCommands()
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// pauseCommands stops every active command until resumeCommands is called.
+// Commands launched while paused are stopped as soon as they start.
+func pauseCommands() {
+	if paused.Swap(true) {
+		return
+	}
+	count := signalActiveCommands(stopProcess)
+	printColoredMessage(fmt.Sprintf("Paused %s, press r to resume", formatCommandCount(count)), colorYellow)
+}
+
+// resumeCommands continues the commands stopped by pauseCommands
+func resumeCommands() {
+	if !paused.Swap(false) {
+		return
+	}
+	count := signalActiveCommands(continueProcess)
+	resetIdleWatchdogs()
+	printColoredMessage(fmt.Sprintf("Resumed %s", formatCommandCount(count)), colorGreen)
+}
+
+// signalActiveCommands applies signal to the process of every active command
+// and returns how many were signaled
+func signalActiveCommands(signal func(*os.Process) error) int {
+	count := 0
+	activeCommands.Range(func(key, value interface{}) bool {
+		if cmd := value.(*exec.Cmd); cmd.Process != nil && signal(cmd.Process) == nil {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// formatCommandCount formats a number of commands, such as "1 command" or "3 commands"
+func formatCommandCount(count int) string {
+	noun := "commands"
+	if count == 1 {
+		noun = "command"
+	}
+	return fmt.Sprintf("%d %s", count, noun)
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Whether commands can be paused on this platform
+const pauseSupported = true
+
+// groupProcesses starts a command in a process group of its own, so pausing
+// it also stops the processes it starts, such as the children of sh -c
+func groupProcesses(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// stopProcess suspends a process and its process group until
+// continueProcess is called
+func stopProcess(process *os.Process) error {
+	return signalGroup(process, syscall.SIGSTOP)
+}
+
+// continueProcess resumes a process suspended by stopProcess
+func continueProcess(process *os.Process) error {
+	return signalGroup(process, syscall.SIGCONT)
+}
+
+// signalCommand sends a signal to a command, and to the processes it
+// started if groupProcesses put it in a process group of its own, which the
+// terminal's signals no longer reach
+func signalCommand(process *os.Process, sig os.Signal) error {
+	if s, ok := sig.(syscall.Signal); ok {
+		return signalGroup(process, s)
+	}
+	return process.Signal(sig)
+}
+
+// signalGroup signals the process group a process leads, or only the
+// process if it does not lead a group
+func signalGroup(process *os.Process, sig syscall.Signal) error {
+	if pgid, err := syscall.Getpgid(process.Pid); err == nil && pgid == process.Pid {
+		return syscall.Kill(-pgid, sig)
+	}
+	return process.Signal(sig)
+}
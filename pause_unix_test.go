@@ -0,0 +1,115 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestPauseKeys tests that the pause and resume keys stop and continue the active commands
+func TestPauseKeys(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	// The counting loop runs in a grandchild, which has to be paused as well
+	counter := filepath.Join(t.TempDir(), "counter")
+	cmd := exec.Command("sh", "-c", `sh -c 'i=0; while :; do i=$((i+1)); echo $i > "$0"; sleep 0.01; done' "$0"; true`, counter)
+	groupProcesses(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start command: %v", err)
+	}
+	activeCommands.Store("pause-test", cmd)
+	defer func() {
+		activeCommands.Delete("pause-test")
+		paused.Store(false)
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		_ = cmd.Wait()
+	}()
+
+	read := func() string {
+		data, _ := os.ReadFile(counter)
+		return string(data)
+	}
+	// Waits until the counter changes, or reports that it did not
+	advances := func() bool {
+		before := read()
+		for i := 0; i < 25; i++ {
+			time.Sleep(20 * time.Millisecond)
+			if read() != before {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !advances() {
+		t.Fatal("command did not start counting")
+	}
+
+	output := captureStdout(func() {
+		readPauseKeys(strings.NewReader("xp"))
+	})
+	if !strings.Contains(output, "Paused 1 command, press r to resume") {
+		t.Errorf("pause output = %q, want the paused status", output)
+	}
+	// Let a write in progress land before checking
+	time.Sleep(50 * time.Millisecond)
+	if advances() {
+		t.Error("command kept running after pressing p")
+	}
+
+	output = captureStdout(func() {
+		readPauseKeys(strings.NewReader("r"))
+	})
+	if !strings.Contains(output, "Resumed 1 command") {
+		t.Errorf("resume output = %q, want the resumed status", output)
+	}
+	if !advances() {
+		t.Error("command did not continue after pressing r")
+	}
+}
+
+// TestSignalCommandGroup tests that signalling a command in a process group
+// of its own also reaches the processes it started
+func TestSignalCommandGroup(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	marker := filepath.Join(t.TempDir(), "alive")
+	cmd := exec.Command("sh", "-c", `sh -c 'while :; do touch "$0"; sleep 0.01; done' "$0"; true`, marker)
+	groupProcesses(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start command: %v", err)
+	}
+	defer func() {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}()
+
+	for i := 0; i < 50; i++ {
+		if _, err := os.Stat(marker); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := signalCommand(cmd.Process, syscall.SIGTERM); err != nil {
+		t.Fatalf("signalCommand() error = %v", err)
+	}
+	_ = cmd.Wait()
+
+	// The grandchild would keep touching the marker if it survived
+	time.Sleep(50 * time.Millisecond)
+	_ = os.Remove(marker)
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("grandchild kept running after signalling the command")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Whether commands can be paused on this platform
+const pauseSupported = false
+
+// groupProcesses does nothing on Windows, where commands cannot be paused
+func groupProcesses(cmd *exec.Cmd) {}
+
+// signalCommand sends a signal to a command
+func signalCommand(process *os.Process, sig os.Signal) error {
+	return process.Signal(sig)
+}
+
+// stopProcess is not supported on Windows
+func stopProcess(process *os.Process) error {
+	return errors.New("pausing commands is not supported on Windows")
+}
+
+// continueProcess is not supported on Windows
+func continueProcess(process *os.Process) error {
+	return errors.New("pausing commands is not supported on Windows")
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// catchBrokenPipe makes writes to a closed stdout return EPIPE instead of
+// killing rufl with SIGPIPE, so it can shut down its commands properly.
+// A handler (rather than ignoring the signal) is used so that commands do
+// not inherit an ignored SIGPIPE.
+func catchBrokenPipe() {
+	pipeChan := make(chan os.Signal, 1)
+	signal.Notify(pipeChan, syscall.SIGPIPE)
+
+	go func() {
+		for range pipeChan {
+		}
+	}()
+}
+
+// isBrokenPipe reports whether a write failed because the reader went away
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, syscall.EPIPE)
+}
@@ -0,0 +1,19 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// catchBrokenPipe is a no-op on Windows, where writes to a closed pipe
+// always return an error
+func catchBrokenPipe() {}
+
+// isBrokenPipe reports whether a write failed because the reader went away
+func isBrokenPipe(err error) bool {
+	return errors.Is(err, windows.ERROR_BROKEN_PIPE) || errors.Is(err, windows.ERROR_NO_DATA)
+}
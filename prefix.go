@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// Minimum width of the prefix of output lines, 0 for no padding
+	prefixWidth int
+	// Where the prefix sits within --prefix-width: left or right
+	prefixAlign string
+	// Brackets around the prefix: [], <>, () or none
+	bracketStyle string
+)
+
+// checkPrefixOptions validates the prefix rendering options
+func checkPrefixOptions() error {
+	if prefixWidth < 0 {
+		return fmt.Errorf("invalid --prefix-width %d", prefixWidth)
+	}
+	switch prefixAlign {
+	case "", "left", "right":
+	default:
+		return fmt.Errorf("invalid --prefix-align '%s', expected left or right", prefixAlign)
+	}
+	switch bracketStyle {
+	case "", "[]", "<>", "()", "none":
+	default:
+		return fmt.Errorf("invalid --bracket-style '%s', expected [], <>, () or none", bracketStyle)
+	}
+	return nil
+}
+
+// formatPrefix renders the prefix of an output line around its label, such
+// as "build:out", padded to --prefix-width and followed by a space
+func formatPrefix(label string) string {
+	prefix := label
+	switch bracketStyle {
+	case "none":
+	case "<>", "()":
+		prefix = bracketStyle[:1] + label + bracketStyle[1:]
+	default:
+		prefix = "[" + label + "]"
+	}
+
+	padding := strings.Repeat(" ", max(prefixWidth-visibleWidth(prefix), 0))
+	if prefixAlign == "right" {
+		return padding + prefix + " "
+	}
+	return prefix + padding + " "
+}
@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+// TestFormatPrefix tests bracket styles, padding and alignment of prefixes
+func TestFormatPrefix(t *testing.T) {
+	oldWidth, oldAlign, oldStyle := prefixWidth, prefixAlign, bracketStyle
+	defer func() { prefixWidth, prefixAlign, bracketStyle = oldWidth, oldAlign, oldStyle }()
+
+	tests := []struct {
+		width int
+		align string
+		style string
+		want  string
+	}{
+		{style: "[]", want: "[build] "},
+		{style: "", want: "[build] "},
+		{style: "<>", want: "<build> "},
+		{style: "()", want: "(build) "},
+		{style: "none", want: "build "},
+		{width: 10, align: "left", style: "[]", want: "[build]    "},
+		{width: 10, align: "right", style: "[]", want: "   [build] "},
+		{width: 3, align: "right", style: "[]", want: "[build] "},
+		{width: 8, align: "right", style: "none", want: "   build "},
+	}
+
+	for _, tt := range tests {
+		prefixWidth, prefixAlign, bracketStyle = tt.width, tt.align, tt.style
+		if got := formatPrefix("build"); got != tt.want {
+			t.Errorf("formatPrefix() with width %d, align %q, style %q = %q, want %q", tt.width, tt.align, tt.style, got, tt.want)
+		}
+	}
+}
+
+// TestCheckPrefixOptions tests that invalid prefix options are rejected
+func TestCheckPrefixOptions(t *testing.T) {
+	oldWidth, oldAlign, oldStyle := prefixWidth, prefixAlign, bracketStyle
+	defer func() { prefixWidth, prefixAlign, bracketStyle = oldWidth, oldAlign, oldStyle }()
+
+	prefixWidth, prefixAlign, bracketStyle = 12, "right", "<>"
+	if err := checkPrefixOptions(); err != nil {
+		t.Errorf("checkPrefixOptions() error = %v, want nil", err)
+	}
+
+	for _, set := range []func(){
+		func() { prefixWidth = -1 },
+		func() { prefixAlign = "center" },
+		func() { bracketStyle = "{}" },
+	} {
+		prefixWidth, prefixAlign, bracketStyle = 12, "right", "<>"
+		set()
+		if err := checkPrefixOptions(); err == nil {
+			t.Errorf("checkPrefixOptions() with width %d, align %q, style %q = nil, want an error", prefixWidth, prefixAlign, bracketStyle)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	// Raw --wait-for values
+	waitForFlags []string
+	// Probes that must succeed before each sequential step after the first
+	readinessProbes []readinessProbe
+	// How long to wait for the probes before giving up
+	waitTimeout time.Duration
+	// How long to wait between two probe attempts
+	waitInterval time.Duration
+)
+
+// readinessProbe checks whether a service is ready: a TCP port accepting
+// connections, or an HTTP endpoint answering with a 2xx status
+type readinessProbe struct {
+	raw    string
+	scheme string
+	target string
+}
+
+// parseProbe parses a probe such as "tcp://localhost:5432" or
+// "http://localhost:8080/health"
+func parseProbe(value string) (readinessProbe, error) {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return readinessProbe{}, fmt.Errorf("invalid probe '%s', expected tcp://HOST:PORT or http(s)://HOST/PATH", value)
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		if u.Port() == "" {
+			return readinessProbe{}, fmt.Errorf("invalid probe '%s', a tcp probe needs a port", value)
+		}
+		return readinessProbe{raw: value, scheme: "tcp", target: u.Host}, nil
+	case "http", "https":
+		return readinessProbe{raw: value, scheme: u.Scheme, target: value}, nil
+	default:
+		return readinessProbe{}, fmt.Errorf("unsupported probe scheme '%s' in '%s', expected tcp, http or https", u.Scheme, value)
+	}
+}
+
+// parseProbes parses all --wait-for values
+func parseProbes(values []string) ([]readinessProbe, error) {
+	var probes []readinessProbe
+	for _, value := range values {
+		probe, err := parseProbe(value)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, probe)
+	}
+	return probes, nil
+}
+
+// check tries the probe once, giving up after timeout
+func (p readinessProbe) check(timeout time.Duration) error {
+	if p.scheme == "tcp" {
+		conn, err := net.DialTimeout("tcp", p.target, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := http.Client{Timeout: timeout}
+	resp, err := client.Get(p.target)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// waitUntilReady polls the probes every interval until they all succeed, or
+// returns the last error once timeout has passed
+func waitUntilReady(probes []readinessProbe, timeout time.Duration, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, probe := range probes {
+		for {
+			err := probe.check(interval)
+			if err == nil {
+				break
+			}
+			if !time.Now().Add(interval).Before(deadline) {
+				return fmt.Errorf("%s not ready after %v: %v", probe.raw, timeout, err)
+			}
+			time.Sleep(interval)
+		}
+	}
+	return nil
+}
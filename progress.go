@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+var (
+	// File descriptor to write the progress line protocol to, 0 disables it
+	progressFD int
+	// Destination of progress lines, nil when progress is disabled
+	progressWriter io.Writer
+	// Mutex serializing writes to progressWriter
+	progressMutex sync.Mutex
+)
+
+// setupProgress opens the file descriptor selected with --progress-fd
+func setupProgress() error {
+	if progressFD < 0 {
+		return fmt.Errorf("invalid progress file descriptor %d", progressFD)
+	}
+	if progressFD > 0 {
+		progressWriter = os.NewFile(uintptr(progressFD), "progress")
+	}
+	return nil
+}
+
+// emitProgress writes the progress line for a lifecycle event, a lighter
+// alternative to the NDJSON events stream for shell parents:
+//
+//	STARTED tag
+//	DONE tag code
+//	FAILED tag
+//
+// Events that are not about a command starting or finishing are ignored.
+func emitProgress(event Event) {
+	if progressWriter == nil {
+		return
+	}
+
+	var line string
+	switch {
+	case event.Event == "started":
+		line = fmt.Sprintf("STARTED %s\n", event.Tag)
+	case event.Event == "exited" && event.ExitCode != nil:
+		line = fmt.Sprintf("DONE %s %d\n", event.Tag, *event.ExitCode)
+	case event.Event == "exited":
+		// The command could not be started
+		line = fmt.Sprintf("FAILED %s\n", event.Tag)
+	default:
+		return
+	}
+
+	progressMutex.Lock()
+	defer progressMutex.Unlock()
+
+	// A broken progress reader must not affect the commands being run
+	_, _ = io.WriteString(progressWriter, line)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestEmitProgress tests the progress lines written for lifecycle events
+func TestEmitProgress(t *testing.T) {
+	var buf bytes.Buffer
+	oldWriter := progressWriter
+	progressWriter = &buf
+	defer func() { progressWriter = oldWriter }()
+
+	code := 2
+	emitProgress(Event{Event: "started", Tag: "build", Command: "make", PID: 42})
+	emitProgress(Event{Event: "line", Tag: "build", Stream: "out", Line: "ok"})
+	emitProgress(Event{Event: "exited", Tag: "build", ExitCode: &code})
+	emitProgress(Event{Event: "exited", Tag: "lint", Error: "not found"})
+
+	want := "STARTED build\nDONE build 2\nFAILED lint\n"
+	if got := buf.String(); got != want {
+		t.Errorf("emitProgress() wrote %q, want %q", got, want)
+	}
+}
+
+// TestCommandProgress tests that running a command writes its progress lines
+func TestCommandProgress(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	var buf bytes.Buffer
+	oldWriter := progressWriter
+	oldNoColor := noColor
+	progressWriter = &buf
+	noColor = true
+	defer func() {
+		progressWriter = oldWriter
+		noColor = oldNoColor
+	}()
+
+	captureStdout(func() {
+		executeCommand(CommandInfo{Command: "sh -c 'exit 3'", Tag: "fail"})
+	})
+
+	want := "STARTED fail\nDONE fail 3\n"
+	if got := buf.String(); got != want {
+		t.Errorf("progress = %q, want %q", got, want)
+	}
+}
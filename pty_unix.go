@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/creack/pty"
+)
+
+// ptySupported indicates if commands can be run with a pseudo-terminal
+const ptySupported = true
+
+// startWithPTY starts the command attached to a new pseudo-terminal and
+// returns a reader for its combined output and a function to release the
+// terminal once the output has been consumed
+func startWithPTY(cmd *exec.Cmd) (io.Reader, func(), error) {
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Give the command the same window size as rufl's terminal, if it has one
+	_ = pty.InheritSize(os.Stdin, ptmx)
+
+	return ptyReader{ptmx}, func() { _ = ptmx.Close() }, nil
+}
+
+// ptyReader reads from a pseudo-terminal master. Linux reports EIO once the
+// last process holding the terminal exits; that is the end of the output,
+// not an error.
+type ptyReader struct {
+	f *os.File
+}
+
+func (r ptyReader) Read(p []byte) (int, error) {
+	n, err := r.f.Read(p)
+	if errors.Is(err, syscall.EIO) {
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,18 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+)
+
+// ptySupported indicates if commands can be run with a pseudo-terminal
+const ptySupported = false
+
+// startWithPTY is not supported on Windows
+func startWithPTY(cmd *exec.Cmd) (io.Reader, func(), error) {
+	return nil, nil, errors.New("pseudo-terminals are not supported on Windows")
+}
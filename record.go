@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// File to record the run to in asciinema cast format (--record)
+	recordFile string
+	// Destination of recorded output, nil when not recording
+	recordWriter *bufio.Writer
+	// The cast file recordWriter writes to
+	recordCast *os.File
+	// When recording started, frames are timed relative to it
+	recordStart time.Time
+)
+
+// castHeader is the first line of an asciinema v2 cast file
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// setupRecording creates the cast file selected with --record and writes
+// its header. The file follows the asciinema v2 format, so runs can be
+// played back with "asciinema play" or shared on asciinema.org.
+func setupRecording() error {
+	if recordFile == "" {
+		return nil
+	}
+
+	file, err := os.Create(recordFile)
+	if err != nil {
+		return fmt.Errorf("creating recording: %w", err)
+	}
+
+	recordStart = time.Now()
+	header := castHeader{
+		Version:   2,
+		Width:     envSize("COLUMNS", 80),
+		Height:    envSize("LINES", 24),
+		Timestamp: recordStart.Unix(),
+		Title:     "rufl " + strings.Join(os.Args[1:], " "),
+		Env:       map[string]string{"SHELL": os.Getenv("SHELL"), "TERM": os.Getenv("TERM")},
+	}
+	data, err := json.Marshal(header)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("writing recording: %w", err)
+	}
+
+	recordCast = file
+	recordWriter = bufio.NewWriter(file)
+	return nil
+}
+
+// closeRecording flushes and closes the cast file when rufl exits. Output
+// written after it is no longer recorded.
+func closeRecording() {
+	outputMutex.Lock()
+	defer outputMutex.Unlock()
+	if recordWriter == nil {
+		return
+	}
+
+	if err := recordWriter.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing recording: %v\n", err)
+	}
+	if err := recordCast.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error closing recording: %v\n", err)
+	}
+	recordWriter, recordCast = nil, nil
+}
+
+// envSize reads a terminal dimension from the environment
+func envSize(name string, fallback int) int {
+	if size, err := strconv.Atoi(os.Getenv(name)); err == nil && size > 0 {
+		return size
+	}
+	return fallback
+}
+
+// recordOutput appends output to the recording as a frame timed since the
+// start of the run. Newlines are recorded as a terminal would print them.
+// Must be called with outputMutex held.
+func recordOutput(text string) {
+	if recordWriter == nil {
+		return
+	}
+
+	text = strings.ReplaceAll(text, "\n", "\r\n")
+	data, err := json.Marshal([]interface{}{time.Since(recordStart).Seconds(), "o", text})
+	if err != nil {
+		return
+	}
+
+	// A failing recording must not affect the commands being run
+	_, _ = recordWriter.Write(append(data, '\n'))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRecording tests that output is recorded in asciinema cast format
+func TestRecording(t *testing.T) {
+	oldRecordFile := recordFile
+	oldNoColor := noColor
+	recordFile = filepath.Join(t.TempDir(), "run.cast")
+	noColor = true
+	defer func() {
+		recordFile = oldRecordFile
+		noColor = oldNoColor
+		closeRecording()
+	}()
+
+	if err := setupRecording(); err != nil {
+		t.Fatalf("setupRecording() failed: %v", err)
+	}
+
+	captureStdout(func() {
+		processOutput(strings.NewReader("hello\n"), "a", "out", colorGreen)
+	})
+	closeRecording()
+
+	data, err := os.ReadFile(recordFile)
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("recording has %d lines, want a header and one frame: %q", len(lines), data)
+	}
+
+	var header castHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 || header.Width <= 0 {
+		t.Errorf("recording header = %q, want an asciinema v2 header", lines[0])
+	}
+
+	var frame []interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &frame); err != nil || len(frame) != 3 {
+		t.Fatalf("recording frame = %q, want [time, type, data]", lines[1])
+	}
+	if frame[1] != "o" || frame[2] != "[a:out] hello\r\n" {
+		t.Errorf("recording frame = %v, want the output line", frame)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// fdRedirect sends a file descriptor of a command to a file, as in
+// +trace{3>trace.log}:mycmd
+type fdRedirect struct {
+	FD     int
+	Path   string
+	Append bool
+}
+
+// redirectBlockPattern matches a {...} block of redirects in a tag
+var redirectBlockPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// redirectPattern matches a single N>FILE or N>>FILE redirect
+var redirectPattern = regexp.MustCompile(`^(\d+)(>>?)(.+)$`)
+
+// splitRedirects removes the {N>FILE} blocks from a tag and returns the tag
+// without them and the redirects they contain. A block can hold several
+// redirects separated by commas, as in {3>trace.log,4>>events.log}.
+func splitRedirects(spec string) (string, []fdRedirect, error) {
+	blocks := redirectBlockPattern.FindAllStringSubmatch(spec, -1)
+	tag := redirectBlockPattern.ReplaceAllString(spec, "")
+
+	var redirects []fdRedirect
+	seen := make(map[int]bool)
+	for _, block := range blocks {
+		for _, spec := range strings.Split(block[1], ",") {
+			spec = strings.TrimSpace(spec)
+			match := redirectPattern.FindStringSubmatch(spec)
+			if match == nil {
+				return tag, nil, fmt.Errorf("invalid redirect '%s', expected N>FILE or N>>FILE", spec)
+			}
+
+			fd, err := strconv.Atoi(match[1])
+			if err != nil || fd < 3 || fd > 9 {
+				return tag, nil, fmt.Errorf("invalid file descriptor %s, expected 3 to 9", match[1])
+			}
+			if seen[fd] {
+				return tag, nil, fmt.Errorf("file descriptor %d is redirected more than once", fd)
+			}
+			seen[fd] = true
+
+			redirects = append(redirects, fdRedirect{FD: fd, Path: strings.TrimSpace(match[3]), Append: match[2] == ">>"})
+		}
+	}
+	return tag, redirects, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestSplitRedirects tests splitting {N>FILE} blocks off tags
+func TestSplitRedirects(t *testing.T) {
+	tests := []struct {
+		spec          string
+		wantTag       string
+		wantRedirects []fdRedirect
+		wantErr       bool
+	}{
+		{spec: "build", wantTag: "build"},
+		{spec: "trace{3>trace.log}", wantTag: "trace", wantRedirects: []fdRedirect{{FD: 3, Path: "trace.log"}}},
+		{spec: "trace{3>a.log, 4>>b.log}!2", wantTag: "trace!2", wantRedirects: []fdRedirect{{FD: 3, Path: "a.log"}, {FD: 4, Path: "b.log", Append: true}}},
+		{spec: "trace{3>a.log}{5>/tmp/c#1.log}", wantTag: "trace", wantRedirects: []fdRedirect{{FD: 3, Path: "a.log"}, {FD: 5, Path: "/tmp/c#1.log"}}},
+		{spec: "trace{2>err.log}", wantTag: "trace", wantErr: true},
+		{spec: "trace{3<in.log}", wantTag: "trace", wantErr: true},
+		{spec: "trace{3>a.log,3>b.log}", wantTag: "trace", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			tag, redirects, err := splitRedirects(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitRedirects(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if tag != tt.wantTag || !reflect.DeepEqual(redirects, tt.wantRedirects) {
+				t.Errorf("splitRedirects(%q) = (%q, %v), want (%q, %v)", tt.spec, tag, redirects, tt.wantTag, tt.wantRedirects)
+			}
+		})
+	}
+}
+
+// TestRedirectTagSpec tests that redirects and modifiers of a tag are applied together
+func TestRedirectTagSpec(t *testing.T) {
+	cmdInfo := applyTagSpec(CommandInfo{Tag: "trace{3>trace.log}!1", Command: "true"})
+	if cmdInfo.Tag != "trace" || cmdInfo.Priority != 1 || !reflect.DeepEqual(cmdInfo.Redirects, []fdRedirect{{FD: 3, Path: "trace.log"}}) {
+		t.Errorf("applyTagSpec() = %+v, want trace with priority 1 and fd 3 redirected", cmdInfo)
+	}
+}
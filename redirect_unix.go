@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// openRedirects opens the files a command's file descriptors are redirected
+// to and passes them to the command. Relative paths are taken from the
+// command's working directory. The returned function closes rufl's copies
+// of the files.
+func openRedirects(cmd *exec.Cmd, redirects []fdRedirect) (func(), error) {
+	var files []*os.File
+	closeFiles := func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}
+
+	for _, redirect := range redirects {
+		index := redirect.FD - 3
+		if index < len(cmd.ExtraFiles) && cmd.ExtraFiles[index] != nil {
+			closeFiles()
+			return nil, fmt.Errorf("file descriptor %d is already used by --barrier", redirect.FD)
+		}
+
+		path := redirect.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cmd.Dir, path)
+		}
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if redirect.Append {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(path, flags, 0644)
+		if err != nil {
+			closeFiles()
+			return nil, err
+		}
+		files = append(files, file)
+
+		// Descriptors in between stay closed in the command
+		for len(cmd.ExtraFiles) <= index {
+			cmd.ExtraFiles = append(cmd.ExtraFiles, nil)
+		}
+		cmd.ExtraFiles[index] = file
+	}
+	return closeFiles, nil
+}
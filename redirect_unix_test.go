@@ -0,0 +1,69 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRedirectRun tests that a command's extra file descriptors are written to files
+func TestRedirectRun(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	dir := t.TempDir()
+	oldWorkDir, oldNoColor := workDir, noColor
+	workDir, noColor = dir, true
+	defer func() { workDir, noColor = oldWorkDir, oldNoColor }()
+
+	if err := os.WriteFile(filepath.Join(dir, "events.log"), []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var result CommandResult
+	captureStdout(func() {
+		result = runCommand(CommandInfo{
+			Command:   "sh -c 'echo trace >&3; echo event >&5; echo out'",
+			Tag:       "trace",
+			Redirects: []fdRedirect{{FD: 3, Path: "trace.log"}, {FD: 5, Path: "events.log", Append: true}},
+		}, nil)
+	})
+	if !result.Success {
+		t.Fatalf("runCommand() result = %+v, want success", result)
+	}
+
+	for name, want := range map[string]string{"trace.log": "trace\n", "events.log": "old\nevent\n"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
+
+// TestRedirectBarrierConflict tests that fd 3 cannot be redirected while --barrier uses it
+func TestRedirectBarrierConflict(t *testing.T) {
+	gate, err := newStartBarrier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gate.close()
+
+	oldGate, oldNoColor := startGate, noColor
+	startGate, noColor = gate, true
+	defer func() { startGate, noColor = oldGate, oldNoColor }()
+
+	var result CommandResult
+	output := captureStdout(func() {
+		result = runCommand(CommandInfo{Command: "true", Tag: "trace", Redirects: []fdRedirect{{FD: 3, Path: filepath.Join(t.TempDir(), "trace.log")}}}, nil)
+	})
+	if result.Success || output == "" {
+		t.Errorf("runCommand() = %+v with output %q, want an error about the barrier", result, output)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// openRedirects fails on Windows, where commands cannot inherit file
+// descriptors beyond stdin, stdout and stderr
+func openRedirects(cmd *exec.Cmd, redirects []fdRedirect) (func(), error) {
+	return nil, errors.New("file descriptor redirection is not supported on Windows")
+}
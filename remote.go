@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// sshScheme marks a remote host in the +tag@ssh://host:command syntax
+const sshScheme = "@ssh://"
+
+// sshConnectionFailed is the exit code ssh uses when it could not connect
+const sshConnectionFailed = 255
+
+// Host to run commands on over ssh when they do not name one themselves
+var remoteHost string
+
+// parseRemoteTag splits "tag@ssh://host:command" into its parts. ok is false
+// when the value does not name a remote host. The host ends at the first
+// colon, so ports have to be configured in ~/.ssh/config.
+func parseRemoteTag(value string) (tag, host, command string, ok bool) {
+	i := strings.Index(value, sshScheme)
+	if i < 0 || strings.Contains(value[:i], ":") {
+		return "", "", "", false
+	}
+
+	parts := strings.SplitN(value[i+len(sshScheme):], ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", "", false
+	}
+	return value[:i], parts[0], parts[1], true
+}
+
+// sshCommand creates a command running command on host through the ssh
+// client. BatchMode keeps ssh from waiting for a password that nobody can
+// type while several commands share the terminal.
+func sshCommand(host string, command string) *exec.Cmd {
+	return newCommand("ssh", "-o", "BatchMode=yes", host, "--", command)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+// TestParseRemoteTag tests parsing of the tag@ssh://host:command syntax
+func TestParseRemoteTag(t *testing.T) {
+	tests := []struct {
+		value       string
+		wantTag     string
+		wantHost    string
+		wantCommand string
+		wantOK      bool
+	}{
+		{value: "web@ssh://web1:uptime", wantTag: "web", wantHost: "web1", wantCommand: "uptime", wantOK: true},
+		{value: "web@ssh://deploy@web1:ls -l /srv", wantTag: "web", wantHost: "deploy@web1", wantCommand: "ls -l /srv", wantOK: true},
+		{value: "@ssh://web1:echo a:b", wantTag: "", wantHost: "web1", wantCommand: "echo a:b", wantOK: true},
+		{value: "web:echo user@ssh://host:x"},
+		{value: "web@ssh://web1"},
+		{value: "web@ssh://:uptime"},
+		{value: "web:uptime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			tag, host, command, ok := parseRemoteTag(tt.value)
+			if ok != tt.wantOK || tag != tt.wantTag || host != tt.wantHost || command != tt.wantCommand {
+				t.Errorf("parseRemoteTag(%q) = (%q, %q, %q, %v), want (%q, %q, %q, %v)",
+					tt.value, tag, host, command, ok, tt.wantTag, tt.wantHost, tt.wantCommand, tt.wantOK)
+			}
+		})
+	}
+}
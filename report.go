@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	// File to write the results of the run to as JSON
+	reportFile string
+	// Report of a previous run whose succeeded commands are skipped
+	resumeFrom string
+)
+
+// Report is the JSON document written with --report
+type Report struct {
+	Mode     string        `json:"mode"`
+	Started  time.Time     `json:"started"`
+	Duration float64       `json:"duration_seconds"`
+	Results  []ReportEntry `json:"results"`
+}
+
+// ReportEntry is the result of a single command in a report
+type ReportEntry struct {
+	Tag      string  `json:"tag"`
+	Command  string  `json:"command"`
+	ExitCode int     `json:"exit_code"`
+	Success  bool    `json:"success"`
+	TimedOut bool    `json:"timed_out,omitempty"`
+	Skipped  bool    `json:"skipped,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+	Restarts int     `json:"restarts,omitempty"`
+	Detached bool    `json:"detached,omitempty"`
+}
+
+// writeReport writes the results of a run to path
+func writeReport(path string, mode string, started time.Time, results []CommandResult, skipped []CommandResult) error {
+	report := Report{
+		Mode:     mode,
+		Started:  started,
+		Duration: time.Since(started).Seconds(),
+		Results:  []ReportEntry{},
+	}
+
+	for _, result := range skipped {
+		report.Results = append(report.Results, reportEntry(result, true))
+	}
+	for _, result := range results {
+		report.Results = append(report.Results, reportEntry(result, false))
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// reportEntry converts a command result into a report entry
+func reportEntry(result CommandResult, skipped bool) ReportEntry {
+	return ReportEntry{
+		Tag:      result.Tag,
+		Command:  result.Command,
+		ExitCode: result.ExitCode,
+		Success:  result.Success,
+		TimedOut: result.TimedOut,
+		Skipped:  skipped || result.Skipped,
+		Duration: result.Duration.Seconds(),
+		Restarts: result.Restarts,
+		Detached: result.Detached,
+	}
+}
+
+// readReport reads a report written by a previous run
+func readReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("parsing report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// skipSucceeded splits commands into those still to run and those that
+// succeeded in the given report. A command is only skipped when both its
+// tag and its command line match, so edited commands run again.
+func skipSucceeded(commands []CommandInfo, report *Report) ([]CommandInfo, []CommandResult) {
+	succeeded := make(map[string]ReportEntry)
+	for _, entry := range report.Results {
+		// Detached commands were only started, so they run again
+		if entry.Success && !entry.Detached {
+			succeeded[entry.Tag] = entry
+		}
+	}
+
+	var remaining []CommandInfo
+	var skipped []CommandResult
+	for _, cmdInfo := range commands {
+		entry, ok := succeeded[cmdInfo.Tag]
+		if !ok || entry.Command != cmdInfo.Command {
+			remaining = append(remaining, cmdInfo)
+			continue
+		}
+		skipped = append(skipped, CommandResult{
+			Tag:      cmdInfo.Tag,
+			Command:  cmdInfo.Command,
+			Success:  true,
+			Duration: time.Duration(entry.Duration * float64(time.Second)),
+		})
+	}
+	return remaining, skipped
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestReportRoundTrip tests that a written report can be read back
+func TestReportRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	results := []CommandResult{
+		{Tag: "build", Command: "make", ExitCode: 0, Success: true, Duration: 2 * time.Second},
+		{Tag: "test", Command: "make test", ExitCode: 2, Duration: time.Second},
+	}
+
+	if err := writeReport(path, "sequential", time.Now(), results, nil); err != nil {
+		t.Fatalf("writeReport() failed: %v", err)
+	}
+
+	report, err := readReport(path)
+	if err != nil {
+		t.Fatalf("readReport() failed: %v", err)
+	}
+
+	if report.Mode != "sequential" {
+		t.Errorf("report.Mode = %q, want sequential", report.Mode)
+	}
+	want := []ReportEntry{
+		{Tag: "build", Command: "make", ExitCode: 0, Success: true, Duration: 2},
+		{Tag: "test", Command: "make test", ExitCode: 2, Duration: 1},
+	}
+	if !reflect.DeepEqual(report.Results, want) {
+		t.Errorf("report.Results = %+v, want %+v", report.Results, want)
+	}
+}
+
+// TestSkipSucceeded tests that only commands that succeeded unchanged are skipped
+func TestSkipSucceeded(t *testing.T) {
+	report := &Report{Results: []ReportEntry{
+		{Tag: "build", Command: "make", Success: true},
+		{Tag: "lint", Command: "make lint", Success: true},
+		{Tag: "test", Command: "make test", ExitCode: 2},
+	}}
+	commands := []CommandInfo{
+		{Tag: "build", Command: "make", Index: 0},
+		{Tag: "lint", Command: "make lint-all", Index: 1},
+		{Tag: "test", Command: "make test", Index: 2},
+		{Tag: "docs", Command: "make docs", Index: 3},
+	}
+
+	remaining, skipped := skipSucceeded(commands, report)
+
+	if !reflect.DeepEqual(remaining, commands[1:]) {
+		t.Errorf("skipSucceeded() remaining = %+v, want %+v", remaining, commands[1:])
+	}
+	if len(skipped) != 1 || skipped[0].Tag != "build" || !skipped[0].Success {
+		t.Errorf("skipSucceeded() skipped = %+v, want only a successful build", skipped)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Programs that must be found in PATH before anything runs, each value a
+// comma-separated list such as "go,npm,docker"
+var requiredPrograms []string
+
+// missingPrograms returns the required programs that cannot be found, in
+// the order given and without duplicates
+func missingPrograms(values []string) []string {
+	var missing []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			if _, err := exec.LookPath(name); err != nil {
+				missing = append(missing, name)
+			}
+		}
+	}
+	return missing
+}
+
+// checkRequiredPrograms verifies that every --require program is available
+func checkRequiredPrograms(values []string) error {
+	missing := missingPrograms(values)
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("required programs not found in PATH: %s", strings.Join(missing, ", "))
+}
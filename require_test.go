@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestMissingPrograms tests that programs not in PATH are listed once, in order
+func TestMissingPrograms(t *testing.T) {
+	got := missingPrograms([]string{"go, no-such-program-a", "no-such-program-b,no-such-program-a", ""})
+	want := []string{"no-such-program-a", "no-such-program-b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("missingPrograms() = %q, want %q", got, want)
+	}
+
+	if err := checkRequiredPrograms([]string{"go"}); err != nil {
+		t.Errorf("checkRequiredPrograms() error = %v, want nil for a program in PATH", err)
+	}
+	if err := checkRequiredPrograms([]string{"no-such-program-a"}); err == nil {
+		t.Error("checkRequiredPrograms() error = nil, want an error for a missing program")
+	}
+}
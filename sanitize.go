@@ -0,0 +1,71 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// How control characters in command output are treated: pass-through,
+// keep-color (drop everything but color codes) or strip-all
+var sanitizeMode string
+
+// Remove trailing whitespace from lines of command output (--trim-trailing)
+var trimTrailing bool
+
+// colorCodePattern matches an SGR escape sequence, which only sets colors
+// and text attributes
+var colorCodePattern = regexp.MustCompile(`^\x1b\[[0-9;]*m$`)
+
+// sanitizeLine removes escape sequences and control characters from a line
+// of command output, so a command cannot move the cursor, clear the screen
+// or overwrite the prefixes of other lines. With keep-color, color codes
+// are left in place. Tabs are always kept.
+func sanitizeLine(line string) string {
+	if sanitizeMode != "keep-color" && sanitizeMode != "strip-all" {
+		return line
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range ansiPattern.FindAllStringIndex(line, -1) {
+		writeWithoutControls(&b, line[last:match[0]])
+		seq := line[match[0]:match[1]]
+		if sanitizeMode == "keep-color" && colorCodePattern.MatchString(seq) {
+			b.WriteString(seq)
+		}
+		last = match[1]
+	}
+	writeWithoutControls(&b, line[last:])
+	return b.String()
+}
+
+// trimTrailingSpace removes the whitespace at the end of a line of command
+// output. Escape sequences at the end of the line, such as a color reset,
+// are kept, and the whitespace before them is removed.
+func trimTrailingSpace(line string) string {
+	suffix := ""
+	for {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		matches := ansiPattern.FindAllStringIndex(line, -1)
+		if len(matches) == 0 || matches[len(matches)-1][1] != len(line) {
+			return line + suffix
+		}
+		start := matches[len(matches)-1][0]
+		suffix = line[start:] + suffix
+		line = line[:start]
+	}
+}
+
+// writeWithoutControls writes s without its control characters, other than
+// tabs. Bytes that are not valid UTF-8 are written as they are.
+func writeWithoutControls(b *strings.Builder, s string) {
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		if r == '\t' || !unicode.IsControl(r) {
+			b.WriteString(s[:size])
+		}
+		s = s[size:]
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// TestSanitizeLine tests the policies for control characters in output
+func TestSanitizeLine(t *testing.T) {
+	oldSanitizeMode := sanitizeMode
+	defer func() { sanitizeMode = oldSanitizeMode }()
+
+	line := "\x1b[2J\x1b[H\x1b[31mred\x1b[0m\tdone\r\x1b]0;title\x07\x1b[1;32mok\x1b[0m\a"
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{mode: "pass-through", want: line},
+		{mode: "keep-color", want: "\x1b[31mred\x1b[0m\tdone\x1b[1;32mok\x1b[0m"},
+		{mode: "strip-all", want: "red\tdoneok"},
+	}
+
+	for _, tt := range tests {
+		sanitizeMode = tt.mode
+		if got := sanitizeLine(line); got != tt.want {
+			t.Errorf("sanitizeLine() with %s = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+// TestTrimTrailingSpace tests that trailing whitespace is removed without losing escape sequences
+func TestTrimTrailingSpace(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "done  \t", want: "done"},
+		{line: "  indented", want: "  indented"},
+		{line: "\x1b[32mok   \x1b[0m  ", want: "\x1b[32mok\x1b[0m"},
+		{line: "a \x1b[1m \x1b[0m\r", want: "a\x1b[1m\x1b[0m"},
+		{line: "   ", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := trimTrailingSpace(tt.line); got != tt.want {
+			t.Errorf("trimTrailingSpace(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+// TestSanitizeLineStrayEscape tests that an escape character outside a sequence is removed
+func TestSanitizeLineStrayEscape(t *testing.T) {
+	oldSanitizeMode := sanitizeMode
+	sanitizeMode = "keep-color"
+	defer func() { sanitizeMode = oldSanitizeMode }()
+
+	if got := sanitizeLine("reset\x1bc here\u009b"); got != "resetc here" {
+		t.Errorf("sanitizeLine() = %q, want stray control characters removed", got)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Read commands as JSON lines from stdin instead of the command line (--server-stdin)
+var serverStdin bool
+
+// serverResultMarker starts the lines with the results of submitted
+// commands, which tells them apart from the output of the commands
+const serverResultMarker = "[rufl:result] "
+
+// serverRequest is a command submitted as a JSON line
+type serverRequest struct {
+	Tag     string `json:"tag"`
+	Command string `json:"command"`
+}
+
+// serverResult is written to stdout as a JSON line when a submitted command finishes
+type serverResult struct {
+	Event string `json:"event"`
+	ReportEntry
+}
+
+// runServer reads one JSON command object per line from in, such as
+// {"tag": "build", "command": "make"}, and launches each command as it
+// arrives. Commands run one at a time in sequential mode and up to
+// --max-parallel at once in parallel mode. When in is closed, it waits for
+// the remaining commands and returns all results in order of completion.
+func runServer(in io.Reader, parallel bool) []CommandResult {
+	parallelMode = parallel
+
+	defer closeFifos()
+	defer closeLogFiles()
+	armTrapExit()
+	defer runTrapExit()
+	defer waitForHooks()
+
+	if !flushLines {
+		stopBatching := startBatching(batchInterval)
+		defer stopBatching()
+	}
+
+	workers := 1
+	if parallel {
+		workers = maxParallel
+	}
+
+	queue := make(chan CommandInfo)
+	var results []CommandResult
+	var resultsMutex sync.Mutex
+	var wg sync.WaitGroup
+
+	run := func(cmdInfo CommandInfo) {
+		result := executeCommand(cmdInfo)
+		printServerResult(result)
+
+		resultsMutex.Lock()
+		results = append(results, result)
+		resultsMutex.Unlock()
+	}
+
+	// With a limit, a fixed number of workers takes commands off the queue
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cmdInfo := range queue {
+				run(cmdInfo)
+			}
+		}()
+	}
+
+	startTime := time.Now()
+	index := 0
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, bufferSize), bufferSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		request, err := parseServerRequest(line)
+		if err != nil {
+			printColoredMessage(fmt.Sprintf("Ignoring invalid command line from stdin: %s", line), colorRed)
+			continue
+		}
+
+		cmdInfo := CommandInfo{Tag: request.Tag, Command: request.Command, Index: index}
+		index++
+		if cmdInfo.Tag == "" {
+			cmdInfo.Tag = strconv.Itoa(index)
+			if derived, ok := tagFromCommand(cmdInfo.Command); ok {
+				cmdInfo.Tag = derived
+			}
+		}
+		// Modifiers such as !PRIORITY or @timeout= work as on the command line
+		cmdInfo = applyTagSpec(cmdInfo)
+		if normalizeTags {
+			cmdInfo.Tag = normalizeTag(cmdInfo.Tag)
+		}
+		cmdInfo.Tag = tagPrefix + cmdInfo.Tag
+		if cmdInfo.Host == "" {
+			cmdInfo.Host = remoteHost
+		}
+		if cmdInfo.Host == "" && cmdInfo.Image == "" {
+			cmdInfo.Image = containerImage
+		}
+		cmdInfo = expandVariables([]CommandInfo{cmdInfo})[0]
+		reportWarnings()
+
+		if workers > 0 {
+			queue <- cmdInfo
+		} else {
+			wg.Add(1)
+			go func(cmdInfo CommandInfo) {
+				defer wg.Done()
+				run(cmdInfo)
+			}(cmdInfo)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		printColoredMessage(fmt.Sprintf("Error reading commands from stdin: %v", err), colorRed)
+	}
+
+	close(queue)
+	wg.Wait()
+
+	if !noBanner {
+		printBanner(results, time.Since(startTime))
+	}
+	return results
+}
+
+// parseServerRequest parses a JSON line submitting a command. Only a tag
+// and a command can be given, anything else is rejected.
+func parseServerRequest(line string) (serverRequest, error) {
+	var request serverRequest
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		return serverRequest{}, err
+	}
+	if decoder.More() {
+		return serverRequest{}, fmt.Errorf("unexpected data after the command")
+	}
+	if strings.TrimSpace(request.Command) == "" {
+		return serverRequest{}, fmt.Errorf("missing command")
+	}
+	return request, nil
+}
+
+// printServerResult writes the result of a submitted command as a JSON line,
+// marked with serverResultMarker
+func printServerResult(result CommandResult) {
+	data, err := json.Marshal(serverResult{Event: "result", ReportEntry: reportEntry(result, false)})
+	if err != nil {
+		return
+	}
+	printText(serverResultMarker + string(data) + "\n")
+}
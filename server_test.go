@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRunServer tests that commands read from stdin are run and reported as JSON lines
+func TestRunServer(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	input := `{"tag": "first", "command": "echo one"}` + "\n" +
+		"not json\n" +
+		`{"command": "echo env", "env": ["X=1"]}` + "\n" +
+		"\n" +
+		`{"tag": "second!1", "command": "echo two"}` + "\n"
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runServer(strings.NewReader(input), false)
+	})
+
+	if len(results) != 2 || results[0].Tag != "first" || results[1].Tag != "second" || !results[0].Success || !results[1].Success {
+		t.Fatalf("runServer() results = %+v, want two successful commands in order", results)
+	}
+	if !strings.Contains(output, "[first:out] one") || !strings.Contains(output, "[second:out] two") {
+		t.Errorf("runServer() output = %q, want the output of both commands", output)
+	}
+	if !strings.Contains(output, "Ignoring invalid command line from stdin: not json") || !strings.Contains(output, `Ignoring invalid command line from stdin: {"command": "echo env"`) {
+		t.Errorf("runServer() output = %q, want the invalid line reported", output)
+	}
+
+	var reported []serverResult
+	for _, line := range strings.Split(output, "\n") {
+		if data, ok := strings.CutPrefix(line, serverResultMarker); ok {
+			var result serverResult
+			if err := json.Unmarshal([]byte(data), &result); err != nil {
+				t.Fatalf("Invalid result line %q: %v", line, err)
+			}
+			reported = append(reported, result)
+		}
+	}
+	if len(reported) != 2 || reported[0].Event != "result" || reported[0].Tag != "first" || !reported[1].Success {
+		t.Errorf("runServer() result lines = %+v, want one successful result per command", reported)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestStubbornCommandIsKilled tests that a command ignoring SIGTERM is still
+// waited for with a bound and can then be killed
+func TestStubbornCommandIsKilled(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	done := make(chan CommandResult)
+	captureStdout(func() {
+		go func() {
+			done <- runCommand(CommandInfo{Command: `trap "" TERM; while true; do sleep 0.1; done`, Tag: "stubborn"}, nil)
+		}()
+
+		for i := 0; i < 100 && countActiveCommands() == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		// Give the shell time to install its trap
+		time.Sleep(100 * time.Millisecond)
+
+		terminateActiveCommands()
+		if waitForCommands(300 * time.Millisecond) {
+			t.Fatal("waitForCommands() = true, want the stubborn command to ignore SIGTERM")
+		}
+
+		killActiveCommands()
+		if !waitForCommands(2 * time.Second) {
+			t.Error("waitForCommands() = false after killing, want all commands to have exited")
+		}
+
+		select {
+		case result := <-done:
+			if result.Success {
+				t.Errorf("runCommand() result = %+v, want a failure for a killed command", result)
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("runCommand() did not return after the command was killed")
+		}
+	})
+}
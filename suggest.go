@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// suggestCommand looks for an executable in PATH whose name is close to the
+// given one and returns it, or an empty string if there is no good match.
+// It scans every PATH directory, so it should only be used after a lookup
+// already failed.
+func suggestCommand(name string) string {
+	if name == "" || strings.ContainsRune(name, os.PathSeparator) {
+		return ""
+	}
+
+	// Allow roughly one typo per three characters, at most two
+	maxDistance := len(name) / 3
+	if maxDistance > 2 {
+		maxDistance = 2
+	}
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	best := ""
+	bestDistance := maxDistance + 1
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			candidate := executableName(entry)
+			if candidate == "" || candidate == name {
+				continue
+			}
+
+			if distance := editDistance(name, candidate); distance < bestDistance {
+				best = candidate
+				bestDistance = distance
+			}
+		}
+	}
+
+	return best
+}
+
+// executableName returns the command name for a PATH entry, or an empty
+// string if the entry is not an executable
+func executableName(entry os.DirEntry) string {
+	if entry.IsDir() {
+		return ""
+	}
+
+	name := entry.Name()
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(name))
+		if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+			return ""
+		}
+		return strings.TrimSuffix(name, filepath.Ext(name))
+	}
+
+	info, err := entry.Info()
+	if err != nil || info.Mode()&0111 == 0 {
+		return ""
+	}
+	return name
+}
+
+// editDistance returns the Levenshtein distance between two strings, with
+// a swap of two adjacent characters counting as a single edit, as that is
+// the most common kind of typo
+func editDistance(a, b string) int {
+	rows := make([][]int, len(a)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(b)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+
+	return rows[len(a)][len(b)]
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestEditDistance tests the edit distance calculation
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"git", "git", 0},
+		{"gti", "git", 1},
+		{"gi", "git", 1},
+		{"gitt", "git", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+		{"dcoker", "docker", 1},
+	}
+
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestSuggestCommand tests suggestions from a controlled PATH
+func TestSuggestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test that creates Unix executables")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"git", "grep", "docker"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not executable, must never be suggested
+	if err := os.WriteFile(filepath.Join(dir, "dockre"), []byte(""), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "gti", want: "git"},
+		{name: "dcoker", want: "docker"},
+		{name: "grpe", want: "grep"},
+		{name: "completely-different", want: ""},
+		{name: "./local-script", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := suggestCommand(tt.name); got != tt.want {
+			t.Errorf("suggestCommand(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+var (
+	// Print a table with the result of every command at the end of the run
+	showSummary bool
+	// Format of the summary: table, json or markdown
+	summaryFormat string
+)
+
+// SummaryEntry is the result of a command in the JSON summary
+type SummaryEntry struct {
+	Tag        string  `json:"tag"`
+	Status     string  `json:"status"`
+	ExitCode   *int    `json:"exit_code"`
+	Duration   float64 `json:"duration_seconds"`
+	Nice       int     `json:"nice,omitempty"`
+	UserTime   float64 `json:"user_seconds"`
+	SystemTime float64 `json:"system_seconds"`
+}
+
+// resultStatus describes the outcome of a command in a word or two
+func resultStatus(result CommandResult) string {
+	switch {
+	case result.Detached:
+		return "detached"
+	case result.Unmet:
+		return "condition unmet"
+	case result.Skipped:
+		return "skipped"
+	case result.Success:
+		return "ok"
+	case result.TimedOut:
+		return "timed out"
+	default:
+		return "failed"
+	}
+}
+
+// formatSummary formats the results of a run with each command's status,
+// exit code, duration, niceness and the CPU time it used, as a table, as
+// JSON or as a Markdown table
+func formatSummary(results []CommandResult, format string) string {
+	switch format {
+	case "json":
+		return formatSummaryJSON(results)
+	case "markdown":
+		return formatSummaryMarkdown(results)
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tSTATUS\tEXIT\tDURATION\tNICE\tUSER\tSYS")
+	for _, result := range results {
+		exit, nice := summaryColumns(result)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", result.Tag, resultStatus(result), exit,
+			formatSeconds(result.Duration.Seconds()), nice,
+			formatSeconds(result.UserTime.Seconds()), formatSeconds(result.SystemTime.Seconds()))
+	}
+	_ = w.Flush()
+	return b.String()
+}
+
+// summaryColumns returns the exit code and niceness of a result as shown in
+// the summary, "-" when there is none
+func summaryColumns(result CommandResult) (exit string, nice string) {
+	exit, nice = "-", "-"
+	if !result.Skipped {
+		exit = strconv.Itoa(result.ExitCode)
+	}
+	if result.Nice != 0 {
+		nice = strconv.Itoa(result.Nice)
+	}
+	return exit, nice
+}
+
+// formatSummaryJSON formats the results of a run as a JSON array. The exit
+// code of commands that never ran is null.
+func formatSummaryJSON(results []CommandResult) string {
+	entries := make([]SummaryEntry, 0, len(results))
+	for _, result := range results {
+		entry := SummaryEntry{
+			Tag:        result.Tag,
+			Status:     resultStatus(result),
+			Duration:   result.Duration.Seconds(),
+			Nice:       result.Nice,
+			UserTime:   result.UserTime.Seconds(),
+			SystemTime: result.SystemTime.Seconds(),
+		}
+		if !result.Skipped {
+			exitCode := result.ExitCode
+			entry.ExitCode = &exitCode
+		}
+		entries = append(entries, entry)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data) + "\n"
+}
+
+// formatSummaryMarkdown formats the results of a run as a Markdown table,
+// ready to be pasted into a pull request or an issue
+func formatSummaryMarkdown(results []CommandResult) string {
+	var b strings.Builder
+	b.WriteString("| Tag | Status | Exit | Duration | Nice | User | Sys |\n")
+	b.WriteString("|-----|--------|-----:|---------:|-----:|-----:|----:|\n")
+	for _, result := range results {
+		exit, nice := summaryColumns(result)
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %s |\n", markdownCell(result.Tag), resultStatus(result), exit,
+			formatSeconds(result.Duration.Seconds()), nice,
+			formatSeconds(result.UserTime.Seconds()), formatSeconds(result.SystemTime.Seconds()))
+	}
+	return b.String()
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(text string) string {
+	return strings.NewReplacer("\\", "\\\\", "|", "\\|", "`", "\\`", "*", "\\*", "_", "\\_").Replace(text)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFormatSummary tests the columns of the summary table
+func TestFormatSummary(t *testing.T) {
+	results := []CommandResult{
+		{Tag: "build", Success: true, Duration: 2 * time.Second, Nice: 10, UserTime: 1500 * time.Millisecond, SystemTime: 250 * time.Millisecond},
+		{Tag: "test", ExitCode: 1, Duration: time.Second},
+		{Tag: "deploy", Skipped: true},
+	}
+
+	lines := strings.Split(strings.TrimSpace(formatSummary(results, "table")), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("formatSummary() = %q, want a header and 3 rows", lines)
+	}
+	want := [][]string{
+		{"TAG", "STATUS", "EXIT", "DURATION", "NICE", "USER", "SYS"},
+		{"build", "ok", "0", "2s", "10", "1.5s", "250ms"},
+		{"test", "failed", "1", "1s", "-", "0s", "0s"},
+		{"deploy", "skipped", "-", "0s", "-", "0s", "0s"},
+	}
+	for i, line := range lines {
+		if got := strings.Fields(line); strings.Join(got, " ") != strings.Join(want[i], " ") {
+			t.Errorf("formatSummary() row %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+// TestFormatSummaryJSON tests the JSON summary
+func TestFormatSummaryJSON(t *testing.T) {
+	results := []CommandResult{
+		{Tag: "build", Success: true, Duration: 2 * time.Second, Nice: 10, UserTime: 1500 * time.Millisecond},
+		{Tag: "deploy", Skipped: true},
+	}
+
+	var entries []SummaryEntry
+	if err := json.Unmarshal([]byte(formatSummary(results, "json")), &entries); err != nil {
+		t.Fatalf("formatSummary() is not valid JSON: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("formatSummary() = %+v, want 2 entries", entries)
+	}
+	if e := entries[0]; e.Tag != "build" || e.Status != "ok" || e.ExitCode == nil || *e.ExitCode != 0 || e.Duration != 2 || e.Nice != 10 || e.UserTime != 1.5 {
+		t.Errorf("formatSummary() entry = %+v, want build ok in 2s", e)
+	}
+	if e := entries[1]; e.Status != "skipped" || e.ExitCode != nil {
+		t.Errorf("formatSummary() entry = %+v, want skipped without an exit code", e)
+	}
+}
+
+// TestFormatSummaryMarkdown tests the Markdown summary
+func TestFormatSummaryMarkdown(t *testing.T) {
+	results := []CommandResult{
+		{Tag: "build", Success: true, Duration: 2 * time.Second},
+		{Tag: "a|b_c", ExitCode: 1, Duration: time.Second},
+		{Tag: "deploy", Skipped: true},
+	}
+
+	want := "| Tag | Status | Exit | Duration | Nice | User | Sys |\n" +
+		"|-----|--------|-----:|---------:|-----:|-----:|----:|\n" +
+		"| build | ok | 0 | 2s | - | 0s | 0s |\n" +
+		"| a\\|b\\_c | failed | 1 | 1s | - | 0s | 0s |\n" +
+		"| deploy | skipped | - | 0s | - | 0s | 0s |\n"
+	if got := formatSummary(results, "markdown"); got != want {
+		t.Errorf("formatSummary() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestCommandNiceness tests that a command runs with the niceness from its tag and reports its CPU time
+func TestCommandNiceness(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+	if !niceSupported {
+		t.Skip("Niceness is not supported on this platform")
+	}
+
+	oldNoColor := noColor
+	noColor = true
+	defer func() { noColor = oldNoColor }()
+
+	cmdInfo := applyTagSpec(CommandInfo{Command: "sleep 0.1; ps -o nice= -p $$", Tag: "low~7"})
+	var result CommandResult
+	output := captureStdout(func() {
+		result = executeCommand(cmdInfo)
+	})
+
+	if !result.Success || result.Nice != 7 {
+		t.Fatalf("executeCommand() = %+v, want success with niceness 7", result)
+	}
+	if !regexp.MustCompile(`\[low:out\] +7\n`).MatchString(output) {
+		t.Errorf("command output = %q, want it to report niceness 7", output)
+	}
+}
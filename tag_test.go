@@ -2,7 +2,9 @@ package main
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 // TestProcessCommandsWithTags tests the processCommands function with various tag formats
@@ -55,6 +57,46 @@ func TestProcessCommandsWithTags(t *testing.T) {
 				{Command: "echo world", Tag: "farewell", Index: 1},
 			},
 		},
+		{
+			name:     "Remote commands",
+			args:     []string{"+web@ssh://deploy@web1:uptime", "df -h"},
+			tagFlags: []string{"db@ssh://db1:pg_isready"},
+			want: []CommandInfo{
+				{Command: "df -h", Tag: "1", Index: 0},
+				{Command: "uptime", Tag: "web", Index: 1, Host: "deploy@web1"},
+				{Command: "pg_isready", Tag: "db", Index: 2, Host: "db1"},
+			},
+		},
+		{
+			name:     "Priorities",
+			args:     []string{"+build!2:make", "+lint!x:make lint", "make docs"},
+			tagFlags: []string{"docs!-1:make docs"},
+			want: []CommandInfo{
+				{Command: "make docs", Tag: "docs", Index: 0, Priority: -1},
+				{Command: "make", Tag: "build", Index: 1, Priority: 2},
+				{Command: "make lint", Tag: "lint!x", Index: 2},
+			},
+		},
+		{
+			name:     "Colors",
+			args:     []string{"+build#green:make", "+lint#Purple:make lint", "+test#mauve:make test"},
+			tagFlags: []string{"docs#blue:make docs"},
+			want: []CommandInfo{
+				{Command: "make", Tag: "build", Index: 0, Color: colorGreen},
+				{Command: "make lint", Tag: "lint", Index: 1, Color: colorPurple},
+				{Command: "make test", Tag: "test#mauve", Index: 2},
+				{Command: "make docs", Tag: "docs", Index: 3, Color: colorBlue},
+			},
+		},
+		{
+			name: "Niceness",
+			args: []string{"+build~10:make", "+lint~-5:make lint", "+test~20:make test"},
+			want: []CommandInfo{
+				{Command: "make", Tag: "build", Index: 0, Nice: 10},
+				{Command: "make lint", Tag: "lint", Index: 1, Nice: -5},
+				{Command: "make test", Tag: "test", Index: 2},
+			},
+		},
 		{
 			name: "Invalid + syntax",
 			args: []string{"+invalid-format", "echo hello"},
@@ -184,3 +226,251 @@ func TestTagPriority(t *testing.T) {
 		}
 	}
 }
+
+// TestProcessCommandsEncoded tests commands passed base64 or percent-encoded
+func TestProcessCommandsEncoded(t *testing.T) {
+	oldBase64 := base64Commands
+	oldPercent := percentEncoded
+	defer func() {
+		base64Commands = oldBase64
+		percentEncoded = oldPercent
+	}()
+
+	tags = []string{}
+
+	// echo "it's \"quoted\"" and +quoted:echo 'a b'
+	base64Commands = []string{"ZWNobyAiaXQncyBcInF1b3RlZFwiIg==", "K3F1b3RlZDplY2hvICdhIGIn"}
+	percentEncoded = false
+
+	got := processCommands([]string{"echo plain"})
+	want := []CommandInfo{
+		{Command: "echo plain", Tag: "1", Index: 0},
+		{Command: `echo "it's \"quoted\""`, Tag: "2", Index: 1},
+		{Command: "echo 'a b'", Tag: "quoted", Index: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with --cmd-b64 = %v, want %v", got, want)
+	}
+
+	base64Commands = nil
+	percentEncoded = true
+
+	got = processCommands([]string{"echo%20%22a%20b%22", "%2Bgreet%3Aecho%20hi"})
+	want = []CommandInfo{
+		{Command: `echo "a b"`, Tag: "1", Index: 0},
+		{Command: "echo hi", Tag: "greet", Index: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with --cmd-enc = %v, want %v", got, want)
+	}
+}
+
+// TestDecodeBase64 tests the accepted base64 variants
+func TestDecodeBase64(t *testing.T) {
+	for _, encoded := range []string{"ZWNobyA/Pz4+", "ZWNobyA_Pz4-", "ZWNobyA/Pz4+\n"} {
+		got, err := decodeBase64(encoded)
+		if err != nil || got != "echo ??>>" {
+			t.Errorf("decodeBase64(%q) = %q, %v, want %q", encoded, got, err, "echo ??>>")
+		}
+	}
+
+	if _, err := decodeBase64("not base64!"); err == nil {
+		t.Error("decodeBase64() expected an error for invalid input")
+	}
+}
+
+// TestNormalizeTags tests that tags are normalized only with --normalize-tags
+func TestNormalizeTags(t *testing.T) {
+	oldNormalize := normalizeTags
+	defer func() { normalizeTags = oldNormalize }()
+
+	args := []string{"+Build Step:make", "+api/Test:go test", "+web\\Lint:npm run lint"}
+
+	normalizeTags = false
+	got := processCommands(args)
+	if got[0].Tag != "Build Step" || got[1].Tag != "api/Test" {
+		t.Errorf("processCommands() without --normalize-tags = %v, want the raw tags", got)
+	}
+
+	normalizeTags = true
+	got = processCommands(args)
+	want := []CommandInfo{
+		{Command: "make", Tag: "build-step", Index: 0},
+		{Command: "go test", Tag: "api-test", Index: 1},
+		{Command: "npm run lint", Tag: "web-lint", Index: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with --normalize-tags = %v, want %v", got, want)
+	}
+}
+
+// TestTagPrefix tests that --tag-prefix is put in front of the tags after normalization
+func TestTagPrefix(t *testing.T) {
+	oldTagPrefix := tagPrefix
+	oldNormalize := normalizeTags
+	tagPrefix = "ci/"
+	normalizeTags = true
+	defer func() {
+		tagPrefix = oldTagPrefix
+		normalizeTags = oldNormalize
+	}()
+
+	got := processCommands([]string{"+Build:make", "go test"})
+	want := []CommandInfo{
+		{Command: "go test", Tag: "ci/1", Index: 0},
+		{Command: "make", Tag: "ci/build", Index: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with --tag-prefix = %v, want %v", got, want)
+	}
+}
+
+// TestTagOptionsWithTagPrefix tests that options refer to tags as written, before --normalize-tags and --tag-prefix
+func TestTagOptionsWithTagPrefix(t *testing.T) {
+	oldTagPrefix, oldNormalize := tagPrefix, normalizeTags
+	oldDetach, oldDelays, oldWeights := detachTags, tagDelays, tagWeights
+	tagPrefix, normalizeTags = "ci/", true
+	defer func() {
+		tagPrefix, normalizeTags = oldTagPrefix, oldNormalize
+		detachTags, tagDelays, tagWeights = oldDetach, oldDelays, oldWeights
+	}()
+
+	detachTags = []string{"Build Step"}
+	tagDelays, _ = parseTagDelays([]string{"Build Step=2s"})
+	tagWeights, _ = parseTagWeights([]string{"build-step=3"})
+	got := processCommands([]string{"+Build Step:make"})
+	if len(got) != 1 || got[0].Tag != "ci/build-step" || !got[0].Detach || got[0].Delay != 2*time.Second || got[0].Weight != 3 {
+		t.Errorf("processCommands() = %+v, want ci/build-step detached with delay 2s and weight 3", got)
+	}
+
+	colors, err := parseTagColors([]string{"Build Step:green"})
+	if err != nil || colors["ci/build-step"] == "" {
+		t.Errorf("parseTagColors() = %v, %v, want the color keyed by ci/build-step", colors, err)
+	}
+	expectations, err := parseExpectations([]string{"Build Step=ok"})
+	if err != nil || len(expectations["ci/build-step"]) != 1 {
+		t.Errorf("parseExpectations() = %v, %v, want the pattern keyed by ci/build-step", expectations, err)
+	}
+}
+
+// TestDropEmptyCommands tests that empty and whitespace-only commands fail or are skipped with --skip-empty
+func TestDropEmptyCommands(t *testing.T) {
+	oldSkipEmpty := skipEmpty
+	defer func() { skipEmpty = oldSkipEmpty }()
+
+	commands := []CommandInfo{
+		{Command: "", Tag: "1", Index: 0},
+		{Command: "echo hello", Tag: "2", Index: 1},
+		{Command: "   ", Tag: "3", Index: 2},
+		{Command: "", Tag: "build", Index: 3},
+	}
+
+	skipEmpty = false
+	if _, err := dropEmptyCommands(commands); err == nil {
+		t.Error("dropEmptyCommands() expected an error for empty commands")
+	}
+	if got, err := dropEmptyCommands(commands[1:2]); err != nil || len(got) != 1 {
+		t.Errorf("dropEmptyCommands() = %v, %v, want the command unchanged", got, err)
+	}
+
+	skipEmpty = true
+	parseWarnings = nil
+	got, err := dropEmptyCommands(commands)
+	want := []CommandInfo{{Command: "echo hello", Tag: "2", Index: 0}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("dropEmptyCommands() with --skip-empty = %v, %v, want %v", got, err, want)
+	}
+	warnings := strings.Join(parseWarnings, "\n")
+	for _, tag := range []string{"'1'", "'3'", "'build'"} {
+		if !strings.Contains(warnings, "Skipping empty command for tag "+tag) {
+			t.Errorf("dropEmptyCommands() warnings = %q, want a warning for tag %s", warnings, tag)
+		}
+	}
+	parseWarnings = nil
+
+	captureStdout(func() {
+		got = processCommands([]string{"", "+build:", "+lint:  ", "echo hello"})
+	})
+	want = []CommandInfo{{Command: "echo hello", Tag: "2", Index: 0}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with --skip-empty = %v, want %v", got, want)
+	}
+}
+
+// TestDedupeCommands tests that --dedupe-commands runs each command string once, preferring explicit tags
+func TestDedupeCommands(t *testing.T) {
+	oldDedupeCommands, oldTags, oldNoColor := dedupeCommands, tags, noColor
+	defer func() { dedupeCommands, tags, noColor = oldDedupeCommands, oldTags, oldNoColor }()
+
+	dedupeCommands, tags, noColor = true, []string{}, true
+	var got []CommandInfo
+	output := captureStdout(func() {
+		got = processCommands([]string{"make lint", "make test", "make lint", "+unit:make test", "make docs", "+unit2:make test"})
+	})
+
+	want := []CommandInfo{
+		{Command: "make lint", Tag: "1", Index: 0},
+		{Command: "make test", Tag: "unit", Index: 1},
+		{Command: "make docs", Tag: "4", Index: 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with --dedupe-commands = %v, want %v", got, want)
+	}
+	if !strings.Contains(output, "Removed 2 duplicate commands") {
+		t.Errorf("processCommands() output = %q, want the removed commands counted", output)
+	}
+
+	// The same command on another host is not a duplicate
+	kept, removed := removeDuplicateCommands([]CommandInfo{
+		{Command: "uptime", Tag: "a"},
+		{Command: "uptime", Tag: "b", Host: "web1"},
+	})
+	if removed != 0 || len(kept) != 2 {
+		t.Errorf("removeDuplicateCommands() = %v, %d, want both commands kept", kept, removed)
+	}
+}
+
+// TestTagFromRegex tests deriving the tags of untagged commands from --tag-from-regex
+func TestTagFromRegex(t *testing.T) {
+	oldTagPattern, oldTags := tagPattern, tags
+	defer func() { tagPattern, tags = oldTagPattern, oldTags }()
+
+	var err error
+	tagPattern, err = parseTagRegex(`services/(\w+)`)
+	if err != nil {
+		t.Fatalf("parseTagRegex() error = %v", err)
+	}
+	tags = []string{}
+
+	got := processCommands([]string{
+		"cd services/api && go build",
+		"make docs",
+		"cd services/web && npm run build",
+		"+worker:cd services/queue && go build",
+	})
+	want := []CommandInfo{
+		{Command: "cd services/api && go build", Tag: "api", Index: 0},
+		{Command: "make docs", Tag: "2", Index: 1},
+		{Command: "cd services/web && npm run build", Tag: "web", Index: 2},
+		{Command: "cd services/queue && go build", Tag: "worker", Index: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("processCommands() with --tag-from-regex = %v, want %v", got, want)
+	}
+
+	// Without a group, the whole match is the tag
+	tagPattern, _ = parseTagRegex(`[a-z]+\.sh`)
+	if tag, ok := tagFromCommand("./scripts/deploy.sh --dry-run"); !ok || tag != "deploy.sh" {
+		t.Errorf("tagFromCommand() = %q, %v, want deploy.sh", tag, ok)
+	}
+
+	// An empty group falls back to the index
+	tagPattern, _ = parseTagRegex(`services/(\w*)`)
+	if tag, ok := tagFromCommand("ls services/"); ok {
+		t.Errorf("tagFromCommand() = %q, want no tag for an empty group", tag)
+	}
+
+	if _, err := parseTagRegex(`services/(`); err == nil {
+		t.Error("parseTagRegex() expected an error for an invalid expression")
+	}
+}
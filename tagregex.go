@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// Regular expression deriving the tags of untagged commands from their
+	// command strings (--tag-from-regex)
+	tagFromRegex string
+	// Compiled --tag-from-regex, nil if not given
+	tagPattern *regexp.Regexp
+)
+
+// parseTagRegex compiles --tag-from-regex
+func parseTagRegex(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --tag-from-regex '%s': %w", expr, err)
+	}
+	return pattern, nil
+}
+
+// tagFromCommand derives a tag from the first match of --tag-from-regex in
+// a command: the first capture group, or the whole match if the expression
+// has no groups. It reports false if the expression does not match or the
+// tag would be empty.
+func tagFromCommand(command string) (string, bool) {
+	if tagPattern == nil {
+		return "", false
+	}
+	match := tagPattern.FindStringSubmatch(command)
+	if match == nil {
+		return "", false
+	}
+	tag := match[0]
+	if len(match) > 1 {
+		tag = match[1]
+	}
+	return tag, tag != ""
+}
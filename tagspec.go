@@ -0,0 +1,151 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// tagModifierMarkers are the characters that start a modifier after a tag
+// name, as in +build!2:make, +build#green:make, +build~10:make, +server&:make,
+// +deploy?success:make, +web@delay=3s:make, +compile@weight=4:make,
+// +legacy@encoding=cp1252:tool.exe, +build@timeout=5m:make or
+// +web@dir=frontend:npm test
+const tagModifierMarkers = "!#~&?@"
+
+// tagModifier is a single modifier following a tag name
+type tagModifier struct {
+	marker byte
+	value  string
+}
+
+// parseTagSpec splits a tag such as "build!2#green" into the tag name and the
+// modifiers following it
+func parseTagSpec(spec string) (string, []tagModifier) {
+	starts := modifierStarts(spec)
+	if len(starts) == 0 {
+		return spec, nil
+	}
+
+	name := spec[:starts[0]]
+	var modifiers []tagModifier
+	for i, start := range starts {
+		end := len(spec)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		modifiers = append(modifiers, tagModifier{marker: spec[start], value: spec[start+1 : end]})
+	}
+	return name, modifiers
+}
+
+// modifierStarts returns the positions of the markers in a tag that start a
+// modifier. Any other marker is kept in the tag name or the value before it.
+func modifierStarts(spec string) []int {
+	var starts []int
+	for i := 0; i < len(spec); i++ {
+		if strings.IndexByte(tagModifierMarkers, spec[i]) >= 0 && startsModifier(spec[i], spec[i+1:]) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// startsModifier reports whether a marker followed by rest starts a
+// modifier, so tags such as wow!, a&b or issue#12 keep their markers. ! and
+// ~ need a number, # a color name, & must end the tag or be followed by
+// another modifier, and ? must be followed by a condition.
+func startsModifier(marker byte, rest string) bool {
+	switch marker {
+	case '!', '~':
+		return startsWithNumber(rest)
+	case '#':
+		return startsWithColorName(rest)
+	case '&':
+		return rest == "" || strings.IndexByte(tagModifierMarkers, rest[0]) >= 0 && startsModifier(rest[0], rest[1:])
+	case '?':
+		return strings.HasPrefix(rest, "success") || strings.HasPrefix(rest, "failure")
+	case '@':
+		return isTagSetting(rest)
+	}
+	return false
+}
+
+// startsWithColorName reports whether text starts with one of colorNames,
+// in any case
+func startsWithColorName(text string) bool {
+	for name := range colorNames {
+		if len(text) >= len(name) && strings.EqualFold(text[:len(name)], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// startsWithNumber reports whether text starts with an optionally signed
+// integer
+func startsWithNumber(text string) bool {
+	if text != "" && (text[0] == '-' || text[0] == '+') {
+		text = text[1:]
+	}
+	return text != "" && text[0] >= '0' && text[0] <= '9'
+}
+
+// applyTagSpec moves the modifiers and {N>FILE} redirects of a command's
+// tag into the command. Invalid modifiers are reported and ignored.
+func applyTagSpec(cmdInfo CommandInfo) CommandInfo {
+	tag, redirects, err := splitRedirects(cmdInfo.Tag)
+	if err != nil {
+		warn("Ignoring redirects of tag '%s', %v", tag, err)
+	}
+	cmdInfo.Tag, cmdInfo.Redirects = tag, redirects
+
+	name, modifiers := parseTagSpec(cmdInfo.Tag)
+	if len(modifiers) == 0 {
+		return cmdInfo
+	}
+
+	cmdInfo.Tag = name
+	for _, modifier := range modifiers {
+		switch modifier.marker {
+		case '!':
+			priority, err := strconv.Atoi(modifier.value)
+			if err != nil {
+				warn("Invalid priority '%s' for tag '%s', expected a number", modifier.value, name)
+				continue
+			}
+			cmdInfo.Priority = priority
+		case '#':
+			color, ok := colorNames[strings.ToLower(modifier.value)]
+			if !ok {
+				warn("Unknown color '%s' for tag '%s'", modifier.value, name)
+				continue
+			}
+			cmdInfo.Color = color
+		case '~':
+			nice, err := strconv.Atoi(modifier.value)
+			if err != nil || nice < -20 || nice > 19 {
+				warn("Invalid niceness '%s' for tag '%s', expected a number from -20 to 19", modifier.value, name)
+				continue
+			}
+			cmdInfo.Nice = nice
+		case '&':
+			if modifier.value != "" {
+				warn("Unexpected value '%s' after & for tag '%s'", modifier.value, name)
+				continue
+			}
+			cmdInfo.Detach = true
+		case '?':
+			condition, tag, err := parseCondition(modifier.value)
+			if err != nil {
+				warn("Invalid condition '%s' for tag '%s', %v", modifier.value, name, err)
+				continue
+			}
+			cmdInfo.RunIf, cmdInfo.RunIfTag = condition, tag
+		case '@':
+			if err := applyTagSetting(&cmdInfo, modifier.value); err != nil {
+				warn("Invalid setting '%s' for tag '%s', %v", modifier.value, name, err)
+			}
+		}
+	}
+	return cmdInfo
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+// TestParseTagSpec tests splitting tags into a name and modifiers
+func TestParseTagSpec(t *testing.T) {
+	tests := []struct {
+		spec          string
+		wantName      string
+		wantModifiers []tagModifier
+	}{
+		{spec: "build", wantName: "build"},
+		{spec: "build!2", wantName: "build", wantModifiers: []tagModifier{{'!', "2"}}},
+		{spec: "build!", wantName: "build!"},
+		{spec: "wow!", wantName: "wow!"},
+		{spec: "a&b", wantName: "a&b"},
+		{spec: "what?", wantName: "what?"},
+		{spec: "x~y", wantName: "x~y"},
+		{spec: "deploy?success", wantName: "deploy", wantModifiers: []tagModifier{{'?', "success"}}},
+		{spec: "server&", wantName: "server", wantModifiers: []tagModifier{{'&', ""}}},
+		{spec: "!3", wantName: "", wantModifiers: []tagModifier{{'!', "3"}}},
+		{spec: "a!1!2", wantName: "a", wantModifiers: []tagModifier{{'!', "1"}, {'!', "2"}}},
+		{spec: "build#green!1", wantName: "build", wantModifiers: []tagModifier{{'#', "green"}, {'!', "1"}}},
+		{spec: "issue#12", wantName: "issue#12"},
+		{spec: "issue#12#red", wantName: "issue#12", wantModifiers: []tagModifier{{'#', "red"}}},
+		{spec: "issue#abc", wantName: "issue#abc"},
+		{spec: "build#Green", wantName: "build", wantModifiers: []tagModifier{{'#', "Green"}}},
+		{spec: "build!1#2", wantName: "build", wantModifiers: []tagModifier{{'!', "1#2"}}},
+		{spec: "me@host", wantName: "me@host"},
+		{spec: "me@host@delay=1s", wantName: "me@host", wantModifiers: []tagModifier{{'@', "delay=1s"}}},
+		{spec: "web@dir=a@b!1", wantName: "web", wantModifiers: []tagModifier{{'@', "dir=a@b"}, {'!', "1"}}},
+		{spec: "build~-5", wantName: "build", wantModifiers: []tagModifier{{'~', "-5"}}},
+		{spec: "server&!1", wantName: "server", wantModifiers: []tagModifier{{'&', ""}, {'!', "1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			name, modifiers := parseTagSpec(tt.spec)
+			if name != tt.wantName || !reflect.DeepEqual(modifiers, tt.wantModifiers) {
+				t.Errorf("parseTagSpec(%q) = (%q, %v), want (%q, %v)", tt.spec, name, modifiers, tt.wantName, tt.wantModifiers)
+			}
+		})
+	}
+}
+
+// TestRunParallelPriority tests that commands with a higher priority are launched first
+func TestRunParallelPriority(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldMaxParallel := maxParallel
+	oldNoColor := noColor
+	maxParallel = 1
+	noColor = true
+	defer func() {
+		maxParallel = oldMaxParallel
+		noColor = oldNoColor
+	}()
+
+	commands := []CommandInfo{
+		{Command: "echo low", Tag: "low", Index: 0},
+		{Command: "echo high", Tag: "high", Index: 1, Priority: 5},
+		{Command: "echo mid", Tag: "mid", Index: 2, Priority: 1},
+		{Command: "echo low2", Tag: "low2", Index: 3},
+	}
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runParallel(commands)
+	})
+
+	for i, tag := range []string{"low", "high", "mid", "low2"} {
+		if results[i].Tag != tag {
+			t.Errorf("results[%d].Tag = %q, want %q", i, results[i].Tag, tag)
+		}
+	}
+
+	var launches []string
+	for _, match := range regexp.MustCompile(`\[(\w+)\] Executing`).FindAllStringSubmatch(output, -1) {
+		launches = append(launches, match[1])
+	}
+	if want := []string{"high", "mid", "low", "low2"}; !reflect.DeepEqual(launches, want) {
+		t.Errorf("launch order = %v, want %v", launches, want)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TaskFile is a set of commands read with "rufl run FILE"
+type TaskFile struct {
+	Mode    string `json:"mode"`
+	Timeout string `json:"timeout"`
+	Tasks   []Task `json:"tasks"`
+}
+
+// Task is a single command in a task file
+type Task struct {
+	Tag     string `json:"tag"`
+	Command string `json:"command"`
+}
+
+// readTaskFile reads and validates a task file. Unknown fields are an
+// error, and all problems with the tasks are reported at once.
+func readTaskFile(path string) (*TaskFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var taskFile TaskFile
+	if err := decoder.Decode(&taskFile); err != nil {
+		return nil, fmt.Errorf("%s:%d: %s", path, lineAt(data, decodeErrorOffset(data, err)), strings.TrimPrefix(err.Error(), "json: "))
+	}
+	// A second object or leftovers of a merge after the task file would
+	// otherwise be ignored
+	if rest := bytes.TrimLeft(data[decoder.InputOffset():], " \t\r\n"); len(rest) > 0 {
+		return nil, fmt.Errorf("%s:%d: unexpected content after the task file", path, lineAt(data, int64(len(data)-len(rest))))
+	}
+
+	if problems := validateTaskFile(&taskFile); len(problems) > 0 {
+		return nil, fmt.Errorf("invalid task file %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return &taskFile, nil
+}
+
+// unknownFieldPattern matches the error for a field that is not part of a task file
+var unknownFieldPattern = regexp.MustCompile(`unknown field (".*")`)
+
+// decodeErrorOffset returns where in the input decoding failed. The error
+// for an unknown field has no offset, so the field is looked up instead.
+func decodeErrorOffset(data []byte, err error) int64 {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Offset
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return typeErr.Offset
+	}
+	if match := unknownFieldPattern.FindStringSubmatch(err.Error()); match != nil {
+		fieldKey := regexp.MustCompile(regexp.QuoteMeta(match[1]) + `\s*:`)
+		if loc := fieldKey.FindIndex(data); loc != nil {
+			return int64(loc[0])
+		}
+	}
+	return int64(len(data))
+}
+
+// lineAt returns the 1-based line of the byte at offset in data
+func lineAt(data []byte, offset int64) int {
+	offset = min(max(offset, 0), int64(len(data)))
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// validateTaskFile checks the values of a decoded task file and returns a
+// problem for every field that is wrong
+func validateTaskFile(taskFile *TaskFile) []string {
+	var problems []string
+
+	switch taskFile.Mode {
+	case "", "parallel", "sequential":
+	default:
+		problems = append(problems, fmt.Sprintf("mode: unknown mode '%s', expected parallel or sequential", taskFile.Mode))
+	}
+
+	if taskFile.Timeout != "" {
+		if timeout, err := time.ParseDuration(taskFile.Timeout); err != nil || timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("timeout: invalid duration '%s', expected for example 30s or 10m", taskFile.Timeout))
+		}
+	}
+
+	if len(taskFile.Tasks) == 0 {
+		problems = append(problems, "tasks: no tasks defined")
+	}
+
+	seen := make(map[string]bool)
+	for i, task := range taskFile.Tasks {
+		if strings.TrimSpace(task.Command) == "" {
+			problems = append(problems, fmt.Sprintf("tasks[%d].command: missing command", i))
+		}
+		if strings.Contains(task.Tag, ":") {
+			problems = append(problems, fmt.Sprintf("tasks[%d].tag: tag '%s' must not contain ':'", i, task.Tag))
+		}
+		if task.Tag != "" && seen[task.Tag] {
+			problems = append(problems, fmt.Sprintf("tasks[%d].tag: duplicate tag '%s'", i, task.Tag))
+		}
+		seen[task.Tag] = true
+	}
+	return problems
+}
+
+// taskArgs turns the tasks into +tag:command arguments, so they are
+// processed like commands given on the command line. Tasks without a tag
+// are tagged with their position.
+func taskArgs(taskFile *TaskFile) []string {
+	args := make([]string, len(taskFile.Tasks))
+	for i, task := range taskFile.Tasks {
+		tag := task.Tag
+		if tag == "" {
+			tag = strconv.Itoa(i + 1)
+		}
+		args[i] = "+" + tag + ":" + task.Command
+	}
+	return args
+}
+
+// runTaskFile runs the tasks of a task file in the file's mode. A timeout
+// from the file applies unless --timeout was given.
+func runTaskFile(path string, args []string) error {
+	taskFile, err := readTaskFile(path)
+	if err != nil {
+		return err
+	}
+
+	if taskFile.Timeout != "" && commandTimeout == 0 {
+		commandTimeout, _ = time.ParseDuration(taskFile.Timeout)
+	}
+
+	parallel := taskFile.Mode != "sequential"
+	commands := processCommands(taskArgs(taskFile))
+	started := time.Now()
+	results := runCommands(commands, parallel)
+	recordHistory(args, parallel, commands, started, results)
+	exitOnFailedExpectations(results)
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTaskFile writes content to a task file in a temporary directory
+func writeTaskFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestReadTaskFile tests reading a valid task file
+func TestReadTaskFile(t *testing.T) {
+	path := writeTaskFile(t, `{
+  "mode": "sequential",
+  "timeout": "10m",
+  "tasks": [
+    {"tag": "build", "command": "make build"},
+    {"command": "make test"}
+  ]
+}`)
+
+	taskFile, err := readTaskFile(path)
+	if err != nil {
+		t.Fatalf("readTaskFile() error = %v", err)
+	}
+	if taskFile.Mode != "sequential" || taskFile.Timeout != "10m" || len(taskFile.Tasks) != 2 {
+		t.Errorf("readTaskFile() = %+v, want the mode, timeout and both tasks", taskFile)
+	}
+
+	want := []string{"+build:make build", "+2:make test"}
+	if got := taskArgs(taskFile); !reflect.DeepEqual(got, want) {
+		t.Errorf("taskArgs() = %q, want %q", got, want)
+	}
+}
+
+// TestReadTaskFileUnknownField tests that an unknown field is reported with its line
+func TestReadTaskFileUnknownField(t *testing.T) {
+	path := writeTaskFile(t, `{
+  "tasks": [
+    {"tag": "build", "comand": "make build"}
+  ]
+}`)
+
+	_, err := readTaskFile(path)
+	if err == nil || !strings.Contains(err.Error(), "tasks.json:3:") || !strings.Contains(err.Error(), `unknown field "comand"`) {
+		t.Errorf("readTaskFile() error = %v, want the unknown field on line 3", err)
+	}
+}
+
+// TestReadTaskFileSyntaxError tests that a syntax error is reported with its line
+func TestReadTaskFileSyntaxError(t *testing.T) {
+	path := writeTaskFile(t, "{\n  \"mode\": \"parallel\",\n  \"tasks\": [,]\n}")
+
+	_, err := readTaskFile(path)
+	if err == nil || !strings.Contains(err.Error(), "tasks.json:3:") {
+		t.Errorf("readTaskFile() error = %v, want the syntax error on line 3", err)
+	}
+}
+
+// TestReadTaskFileTrailingContent tests that content after the task file is
+// reported with its line
+func TestReadTaskFileTrailingContent(t *testing.T) {
+	for _, content := range []string{
+		"{\"tasks\": [{\"command\": \"make\"}]}\n\n{\"tasks\": []}\n",
+		"{\"tasks\": [{\"command\": \"make\"}]}\n\n>>>>>>> main\n",
+	} {
+		path := writeTaskFile(t, content)
+		_, err := readTaskFile(path)
+		if err == nil || !strings.Contains(err.Error(), "tasks.json:3: unexpected content after the task file") {
+			t.Errorf("readTaskFile(%q) error = %v, want the trailing content on line 3", content, err)
+		}
+	}
+
+	// Trailing whitespace is fine
+	if _, err := readTaskFile(writeTaskFile(t, "{\"tasks\": [{\"command\": \"make\"}]}\n\n")); err != nil {
+		t.Errorf("readTaskFile() error = %v, want none for trailing whitespace", err)
+	}
+}
+
+// TestValidateTaskFile tests that all problems with a task file are reported together
+func TestValidateTaskFile(t *testing.T) {
+	path := writeTaskFile(t, `{
+  "mode": "both",
+  "timeout": "5 minutes",
+  "tasks": [
+    {"tag": "build", "command": "make"},
+    {"tag": "build", "command": "  "},
+    {"tag": "a:b", "command": "true"}
+  ]
+}`)
+
+	_, err := readTaskFile(path)
+	if err == nil {
+		t.Fatal("readTaskFile() error = nil, want the problems reported")
+	}
+	for _, want := range []string{
+		"mode: unknown mode 'both'",
+		"timeout: invalid duration '5 minutes'",
+		"tasks[1].command: missing command",
+		"tasks[1].tag: duplicate tag 'build'",
+		"tasks[2].tag: tag 'a:b' must not contain ':'",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("readTaskFile() error = %v, want to contain %q", err, want)
+		}
+	}
+
+	if problems := validateTaskFile(&TaskFile{}); !reflect.DeepEqual(problems, []string{"tasks: no tasks defined"}) {
+		t.Errorf("validateTaskFile() of an empty file = %q, want a missing tasks problem", problems)
+	}
+}
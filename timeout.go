@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	// How long a command may run before it is stopped, 0 for no limit
+	commandTimeout time.Duration
+	// How long a command may go without output before it is stopped, 0 for no limit
+	idleTimeout time.Duration
+	// How long a timed out command has to exit after SIGTERM before it is killed
+	timeoutKillGrace time.Duration
+	// Idle watchdogs of the running commands, started over on resume
+	idleWatchdogs sync.Map
+)
+
+// parseTimeout parses the timeout of a single command, such as 5m
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("expected a positive duration such as 5m")
+	}
+	return timeout, nil
+}
+
+// watchdog stops a command once its time is up: the command is asked to
+// terminate first and killed if it is still running after
+// --timeout-kill-grace, so it gets a chance to clean up
+type watchdog struct {
+	tag     string
+	cmd     *exec.Cmd
+	limit   time.Duration
+	message string // Printed when the time is up, e.g. "Timed out after 10s"
+	idle    bool   // Waits for output, which paused commands cannot print
+
+	mutex     sync.Mutex
+	timer     *time.Timer
+	killTimer *time.Timer
+	fired     bool
+	stopped   bool
+}
+
+// startWatchdog starts watching a command, printing message when limit has passed
+func startWatchdog(tag string, cmd *exec.Cmd, limit time.Duration, message string) *watchdog {
+	w := &watchdog{tag: tag, cmd: cmd, limit: limit, message: message}
+	w.start()
+	return w
+}
+
+// startIdleWatchdog starts watching a command that must print output at
+// least every limit. The time does not run out while commands are paused.
+func startIdleWatchdog(tag string, cmd *exec.Cmd, limit time.Duration, message string) *watchdog {
+	w := &watchdog{tag: tag, cmd: cmd, limit: limit, message: message, idle: true}
+	idleWatchdogs.Store(w, true)
+	w.start()
+	return w
+}
+
+// start starts the time limit
+func (w *watchdog) start() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.timer = time.AfterFunc(w.limit, w.expire)
+}
+
+// resetIdleWatchdogs starts the idle time of every running command over,
+// once the commands are resumed after a pause
+func resetIdleWatchdogs() {
+	idleWatchdogs.Range(func(key, value interface{}) bool {
+		key.(*watchdog).reset()
+		return true
+	})
+}
+
+// expire stops the command and arms the kill timer
+func (w *watchdog) expire() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stopped || w.fired {
+		return
+	}
+	if w.idle && paused.Load() {
+		w.timer.Reset(w.limit)
+		return
+	}
+	w.fired = true
+
+	printCommandMessage(w.tag, fmt.Sprintf("%s, stopping it", w.message), colorRed)
+	terminateCommand(w.cmd)
+	w.killTimer = time.AfterFunc(timeoutKillGrace, func() {
+		printCommandMessage(w.tag, fmt.Sprintf("Still running %v after the timeout, killing it", timeoutKillGrace), colorRed)
+		_ = signalCommand(w.cmd.Process, os.Kill)
+	})
+}
+
+// reset starts the time limit over, unless it has already run out
+func (w *watchdog) reset() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.fired && !w.stopped {
+		w.timer.Reset(w.limit)
+	}
+}
+
+// stop stops watching the command
+func (w *watchdog) stop() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.stopped = true
+	w.timer.Stop()
+	idleWatchdogs.Delete(w)
+	if w.killTimer != nil {
+		w.killTimer.Stop()
+	}
+}
+
+// timedOut reports whether the command ran out of time
+func (w *watchdog) timedOut() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.fired
+}
+
+// activityReader calls onRead whenever output is read from the wrapped reader
+type activityReader struct {
+	r      io.Reader
+	onRead func()
+}
+
+func (a activityReader) Read(p []byte) (int, error) {
+	n, err := a.r.Read(p)
+	if n > 0 {
+		a.onRead()
+	}
+	return n, err
+}
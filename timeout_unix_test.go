@@ -0,0 +1,182 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCommandTimeout tests that a command running too long is stopped and reported as timed out
+func TestCommandTimeout(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldTimeout, oldGrace := commandTimeout, timeoutKillGrace
+	commandTimeout, timeoutKillGrace = 100*time.Millisecond, 5*time.Second
+	defer func() { commandTimeout, timeoutKillGrace = oldTimeout, oldGrace }()
+
+	var result CommandResult
+	started := time.Now()
+	output := captureStdout(func() {
+		result = runCommand(CommandInfo{Command: "sleep 10", Tag: "slow"}, nil)
+	})
+
+	if !result.TimedOut || result.Success {
+		t.Errorf("runCommand() result = %+v, want a timed out failure", result)
+	}
+	if elapsed := time.Since(started); elapsed > 2*time.Second {
+		t.Errorf("runCommand() took %v, want SIGTERM to stop the command right away", elapsed)
+	}
+	if !strings.Contains(output, "[slow] Timed out after 100ms") || strings.Contains(output, "killing it") {
+		t.Errorf("runCommand() output = %q, want a timeout without a kill", output)
+	}
+}
+
+// TestCommandTimeoutKill tests that a command ignoring SIGTERM is killed after the grace period
+func TestCommandTimeoutKill(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldTimeout, oldGrace := commandTimeout, timeoutKillGrace
+	commandTimeout, timeoutKillGrace = 200*time.Millisecond, 200*time.Millisecond
+	defer func() { commandTimeout, timeoutKillGrace = oldTimeout, oldGrace }()
+
+	var result CommandResult
+	output := captureStdout(func() {
+		result = runCommand(CommandInfo{Command: `trap "" TERM; while true; do sleep 0.1; done`, Tag: "stubborn"}, nil)
+	})
+
+	if !result.TimedOut || result.Success {
+		t.Errorf("runCommand() result = %+v, want a timed out failure", result)
+	}
+	if !strings.Contains(output, "[stubborn] Still running 200ms after the timeout, killing it") {
+		t.Errorf("runCommand() output = %q, want the command killed after the grace period", output)
+	}
+}
+
+// TestCommandTagTimeout tests that a command's own timeout replaces --timeout for that command only
+func TestCommandTagTimeout(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldTimeout, oldGrace := commandTimeout, timeoutKillGrace
+	commandTimeout, timeoutKillGrace = 5*time.Second, 5*time.Second
+	defer func() { commandTimeout, timeoutKillGrace = oldTimeout, oldGrace }()
+
+	var results []CommandResult
+	output := captureStdout(func() {
+		results = runParallel([]CommandInfo{
+			{Command: "sleep 10", Tag: "slow", Index: 0, Timeout: 100 * time.Millisecond},
+			{Command: "sleep 0.5", Tag: "steady", Index: 1},
+		})
+	})
+
+	if !results[0].TimedOut || results[0].Success {
+		t.Errorf("slow result = %+v, want a timed out failure", results[0])
+	}
+	if results[1].TimedOut || !results[1].Success {
+		t.Errorf("steady result = %+v, want a success under --timeout", results[1])
+	}
+	if !strings.Contains(output, "[slow] Timed out after 100ms") || strings.Contains(output, "[steady] Timed out") {
+		t.Errorf("runParallel() output = %q, want only slow to time out", output)
+	}
+}
+
+// TestCommandWithinTimeout tests that a command finishing in time is not affected
+func TestCommandWithinTimeout(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldTimeout := commandTimeout
+	commandTimeout = 5 * time.Second
+	defer func() { commandTimeout = oldTimeout }()
+
+	var result CommandResult
+	captureStdout(func() {
+		result = runCommand(CommandInfo{Command: "echo quick", Tag: "quick"}, nil)
+	})
+	if result.TimedOut || !result.Success {
+		t.Errorf("runCommand() result = %+v, want a success", result)
+	}
+}
+
+// TestIdleTimeout tests that only a command going quiet for too long is stopped
+func TestIdleTimeout(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldIdle, oldGrace := idleTimeout, timeoutKillGrace
+	idleTimeout, timeoutKillGrace = 300*time.Millisecond, 5*time.Second
+	defer func() { idleTimeout, timeoutKillGrace = oldIdle, oldGrace }()
+
+	var busy, quiet CommandResult
+	output := captureStdout(func() {
+		busy = runCommand(CommandInfo{Command: "for i in 1 2 3 4 5 6; do echo $i; sleep 0.1; done", Tag: "busy"}, nil)
+		quiet = runCommand(CommandInfo{Command: "echo start; exec sleep 10", Tag: "quiet"}, nil)
+	})
+
+	if busy.TimedOut || !busy.Success {
+		t.Errorf("runCommand() result = %+v, want a command printing regularly to succeed", busy)
+	}
+	if !quiet.TimedOut || quiet.Success {
+		t.Errorf("runCommand() result = %+v, want a quiet command to time out", quiet)
+	}
+	if !strings.Contains(output, "[quiet] No output for 300ms, stopping it") {
+		t.Errorf("runCommand() output = %q, want the idle timeout reported", output)
+	}
+}
+
+// TestIdleTimeoutPaused tests that the idle time does not run out while the
+// commands are paused, and starts over when they are resumed
+func TestIdleTimeoutPaused(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldGrace, oldNoColor := timeoutKillGrace, noColor
+	timeoutKillGrace, noColor = 5*time.Second, true
+	defer func() { timeoutKillGrace, noColor = oldGrace, oldNoColor }()
+
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start command: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	paused.Store(true)
+	defer paused.Store(false)
+	var idle *watchdog
+	captureStdout(func() {
+		idle = startIdleWatchdog("paused", cmd, 100*time.Millisecond, "No output for 100ms")
+		defer idle.stop()
+
+		time.Sleep(300 * time.Millisecond)
+		if idle.timedOut() {
+			t.Error("idle watchdog ran out while the commands were paused")
+		}
+
+		paused.Store(false)
+		resetIdleWatchdogs()
+		time.Sleep(50 * time.Millisecond)
+		if idle.timedOut() {
+			t.Error("idle watchdog ran out right after resuming, want the time started over")
+		}
+		time.Sleep(200 * time.Millisecond)
+		if !idle.timedOut() {
+			t.Error("idle watchdog did not run out after resuming")
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// Cleanup command run when rufl exits for any reason (--trap-exit)
+	trapExit string
+	// Set once commands started running, so the cleanup command has something to clean up
+	trapArmed atomic.Bool
+	// Makes sure the cleanup command runs only once
+	trapOnce sync.Once
+)
+
+// armTrapExit makes rufl run the --trap-exit command when it exits
+func armTrapExit() {
+	if trapExit != "" {
+		trapArmed.Store(true)
+	}
+}
+
+// runTrapExit runs the --trap-exit command, at most once per rufl process.
+// It is called both when the commands finished and from every exit path, so
+// it waits for a cleanup that is already running instead of starting another.
+func runTrapExit() {
+	if !trapArmed.Load() {
+		return
+	}
+
+	trapOnce.Do(func() {
+		printColoredMessage("Running exit trap: "+commandSummary(trapExit), colorBlue)
+		runCommand(CommandInfo{Command: trapExit, Tag: "trap-exit"}, nil)
+	})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestTrapExit tests that the exit trap runs exactly once after the commands
+func TestTrapExit(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldTrapExit := trapExit
+	oldNoColor := noColor
+	trapExit = "echo cleanup"
+	noColor = true
+	trapOnce = sync.Once{}
+	defer func() {
+		trapExit = oldTrapExit
+		noColor = oldNoColor
+		trapArmed.Store(false)
+		trapOnce = sync.Once{}
+	}()
+
+	output := captureStdout(func() {
+		runCommands([]CommandInfo{{Command: "echo work", Tag: "1"}}, false)
+		runTrapExit()
+	})
+
+	if got := strings.Count(output, "[trap-exit:out] cleanup"); got != 1 {
+		t.Errorf("exit trap ran %d times, want once; output = %q", got, output)
+	}
+	if strings.Index(output, "[1:out] work") > strings.Index(output, "cleanup") {
+		t.Errorf("exit trap ran before the commands; output = %q", output)
+	}
+}
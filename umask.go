@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Raw value of the --umask flag, empty to keep the inherited umask
+var umaskFlag string
+
+// parseUmask parses an octal file creation mask such as "022"
+func parseUmask(value string) (int, error) {
+	mask, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mask > 0777 {
+		return 0, fmt.Errorf("invalid umask '%s', expected an octal value like 022", value)
+	}
+	return int(mask), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+// TestParseUmask tests parsing of octal file creation masks
+func TestParseUmask(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{value: "022", want: 0o22},
+		{value: "0077", want: 0o77},
+		{value: "0", want: 0},
+		{value: "777", want: 0o777},
+		{value: "1000", wantErr: true},
+		{value: "089", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseUmask(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUmask(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("parseUmask(%q) = %o, want %o", tt.value, got, tt.want)
+			}
+		})
+	}
+}
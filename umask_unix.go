@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import "syscall"
+
+// setUmask sets the file creation mask of rufl, which the commands it
+// starts inherit
+func setUmask(mask int) {
+	syscall.Umask(mask)
+}
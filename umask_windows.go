@@ -0,0 +1,7 @@
+//go:build windows
+// +build windows
+
+package main
+
+// setUmask is a no-op on Windows, which has no file creation mask
+func setUmask(mask int) {}
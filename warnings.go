@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+var (
+	// Treat warnings about the command line as errors
+	strict bool
+	// Warnings collected while parsing the commands, printed by reportWarnings
+	parseWarnings []string
+)
+
+// warn records a warning about the command line, such as an invalid tag
+// modifier. Warnings are collected instead of printed right away, so they
+// are reported together and do not mix with command output.
+func warn(format string, args ...any) {
+	parseWarnings = append(parseWarnings, fmt.Sprintf(format, args...))
+}
+
+// reportWarnings prints the collected warnings to stderr and clears them.
+// With --strict, any warning is fatal.
+func reportWarnings() {
+	warnings := parseWarnings
+	parseWarnings = nil
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+
+	if strict && len(warnings) > 0 {
+		fmt.Println("Error: warnings are errors with --strict, not running anything")
+		os.Exit(1)
+	}
+}
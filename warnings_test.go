@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestReportWarnings tests that warnings from parsing the commands go to stderr, not stdout
+func TestReportWarnings(t *testing.T) {
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	defer func() { os.Stderr = oldStderr }()
+
+	tags = []string{}
+	parseWarnings = nil
+	var commands []CommandInfo
+	stdout := captureStdout(func() {
+		commands = processCommands([]string{"+build!1x:make", "+test#greenish:go test ./..."})
+	})
+	w.Close()
+	var stderr bytes.Buffer
+	io.Copy(&stderr, r)
+
+	if len(commands) != 2 || commands[0].Tag != "build" || commands[1].Tag != "test" {
+		t.Errorf("processCommands() = %v, want both commands with the modifiers ignored", commands)
+	}
+	if stdout != "" {
+		t.Errorf("processCommands() stdout = %q, want no warnings on stdout", stdout)
+	}
+	want := "Warning: Invalid priority '1x' for tag 'build', expected a number\nWarning: Unknown color 'greenish' for tag 'test'\n"
+	if stderr.String() != want {
+		t.Errorf("processCommands() stderr = %q, want %q", stderr.String(), want)
+	}
+	if len(parseWarnings) != 0 {
+		t.Errorf("parseWarnings = %q after reporting, want none", parseWarnings)
+	}
+}
+
+// TestWarn tests that warnings are collected in order
+func TestWarn(t *testing.T) {
+	defer func() { parseWarnings = nil }()
+
+	parseWarnings = nil
+	warn("first %d", 1)
+	warn("second")
+	if got := strings.Join(parseWarnings, "|"); got != "first 1|second" {
+		t.Errorf("parseWarnings = %q, want both warnings in order", got)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// Weights of tags as TAG=N (--weight-tag)
+	weightTagFlags []string
+	// Weights parsed from --weight-tag by tag
+	tagWeights map[string]int
+)
+
+// parseWeight parses the number of --max-parallel slots a command takes
+func parseWeight(value string) (int, error) {
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < 1 {
+		return 0, fmt.Errorf("expected a number of at least 1")
+	}
+	return weight, nil
+}
+
+// parseTagWeights parses TAG=N values into a map of tag names to weights
+func parseTagWeights(values []string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for _, value := range values {
+		tag, number, ok := strings.Cut(value, "=")
+		if !ok || tag == "" {
+			return nil, fmt.Errorf("invalid tag weight '%s', expected 'TAG=N'", value)
+		}
+
+		weight, err := parseWeight(number)
+		if err != nil {
+			return nil, fmt.Errorf("invalid weight '%s' for tag '%s', %v", number, tag, err)
+		}
+		weights[finalTag(tag)] = weight
+	}
+	return weights, nil
+}
+
+// commandWeight returns how many --max-parallel slots a command takes
+func commandWeight(cmdInfo CommandInfo) int {
+	return max(cmdInfo.Weight, 1)
+}
+
+// weightedSlots is a semaphore of --max-parallel slots where each command
+// takes as many slots as it weighs
+type weightedSlots struct {
+	mutex sync.Mutex
+	freed *sync.Cond
+	size  int
+	free  int
+}
+
+// newWeightedSlots creates a semaphore with size free slots
+func newWeightedSlots(size int) *weightedSlots {
+	s := &weightedSlots{size: size, free: size}
+	s.freed = sync.NewCond(&s.mutex)
+	return s
+}
+
+// acquire waits until weight slots are free and takes them. A command
+// weighing more than all slots takes all of them, so it runs on its own.
+// It returns the number of slots to release.
+func (s *weightedSlots) acquire(weight int) int {
+	weight = min(weight, s.size)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for s.free < weight {
+		s.freed.Wait()
+	}
+	s.free -= weight
+	return weight
+}
+
+// release gives back slots taken with acquire
+func (s *weightedSlots) release(weight int) {
+	s.mutex.Lock()
+	s.free += weight
+	s.mutex.Unlock()
+	s.freed.Broadcast()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// TestParseTagWeights tests parsing --weight-tag values and @weight= modifiers
+func TestParseTagWeights(t *testing.T) {
+	got, err := parseTagWeights([]string{"compile=4", "lint=1"})
+	if err != nil {
+		t.Fatalf("parseTagWeights() error = %v", err)
+	}
+	if want := map[string]int{"compile": 4, "lint": 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTagWeights() = %v, want %v", got, want)
+	}
+
+	for _, invalid := range []string{"compile", "=4", "compile=heavy", "compile=0"} {
+		if _, err := parseTagWeights([]string{invalid}); err == nil {
+			t.Errorf("parseTagWeights(%q) expected an error", invalid)
+		}
+	}
+
+	cmdInfo := applyTagSpec(CommandInfo{Tag: "compile@weight=4@delay=1s", Command: "make"})
+	if cmdInfo.Tag != "compile" || cmdInfo.Weight != 4 || cmdInfo.Delay != time.Second {
+		t.Errorf("applyTagSpec() = %+v, want compile with weight 4 and a 1s delay", cmdInfo)
+	}
+}
+
+// TestWeightedSlots tests that heavy commands wait for enough free slots
+func TestWeightedSlots(t *testing.T) {
+	slots := newWeightedSlots(4)
+	if taken := slots.acquire(3); taken != 3 {
+		t.Fatalf("acquire(3) took %d slots", taken)
+	}
+
+	acquired := make(chan int)
+	go func() { acquired <- slots.acquire(2) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire(2) did not wait with only 1 slot free")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	slots.release(3)
+	if taken := <-acquired; taken != 2 {
+		t.Errorf("acquire(2) took %d slots", taken)
+	}
+	slots.release(2)
+
+	// A command heavier than all slots takes all of them
+	if taken := slots.acquire(10); taken != 4 {
+		t.Errorf("acquire(10) took %d slots, want all 4", taken)
+	}
+}
+
+// TestRunParallelWeight tests that a heavy command only starts once enough lighter ones finished
+func TestRunParallelWeight(t *testing.T) {
+	if os.Getenv("CI") == "true" {
+		t.Skip("Skipping integration test in CI environment")
+	}
+
+	oldMaxParallel, oldNoColor := maxParallel, noColor
+	maxParallel, noColor = 2, true
+	defer func() { maxParallel, noColor = oldMaxParallel, oldNoColor }()
+
+	commands := []CommandInfo{
+		{Command: "sleep 0.2", Tag: "lint", Index: 0},
+		{Command: "echo compile", Tag: "compile", Index: 1, Weight: 2},
+		{Command: "echo docs", Tag: "docs", Index: 2},
+	}
+
+	output := captureStdout(func() {
+		runParallel(commands)
+	})
+
+	// compile needs both slots, so it waits for lint, and docs waits for compile
+	var events []string
+	for _, match := range regexp.MustCompile(`\[(\w+)\] (Executing|Command completed)`).FindAllStringSubmatch(output, -1) {
+		events = append(events, match[1]+" "+match[2])
+	}
+	if len(events) < 3 || events[0] != "lint Executing" || events[1] != "lint Command completed" || events[2] != "compile Executing" {
+		t.Errorf("events = %q, want compile to start after lint completed", events)
+	}
+}